@@ -0,0 +1,126 @@
+// /*********************************************************************************
+// * Projeto:     Batedor
+// * Componente:  Agente - Transmite as coletas para um Batedor remoto (modo frota)
+// *********************************************************************************/
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// agentToken é o segredo compartilhado entre agentes e a frota (--agent-token
+// ou a variável BATEDOR_AGENT_TOKEN, que não aparece na lista de processos).
+var agentToken string
+
+// agentPath é a rota WebSocket servida pelo agente.
+const agentPath = "/agent"
+
+// agentTLS são as opções de TLS do agente: um par certificado e chave ou um
+// certificado autoassinado, como no dashboard web.
+var agentTLS struct {
+	CertFile   string
+	KeyFile    string
+	SelfSigned bool
+}
+
+// tokenMatches compara o token recebido com o esperado em tempo constante.
+func tokenMatches(got, want string) bool {
+	return want != "" && subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+// bearerToken extrai o token do cabeçalho "Authorization: Bearer <token>".
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return ""
+	}
+	return strings.TrimPrefix(auth, "Bearer ")
+}
+
+// agentHandler devolve as rotas do agente: o WebSocket em agentPath, aceito
+// somente com o token compartilhado.
+func agentHandler(hub *Hub, token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(agentPath, func(w http.ResponseWriter, r *http.Request) {
+		if !tokenMatches(bearerToken(r), token) {
+			log.Printf("Agente: conexão recusada de %s (token inválido)", r.RemoteAddr)
+			http.Error(w, "token inválido", http.StatusUnauthorized)
+			return
+		}
+		log.Printf("Agente: frota conectada de %s", r.RemoteAddr)
+		serveWs(hub, w, r)
+	})
+	return mux
+}
+
+// runAgent executa o Batedor sem TUI: coleta a cada segundo e transmite o
+// Snapshot em JSON para todas as frotas conectadas em addr, por TLS quando
+// configurado em agentTLS.
+func runAgent(addr string) error {
+	if agentToken == "" {
+		return fmt.Errorf("o modo agente exige --agent-token (ou BATEDOR_AGENT_TOKEN)")
+	}
+	tlsConfig, err := serverTLSConfig(addr, agentTLS.CertFile, agentTLS.KeyFile, agentTLS.SelfSigned)
+	if err != nil {
+		return fmt.Errorf("TLS do agente: %v", err)
+	}
+
+	hub := newHub()
+	go hub.run()
+
+	go func() {
+		collector := NewCollector()
+		ticker := time.NewTicker(1 * time.Second)
+		defer ticker.Stop()
+		lastPush := time.Now()
+		for {
+			snap := collector.Collect()
+			if err := recorder.Write(snap); err != nil {
+				log.Printf("Agente: %v", err)
+			}
+			data, err := json.Marshal(snap)
+			if err == nil {
+				hub.broadcast <- data
+			}
+			// Com --push, envia uma amostra por minuto ao servidor de histórico.
+			if historyPush != nil && time.Since(lastPush) >= time.Minute {
+				lastPush = time.Now()
+				historyPush.Push(newHistoryBatch(snapshotHostname(snap), lastPush, snap))
+			}
+			<-ticker.C
+		}
+	}()
+
+	if recorder != nil {
+		// Fecha a gravação ao encerrar, para não perder as últimas coletas.
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		go func() {
+			<-signals
+			if err := recorder.Close(); err != nil {
+				log.Printf("Agente: falha ao fechar a gravação: %v", err)
+			}
+			os.Exit(0)
+		}()
+	}
+
+	server := &http.Server{Addr: addr, Handler: agentHandler(hub, agentToken), TLSConfig: tlsConfig}
+	if tlsConfig != nil {
+		log.Printf("Agente do Batedor transmitindo em wss://%s%s", addr, agentPath)
+		return server.ListenAndServeTLS("", "")
+	}
+	if !isLoopback(addr) {
+		log.Printf("Atenção: o agente escuta em %s sem TLS; o token e as coletas trafegam às claras (use --agent-tls-cert/--agent-tls-key ou --agent-tls-self-signed)", addr)
+	}
+	log.Printf("Agente do Batedor transmitindo em ws://%s%s", addr, agentPath)
+	return server.ListenAndServe()
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/host"
+)
+
+// startTestAgent serve um agente por TLS em uma porta livre do localhost,
+// transmitindo coletas com o hostname dado até o fim do teste. A frota usa o
+// agentToken do momento em que é criada.
+func startTestAgent(t *testing.T, hostname, token string) (addr string, cert tls.Certificate) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := serverTLSConfig(ln.Addr().String(), "", "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hub := newHub()
+	go hub.run()
+	server := &http.Server{Handler: agentHandler(hub, token), TLSConfig: config}
+	go server.ServeTLS(ln, "", "")
+
+	data, err := json.Marshal(&Snapshot{Host: &host.InfoStat{Hostname: hostname}, CPUUsage: 12.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(50 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				hub.broadcast <- data
+			}
+		}
+	}()
+	t.Cleanup(func() {
+		close(done)
+		server.Close()
+	})
+	return ln.Addr().String(), config.Certificates[0]
+}
+
+// waitFleet espera até que ok aceite o estado da frota.
+func waitFleet(t *testing.T, f *Fleet, ok func([]FleetHostStatus) bool) []FleetHostStatus {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		status := f.Status()
+		if ok(status) {
+			return status
+		}
+		if time.Now().After(deadline) {
+			for _, s := range status {
+				t.Logf("%s: online=%v err=%v", s.Addr, s.Online, s.Err)
+			}
+			t.Fatal("a frota não chegou ao estado esperado")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestFleetOverTLS(t *testing.T) {
+	oldToken, oldTLS := agentToken, fleetTLS
+	agentToken = "segredo"
+	t.Cleanup(func() { agentToken, fleetTLS = oldToken, oldTLS })
+
+	// Três agentes, cada um com seu certificado; a frota confia em todos por
+	// --fleet-tls-ca.
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "agentes.pem")
+	f, err := os.Create(caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var addrs []string
+	for i := 1; i <= 3; i++ {
+		addr, cert := startTestAgent(t, fmt.Sprintf("srv%d", i), "segredo")
+		addrs = append(addrs, addr)
+		pem.Encode(f, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	fleetTLS.CAFile, fleetTLS.Insecure = caFile, false
+	config, err := fleetTLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fleet := NewFleet(addrs, config)
+	t.Cleanup(fleet.Close)
+	status := waitFleet(t, fleet, func(list []FleetHostStatus) bool {
+		for _, s := range list {
+			if !s.Online {
+				return false
+			}
+		}
+		return true
+	})
+	for i, s := range status {
+		if want := fmt.Sprintf("srv%d", i+1); s.Hostname() != want || s.Addr != addrs[i] {
+			t.Errorf("host %d = %s (%s), want %s (%s)", i, s.Hostname(), s.Addr, want, addrs[i])
+		}
+	}
+
+	// Sem confiar no certificado, a conexão é recusada.
+	untrusted := NewFleet(addrs[:1], &tls.Config{MinVersion: tls.VersionTLS12})
+	t.Cleanup(untrusted.Close)
+	waitFleet(t, untrusted, func(list []FleetHostStatus) bool { return list[0].Err != nil })
+	if s := untrusted.Status()[0]; s.Online || s.Snap != nil {
+		t.Errorf("agente com certificado desconhecido aceito: %+v", s)
+	}
+}
+
+func TestAgentRejectsWrongToken(t *testing.T) {
+	oldToken := agentToken
+	agentToken = "outro"
+	t.Cleanup(func() { agentToken = oldToken })
+	addr, _ := startTestAgent(t, "srv1", "segredo")
+
+	fleet := NewFleet([]string{addr}, &tls.Config{InsecureSkipVerify: true})
+	t.Cleanup(fleet.Close)
+	status := waitFleet(t, fleet, func(list []FleetHostStatus) bool { return list[0].Err != nil })
+	if status[0].Online || status[0].Err.Error() != "token recusado pelo agente" {
+		t.Errorf("status = %+v, want token recusado", status[0])
+	}
+}
+
+func TestFleetClose(t *testing.T) {
+	oldToken := agentToken
+	agentToken = "segredo"
+	t.Cleanup(func() { agentToken = oldToken })
+	addr, _ := startTestAgent(t, "srv1", "segredo")
+
+	// Um agente conectado e outro que não responde, esperando para reconectar.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := ln.Addr().String()
+	ln.Close()
+	fleet := NewFleet([]string{addr, closed}, &tls.Config{InsecureSkipVerify: true})
+	waitFleet(t, fleet, func(list []FleetHostStatus) bool { return list[0].Online && list[1].Err != nil })
+
+	done := make(chan struct{})
+	go func() {
+		fleet.Close()
+		fleet.Close() // Fechar de novo não faz nada.
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close() não encerrou as conexões com os agentes")
+	}
+	if s := fleet.Status()[0]; s.Snap == nil || s.Hostname() != "srv1" {
+		t.Errorf("depois de Close() = %+v, want a última coleta", s)
+	}
+
+	var nilFleet *Fleet
+	nilFleet.Close() // Sem --fleet, não faz nada.
+}
+
+func TestAgentURL(t *testing.T) {
+	tests := []struct {
+		addr   string
+		secure bool
+		want   string
+	}{
+		{"srv1:9091", false, "ws://srv1:9091/agent"},
+		{"srv1:9091", true, "wss://srv1:9091/agent"},
+		{"wss://srv1:9091", false, "wss://srv1:9091/agent"},
+		{"ws://srv1:9091/", true, "ws://srv1:9091/agent"},
+		{"wss://proxy/batedor/srv1", false, "wss://proxy/batedor/srv1"},
+	}
+	for _, tt := range tests {
+		if got := agentURL(tt.addr, tt.secure); got != tt.want {
+			t.Errorf("agentURL(%q, %v) = %q, want %q", tt.addr, tt.secure, got, tt.want)
+		}
+	}
+}
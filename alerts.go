@@ -0,0 +1,160 @@
+// /*********************************************************************************
+// * Projeto:     Batedor
+// * Componente:  Alertas - Regras de limite avaliadas sobre as métricas coletadas
+// *********************************************************************************/
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AlertRule é uma regra no formato "métrica operador limite[:duração]", por
+// exemplo "psi_cpu_some_avg10>20" ou "cpu_usage>=90:2m". A duração opcional
+// exige que a condição se mantenha por esse tempo antes de disparar.
+type AlertRule struct {
+	Expr      string
+	Metric    string
+	Op        string
+	Threshold float64
+	For       time.Duration
+}
+
+// alertOps em ordem de tentativa (os de dois caracteres primeiro).
+var alertOps = []string{">=", "<=", ">", "<"}
+
+// parseAlertRule interpreta uma regra de alerta.
+func parseAlertRule(expr string) (AlertRule, error) {
+	rule := AlertRule{Expr: strings.TrimSpace(expr)}
+	body := rule.Expr
+
+	if idx := strings.LastIndex(body, ":"); idx >= 0 {
+		d, err := time.ParseDuration(body[idx+1:])
+		if err != nil {
+			return rule, fmt.Errorf("duração inválida em %q: %v", expr, err)
+		}
+		rule.For = d
+		body = body[:idx]
+	}
+
+	for _, op := range alertOps {
+		if idx := strings.Index(body, op); idx > 0 {
+			rule.Metric = strings.TrimSpace(body[:idx])
+			rule.Op = op
+			v, err := strconv.ParseFloat(strings.TrimSpace(body[idx+len(op):]), 64)
+			if err != nil {
+				return rule, fmt.Errorf("limite inválido em %q: %v", expr, err)
+			}
+			rule.Threshold = v
+			return rule, nil
+		}
+	}
+	return rule, fmt.Errorf("regra %q deve ter o formato métrica>limite (operadores: > >= < <=)", expr)
+}
+
+// Violated indica se o valor fere a regra.
+func (r AlertRule) Violated(v float64) bool {
+	switch r.Op {
+	case ">":
+		return v > r.Threshold
+	case ">=":
+		return v >= r.Threshold
+	case "<":
+		return v < r.Threshold
+	case "<=":
+		return v <= r.Threshold
+	}
+	return false
+}
+
+// alertRulesFlag permite repetir --alert na linha de comando.
+type alertRulesFlag []AlertRule
+
+func (f *alertRulesFlag) String() string {
+	exprs := make([]string, len(*f))
+	for i, r := range *f {
+		exprs[i] = r.Expr
+	}
+	return strings.Join(exprs, ", ")
+}
+
+func (f *alertRulesFlag) Set(value string) error {
+	rule, err := parseAlertRule(value)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, rule)
+	return nil
+}
+
+// alertRules são as regras passadas com --alert.
+var alertRules alertRulesFlag
+
+// Alert é uma regra disparada.
+type Alert struct {
+	Rule  string
+	Value float64
+	Since time.Time
+}
+
+// String formata o alerta para exibição.
+func (a Alert) String() string {
+	return fmt.Sprintf("%s (atual: %.2f, desde %s)", a.Rule, a.Value, a.Since.Format("15:04:05"))
+}
+
+// AlertManager avalia as regras a cada coleta e mantém os alertas ativos.
+type AlertManager struct {
+	mu      sync.Mutex
+	rules   []AlertRule
+	pending map[string]time.Time // Quando cada regra começou a ser violada.
+	active  map[string]Alert
+}
+
+// NewAlertManager cria um avaliador para as regras dadas.
+func NewAlertManager(rules []AlertRule) *AlertManager {
+	return &AlertManager{
+		rules:   rules,
+		pending: make(map[string]time.Time),
+		active:  make(map[string]Alert),
+	}
+}
+
+// Rules devolve as regras configuradas.
+func (m *AlertManager) Rules() []AlertRule {
+	return m.rules
+}
+
+// Evaluate confere as regras contra as métricas atuais e devolve os alertas
+// ativos, ordenados pela regra. Métricas ausentes nunca disparam alerta.
+func (m *AlertManager) Evaluate(metrics map[string]float64, now time.Time) []Alert {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, rule := range m.rules {
+		v, ok := metrics[rule.Metric]
+		if !ok || !rule.Violated(v) {
+			delete(m.pending, rule.Expr)
+			delete(m.active, rule.Expr)
+			continue
+		}
+		since, ok := m.pending[rule.Expr]
+		if !ok {
+			since = now
+			m.pending[rule.Expr] = now
+		}
+		if now.Sub(since) >= rule.For {
+			m.active[rule.Expr] = Alert{Rule: rule.Expr, Value: v, Since: since}
+		}
+	}
+
+	alerts := make([]Alert, 0, len(m.active))
+	for _, a := range m.active {
+		alerts = append(alerts, a)
+	}
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].Rule < alerts[j].Rule })
+	return alerts
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseAlertRule(t *testing.T) {
+	tests := []struct {
+		expr string
+		want AlertRule
+	}{
+		{"cpu_usage>90", AlertRule{Expr: "cpu_usage>90", Metric: "cpu_usage", Op: ">", Threshold: 90}},
+		{"cpu_usage>=90:2m", AlertRule{Expr: "cpu_usage>=90:2m", Metric: "cpu_usage", Op: ">=", Threshold: 90, For: 2 * time.Minute}},
+		{" mem_available < 512 ", AlertRule{Expr: "mem_available < 512", Metric: "mem_available", Op: "<", Threshold: 512}},
+		{"disk_usage<=5.5:30s", AlertRule{Expr: "disk_usage<=5.5:30s", Metric: "disk_usage", Op: "<=", Threshold: 5.5, For: 30 * time.Second}},
+		{"temp>-10", AlertRule{Expr: "temp>-10", Metric: "temp", Op: ">", Threshold: -10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := parseAlertRule(tt.expr)
+			if err != nil || got != tt.want {
+				t.Errorf("parseAlertRule(%q) = %+v, %v; want %+v", tt.expr, got, err, tt.want)
+			}
+		})
+	}
+
+	for _, expr := range []string{
+		"",
+		"cpu_usage",
+		"cpu_usage=90",
+		">90",             // Sem métrica.
+		"cpu_usage>",      // Sem limite.
+		"cpu_usage>muito", // Limite não numérico.
+		"cpu_usage>90:2x", // Duração inválida.
+		"cpu_usage>90:",
+	} {
+		if rule, err := parseAlertRule(expr); err == nil {
+			t.Errorf("parseAlertRule(%q) = %+v, want erro", expr, rule)
+		}
+	}
+}
@@ -0,0 +1,357 @@
+// /*********************************************************************************
+// * Projeto:     Batedor
+// * Componente:  BatteryBox - Bateria e fontes de energia (/sys/class/power_supply)
+// *********************************************************************************/
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// Battery é o estado de uma bateria. Energias em Wh e potência em W; quando o
+// driver só informa carga (µAh) e corrente, os valores são convertidos pela tensão.
+type Battery struct {
+	Name          string
+	Status        string  // "Charging", "Discharging", "Full", "Not charging"...
+	Capacity      float64 // Carga atual, em %.
+	EnergyNow     float64
+	EnergyFull    float64
+	EnergyDesign  float64
+	Power         float64 // Potência instantânea (sempre positiva).
+	CycleCount    int     // -1 quando o driver não informa.
+	Health        string  // Texto do driver (ex.: "Good"), se houver.
+	Technology    string
+	Model         string
+	TimeRemaining time.Duration // Até esvaziar ou até encher; 0 se desconhecido.
+}
+
+// Charging indica se a bateria está carregando.
+func (b Battery) Charging() bool {
+	return b.Status == "Charging"
+}
+
+// Discharging indica se a bateria está descarregando.
+func (b Battery) Discharging() bool {
+	return b.Status == "Discharging"
+}
+
+// Wear devolve a capacidade atual em relação à de fábrica, em %, ou -1 se
+// o driver não informa a capacidade de fábrica.
+func (b Battery) Wear() float64 {
+	if b.EnergyDesign <= 0 || b.EnergyFull <= 0 {
+		return -1
+	}
+	return b.EnergyFull / b.EnergyDesign * 100
+}
+
+// PowerSupplyInfo agrupa as baterias e o estado da alimentação externa.
+type PowerSupplyInfo struct {
+	Batteries []Battery
+	HasAC     bool // Existe alguma fonte externa (Mains/USB) registrada.
+	ACOnline  bool
+}
+
+// Capacity devolve a carga combinada de todas as baterias, em %.
+func (p PowerSupplyInfo) Capacity() float64 {
+	var now, full, pct float64
+	for _, b := range p.Batteries {
+		now += b.EnergyNow
+		full += b.EnergyFull
+		pct += b.Capacity
+	}
+	if full > 0 {
+		return now / full * 100
+	}
+	if len(p.Batteries) > 0 {
+		return pct / float64(len(p.Batteries))
+	}
+	return 0
+}
+
+// DischargePower devolve a potência total drenada das baterias, em W (0
+// quando nenhuma está descarregando).
+func (p PowerSupplyInfo) DischargePower() float64 {
+	var w float64
+	for _, b := range p.Batteries {
+		if b.Discharging() {
+			w += b.Power
+		}
+	}
+	return w
+}
+
+// batteryMetrics acrescenta as séries de bateria, se houver alguma.
+func (p PowerSupplyInfo) batteryMetrics(m map[string]float64) {
+	if len(p.Batteries) == 0 {
+		return
+	}
+	m["battery_capacity"] = p.Capacity()
+	m["battery_power"] = p.DischargePower()
+	var remaining time.Duration
+	for _, b := range p.Batteries {
+		if b.Discharging() && b.TimeRemaining > remaining {
+			remaining = b.TimeRemaining
+		}
+	}
+	if remaining > 0 {
+		m["battery_time_left"] = remaining.Minutes()
+	}
+}
+
+func init() {
+	metricInfos["battery_capacity"] = MetricInfo{"Carga da bateria", "%"}
+	metricInfos["battery_power"] = MetricInfo{"Consumo da bateria", "W"}
+	metricInfos["battery_time_left"] = MetricInfo{"Autonomia restante (min)", ""}
+}
+
+// readSupplyString lê um atributo textual de uma fonte de energia.
+func readSupplyString(dir, attr string) string {
+	data, err := os.ReadFile(filepath.Join(dir, attr))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// readSupplyValue lê um atributo numérico. Alguns drivers informam corrente
+// e potência negativas ao descarregar, por isso o valor é lido com sinal.
+func readSupplyValue(dir, attr string) (float64, bool) {
+	s := readSupplyString(dir, attr)
+	if s == "" {
+		return 0, false
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return float64(v), true
+}
+
+// readBattery lê uma bateria do sysfs.
+func readBattery(dir string) Battery {
+	b := Battery{
+		Name:       filepath.Base(dir),
+		Status:     readSupplyString(dir, "status"),
+		CycleCount: -1,
+		Health:     readSupplyString(dir, "health"),
+		Technology: readSupplyString(dir, "technology"),
+		Model:      strings.TrimSpace(readSupplyString(dir, "manufacturer") + " " + readSupplyString(dir, "model_name")),
+	}
+	if v, ok := readSupplyValue(dir, "cycle_count"); ok && v > 0 {
+		b.CycleCount = int(v)
+	}
+
+	// Tensão em V, usada para converter carga (µAh) e corrente (µA).
+	voltage, _ := readSupplyValue(dir, "voltage_now")
+	if voltage <= 0 {
+		voltage, _ = readSupplyValue(dir, "voltage_min_design")
+	}
+	voltage /= 1e6
+
+	if v, ok := readSupplyValue(dir, "energy_now"); ok {
+		b.EnergyNow = v / 1e6
+		b.EnergyFull, _ = readSupplyValue(dir, "energy_full")
+		b.EnergyDesign, _ = readSupplyValue(dir, "energy_full_design")
+		b.EnergyFull /= 1e6
+		b.EnergyDesign /= 1e6
+	} else if v, ok := readSupplyValue(dir, "charge_now"); ok {
+		full, _ := readSupplyValue(dir, "charge_full")
+		design, _ := readSupplyValue(dir, "charge_full_design")
+		b.EnergyNow = v / 1e6 * voltage
+		b.EnergyFull = full / 1e6 * voltage
+		b.EnergyDesign = design / 1e6 * voltage
+	}
+
+	if v, ok := readSupplyValue(dir, "power_now"); ok {
+		b.Power = math.Abs(v) / 1e6
+	} else if v, ok := readSupplyValue(dir, "current_now"); ok {
+		b.Power = math.Abs(v) / 1e6 * voltage
+	}
+
+	if v, ok := readSupplyValue(dir, "capacity"); ok {
+		b.Capacity = v
+	} else if b.EnergyFull > 0 {
+		b.Capacity = b.EnergyNow / b.EnergyFull * 100
+	}
+
+	// Prefere a estimativa do próprio driver; senão calcula pela potência.
+	switch {
+	case b.Discharging():
+		if v, ok := readSupplyValue(dir, "time_to_empty_now"); ok && v > 0 {
+			b.TimeRemaining = time.Duration(v) * time.Second
+		} else if b.Power > 0 {
+			b.TimeRemaining = time.Duration(b.EnergyNow / b.Power * float64(time.Hour))
+		}
+	case b.Charging():
+		if v, ok := readSupplyValue(dir, "time_to_full_now"); ok && v > 0 {
+			b.TimeRemaining = time.Duration(v) * time.Second
+		} else if b.Power > 0 && b.EnergyFull > b.EnergyNow {
+			b.TimeRemaining = time.Duration((b.EnergyFull - b.EnergyNow) / b.Power * float64(time.Hour))
+		}
+	}
+	return b
+}
+
+// readPowerSupply lê todas as fontes de /sys/class/power_supply. Em
+// máquinas sem bateria o resultado simplesmente vem vazio.
+func readPowerSupply() PowerSupplyInfo {
+	var info PowerSupplyInfo
+	dirs, _ := filepath.Glob(sysPath("class", "power_supply", "*"))
+	for _, dir := range dirs {
+		switch readSupplyString(dir, "type") {
+		case "Battery":
+			// Baterias de periféricos (mouse, teclado) não alimentam a máquina.
+			if scope := readSupplyString(dir, "scope"); scope == "Device" {
+				continue
+			}
+			info.Batteries = append(info.Batteries, readBattery(dir))
+		case "Mains", "USB", "USB_C", "USB_PD":
+			info.HasAC = true
+			if v, _ := readSupplyValue(dir, "online"); v > 0 {
+				info.ACOnline = true
+			}
+		}
+	}
+	sort.Slice(info.Batteries, func(i, j int) bool { return info.Batteries[i].Name < info.Batteries[j].Name })
+	return info
+}
+
+// batteryStatusText traduz o status do driver.
+func batteryStatusText(status string) string {
+	switch status {
+	case "Charging":
+		return "[green]Carregando"
+	case "Discharging":
+		return "[yellow]Descarregando"
+	case "Full":
+		return "[green]Carregada"
+	case "Not charging":
+		return "[white]Conectada, sem carregar"
+	case "":
+		return "[white]Desconhecido"
+	}
+	return "[white]" + tview.Escape(status)
+}
+
+// batteryColor escolhe a cor da carga.
+func batteryColor(capacity float64) string {
+	if capacity < 15 {
+		return "red"
+	} else if capacity < 35 {
+		return "yellow"
+	}
+	return "green"
+}
+
+// formatRemaining formata a autonomia como "2h05m".
+func formatRemaining(d time.Duration) string {
+	if d <= 0 {
+		return "-"
+	}
+	d = d.Round(time.Minute)
+	return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+}
+
+// BatteryBox é o widget da tela de bateria.
+type BatteryBox struct {
+	*tview.Box
+	mu     sync.RWMutex
+	supply PowerSupplyInfo
+}
+
+// NewBatteryBox cria um novo widget BatteryBox.
+func NewBatteryBox() *BatteryBox {
+	return &BatteryBox{
+		Box: tview.NewBox().SetBorder(true).SetTitle(tview.Escape(" Bateria e Alimentação | [Q] Voltar ")),
+	}
+}
+
+// Update atualiza o estado exibido.
+func (b *BatteryBox) Update(supply PowerSupplyInfo) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.supply = supply
+}
+
+// Draw desenha o widget na tela.
+func (b *BatteryBox) Draw(screen tcell.Screen) {
+	b.Box.Draw(screen)
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	x, y, width, height := b.GetInnerRect()
+	if width <= 0 || height <= 0 {
+		return
+	}
+
+	var lines []string
+	switch {
+	case !b.supply.HasAC:
+		lines = append(lines, "[yellow]Alimentação externa: [white]não informada")
+	case b.supply.ACOnline:
+		lines = append(lines, "[yellow]Alimentação externa: [green]conectada")
+	default:
+		lines = append(lines, "[yellow]Alimentação externa: [red]desconectada")
+	}
+	lines = append(lines, "")
+
+	if len(b.supply.Batteries) == 0 {
+		lines = append(lines, "[white]Nenhuma bateria encontrada (/sys/class/power_supply).")
+	}
+	barWidth := width - 40
+	for _, bat := range b.supply.Batteries {
+		title := bat.Name
+		if bat.Model != "" {
+			title += " - " + bat.Model
+		}
+		lines = append(lines,
+			"[green]"+tview.Escape(title)+":",
+			fmt.Sprintf("[yellow]%-14s[%s] %.1f%% %s", "Carga:", batteryColor(bat.Capacity), bat.Capacity, usageBar(bat.Capacity, barWidth)),
+			fmt.Sprintf("[yellow]%-14s %s", "Estado:", batteryStatusText(bat.Status)))
+
+		remainingLabel := "Autonomia:"
+		if bat.Charging() {
+			remainingLabel = "Carga total:"
+		}
+		lines = append(lines,
+			fmt.Sprintf("[yellow]%-14s[white] %s", remainingLabel, formatRemaining(bat.TimeRemaining)),
+			fmt.Sprintf("[yellow]%-14s[white] %.2f W", "Potência:", bat.Power))
+
+		if bat.EnergyFull > 0 {
+			lines = append(lines, fmt.Sprintf("[yellow]%-14s[white] %.1f de %.1f Wh", "Energia:", bat.EnergyNow, bat.EnergyFull))
+		}
+		health := "-"
+		if wear := bat.Wear(); wear >= 0 {
+			health = fmt.Sprintf("[%s]%.0f%%[white] da capacidade de fábrica (%.1f Wh)", batteryColor(wear), wear, bat.EnergyDesign)
+		}
+		if bat.Health != "" {
+			health += " - " + tview.Escape(bat.Health)
+		}
+		lines = append(lines, fmt.Sprintf("[yellow]%-14s[white] %s", "Saúde:", health))
+		if bat.CycleCount >= 0 {
+			lines = append(lines, fmt.Sprintf("[yellow]%-14s[white] %d", "Ciclos:", bat.CycleCount))
+		}
+		if bat.Technology != "" {
+			lines = append(lines, fmt.Sprintf("[yellow]%-14s[white] %s", "Tecnologia:", tview.Escape(bat.Technology)))
+		}
+		lines = append(lines, "")
+	}
+
+	for i, line := range lines {
+		if i >= height {
+			break
+		}
+		tview.Print(screen, line, x+1, y+i, width-2, tview.AlignLeft, tcell.ColorWhite)
+	}
+}
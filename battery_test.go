@@ -0,0 +1,118 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestReadPowerSupply(t *testing.T) {
+	const bat = "class/power_supply/BAT0/"
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  Battery
+		ac    bool
+	}{
+		{
+			name: "energia e potência",
+			files: map[string]string{
+				bat + "type":               "Battery",
+				bat + "status":             "Discharging",
+				bat + "energy_now":         "30000000",
+				bat + "energy_full":        "45000000",
+				bat + "energy_full_design": "50000000",
+				bat + "power_now":          "-15000000",
+				bat + "capacity":           "66",
+				bat + "cycle_count":        "120",
+			},
+			want: Battery{Name: "BAT0", Status: "Discharging", Capacity: 66, EnergyNow: 30, EnergyFull: 45, EnergyDesign: 50, Power: 15, CycleCount: 120, TimeRemaining: 2 * time.Hour},
+		},
+		{
+			// Sem energy_now nem power_now: carga em µAh e corrente em µA,
+			// convertidas pela tensão; a carga sai de energy_now/energy_full.
+			name: "carga e corrente",
+			files: map[string]string{
+				bat + "type":               "Battery",
+				bat + "status":             "Charging",
+				bat + "voltage_now":        "12000000",
+				bat + "charge_now":         "2000000",
+				bat + "charge_full":        "4000000",
+				bat + "charge_full_design": "5000000",
+				bat + "current_now":        "1000000",
+			},
+			want: Battery{Name: "BAT0", Status: "Charging", Capacity: 50, EnergyNow: 24, EnergyFull: 48, EnergyDesign: 60, Power: 12, CycleCount: -1, TimeRemaining: 2 * time.Hour},
+		},
+		{
+			name: "sem energia nem potência",
+			files: map[string]string{
+				bat + "type":              "Battery",
+				bat + "status":            "Discharging",
+				bat + "capacity":          "80",
+				bat + "time_to_empty_now": "3600",
+			},
+			want: Battery{Name: "BAT0", Status: "Discharging", Capacity: 80, CycleCount: -1, TimeRemaining: time.Hour},
+		},
+		{
+			name: "só a capacidade, sem estimativa",
+			files: map[string]string{
+				bat + "type":     "Battery",
+				bat + "status":   "Discharging",
+				bat + "capacity": "80",
+			},
+			want: Battery{Name: "BAT0", Status: "Discharging", Capacity: 80, CycleCount: -1},
+		},
+		{
+			name: "tomada ligada",
+			files: map[string]string{
+				bat + "type":                      "Battery",
+				bat + "status":                    "Full",
+				bat + "capacity":                  "100",
+				"class/power_supply/AC/type":      "Mains",
+				"class/power_supply/AC/online":    "1",
+				"class/power_supply/hidpp/type":   "Battery",
+				"class/power_supply/hidpp/scope":  "Device",
+				"class/power_supply/hidpp/status": "Discharging",
+			},
+			want: Battery{Name: "BAT0", Status: "Full", Capacity: 100, CycleCount: -1},
+			ac:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeSys(t, tt.files)
+			info := readPowerSupply()
+			if len(info.Batteries) != 1 {
+				t.Fatalf("readPowerSupply() = %+v, want uma bateria", info)
+			}
+			if got := info.Batteries[0]; !batteryEqual(got, tt.want) {
+				t.Errorf("bateria = %+v, want %+v", got, tt.want)
+			}
+			if info.ACOnline != tt.ac || info.HasAC != tt.ac {
+				t.Errorf("HasAC, ACOnline = %v, %v; want %v", info.HasAC, info.ACOnline, tt.ac)
+			}
+		})
+	}
+}
+
+func TestReadPowerSupplyWithoutBattery(t *testing.T) {
+	fakeSys(t, map[string]string{"class/power_supply/AC/type": "Mains", "class/power_supply/AC/online": "0"})
+	info := readPowerSupply()
+	if len(info.Batteries) != 0 || !info.HasAC || info.ACOnline {
+		t.Fatalf("readPowerSupply() = %+v", info)
+	}
+	m := make(map[string]float64)
+	info.batteryMetrics(m)
+	if len(m) != 0 {
+		t.Fatalf("sem bateria não deve haver séries: %v", m)
+	}
+}
+
+// batteryEqual compara as baterias com tolerância nos valores convertidos.
+func batteryEqual(a, b Battery) bool {
+	near := func(x, y float64) bool { return math.Abs(x-y) < 1e-9 }
+	return a.Name == b.Name && a.Status == b.Status && a.CycleCount == b.CycleCount &&
+		near(a.Capacity, b.Capacity) && near(a.EnergyNow, b.EnergyNow) && near(a.EnergyFull, b.EnergyFull) &&
+		near(a.EnergyDesign, b.EnergyDesign) && near(a.Power, b.Power) &&
+		(a.TimeRemaining-b.TimeRemaining).Abs() < time.Second
+}
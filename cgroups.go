@@ -0,0 +1,443 @@
+// /*********************************************************************************
+// * Projeto:     Batedor
+// * Componente:  CgroupView - Uso de recursos por cgroup v2 (slices, serviços, escopos)
+// *********************************************************************************/
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// CgroupStat é o uso de recursos de um cgroup. Como no cgroup v2 os
+// contadores são hierárquicos, os valores já incluem os cgroups filhos.
+type CgroupStat struct {
+	Path        string  // Relativo à raiz, ex.: "/system.slice/nginx.service".
+	CPU         float64 // % de um núcleo, como no CPU% dos processos.
+	MemCurrent  uint64
+	MemMax      uint64  // 0 quando não há limite ("max").
+	IOReadRate  float64 // Bytes/s.
+	IOWriteRate float64 // Bytes/s.
+	PIDs        uint64  // Tarefas no cgroup e nos filhos (pids.current).
+	Procs       []int32 // Processos diretamente neste cgroup (cgroup.procs).
+}
+
+// IsAncestorOf indica se o cgroup contém (ou é) o caminho dado.
+func (c CgroupStat) IsAncestorOf(path string) bool {
+	return c.Path == "/" || path == c.Path || strings.HasPrefix(path, c.Path+"/")
+}
+
+// cgroupRoot devolve onde o cgroup v2 está montado: direto em
+// /sys/fs/cgroup (modo unificado) ou em /sys/fs/cgroup/unified (modo
+// híbrido). Devolve "" se o sistema só tem cgroup v1.
+func cgroupRoot() string {
+	for _, dir := range []string{sysPath("fs", "cgroup"), sysPath("fs", "cgroup", "unified")} {
+		if _, err := os.Stat(filepath.Join(dir, "cgroup.controllers")); err == nil {
+			return dir
+		}
+	}
+	return ""
+}
+
+// readKeyedFile lê arquivos "chave valor" como cpu.stat e memory.stat.
+func readKeyedFile(path string) map[string]uint64 {
+	values := make(map[string]uint64)
+	f, err := os.Open(path)
+	if err != nil {
+		return values
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		if v, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			values[fields[0]] = v
+		}
+	}
+	return values
+}
+
+// readIOStat soma os bytes lidos e escritos de todos os dispositivos em io.stat
+// ("8:0 rbytes=... wbytes=... rios=... wios=...").
+func readIOStat(path string) (read, write uint64) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		for _, field := range strings.Fields(scanner.Text()) {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			v, err := strconv.ParseUint(kv[1], 10, 64)
+			if err != nil {
+				continue
+			}
+			switch kv[0] {
+			case "rbytes":
+				read += v
+			case "wbytes":
+				write += v
+			}
+		}
+	}
+	return read, write
+}
+
+// readCgroupProcs lê os PIDs de cgroup.procs.
+func readCgroupProcs(dir string) []int32 {
+	data, err := os.ReadFile(filepath.Join(dir, "cgroup.procs"))
+	if err != nil {
+		return nil
+	}
+	var pids []int32
+	for _, field := range strings.Fields(string(data)) {
+		if pid, err := strconv.ParseInt(field, 10, 32); err == nil {
+			pids = append(pids, int32(pid))
+		}
+	}
+	return pids
+}
+
+// cgroupCounters guarda os contadores acumulados de um cgroup.
+type cgroupCounters struct {
+	usageUsec uint64
+	ioRead    uint64
+	ioWrite   uint64
+}
+
+// cgroupSampler percorre a árvore de cgroups e transforma os contadores
+// acumulados (cpu.stat, io.stat) em taxas entre duas leituras.
+type cgroupSampler struct {
+	last      map[string]cgroupCounters
+	lastCheck time.Time
+}
+
+// counterRate devolve a taxa por segundo entre dois contadores, ignorando
+// reinícios (cgroup recriado com o mesmo nome).
+func counterRate(cur, prev uint64, elapsed float64) float64 {
+	if cur < prev || elapsed <= 0 {
+		return 0
+	}
+	return float64(cur-prev) / elapsed
+}
+
+// sample lê todos os cgroups. Devolve nil em sistemas sem cgroup v2.
+func (s *cgroupSampler) sample(now time.Time) []CgroupStat {
+	root := cgroupRoot()
+	if root == "" {
+		return nil
+	}
+
+	elapsed := now.Sub(s.lastCheck).Seconds()
+	current := make(map[string]cgroupCounters)
+	var stats []CgroupStat
+
+	filepath.WalkDir(root, func(dir string, d os.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, dir)
+		path := "/" + filepath.ToSlash(rel)
+		if rel == "." {
+			path = "/"
+		}
+
+		st := CgroupStat{Path: path, Procs: readCgroupProcs(dir)}
+		var counters cgroupCounters
+		counters.usageUsec = readKeyedFile(filepath.Join(dir, "cpu.stat"))["usage_usec"]
+		counters.ioRead, counters.ioWrite = readIOStat(filepath.Join(dir, "io.stat"))
+		st.MemCurrent, _ = readUintFile(filepath.Join(dir, "memory.current"))
+		st.MemMax, _ = readUintFile(filepath.Join(dir, "memory.max")) // "max" falha no parse e vira 0.
+		st.PIDs, _ = readUintFile(filepath.Join(dir, "pids.current"))
+		if path == "/" {
+			// A raiz não tem memory.current nem pids.current.
+			st.MemCurrent, st.PIDs = 0, 0
+		}
+
+		if prev, ok := s.last[path]; ok && !s.lastCheck.IsZero() {
+			st.CPU = counterRate(counters.usageUsec, prev.usageUsec, elapsed) / 1e6 * 100
+			st.IOReadRate = counterRate(counters.ioRead, prev.ioRead, elapsed)
+			st.IOWriteRate = counterRate(counters.ioWrite, prev.ioWrite, elapsed)
+		}
+		current[path] = counters
+		stats = append(stats, st)
+		return nil
+	})
+
+	s.last = current
+	s.lastCheck = now
+	return stats
+}
+
+// filterAndSortCgroups aplica o filtro pelo caminho e a ordenação
+// escolhida, devolvendo uma nova lista.
+func filterAndSortCgroups(stats []CgroupStat, filter, sortBy string) []CgroupStat {
+	filter = strings.ToLower(filter)
+	list := make([]CgroupStat, 0, len(stats))
+	for _, st := range stats {
+		if filter != "" && !strings.Contains(strings.ToLower(st.Path), filter) {
+			continue
+		}
+		list = append(list, st)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		switch sortBy {
+		case "mem":
+			return list[i].MemCurrent > list[j].MemCurrent
+		case "io":
+			return list[i].IOReadRate+list[i].IOWriteRate > list[j].IOReadRate+list[j].IOWriteRate
+		case "pids":
+			return list[i].PIDs > list[j].PIDs
+		case "name":
+			return list[i].Path < list[j].Path
+		default:
+			return list[i].CPU > list[j].CPU
+		}
+	})
+	return list
+}
+
+// cgroupMembers devolve os processos do cgroup e de seus filhos. Processos
+// que a coleta descartou por estarem ociosos entram com CPU e memória zeradas.
+func cgroupMembers(stats []CgroupStat, procs []ProcData, cg CgroupStat) []ProcData {
+	byPID := make(map[int32]ProcData, len(procs))
+	for _, p := range procs {
+		byPID[p.PID] = p
+	}
+	var members []ProcData
+	for _, st := range stats {
+		if !cg.IsAncestorOf(st.Path) {
+			continue
+		}
+		for _, pid := range st.Procs {
+			p, ok := byPID[pid]
+			if !ok {
+				p = ProcData{PID: pid}
+				if data, err := os.ReadFile(procPath(strconv.Itoa(int(pid)), "comm")); err == nil {
+					p.Command = strings.TrimSpace(string(data))
+				}
+			}
+			members = append(members, p)
+		}
+	}
+	return members
+}
+
+// cgroupSortLabels são os nomes exibidos para cada ordenação.
+var cgroupSortLabels = map[string]string{
+	"cpu":  "CPU",
+	"mem":  "Memória",
+	"io":   "E/S",
+	"pids": "PIDs",
+	"name": "Nome",
+}
+
+// CgroupView é a tela de cgroups: um filtro e uma tabela que lista os
+// cgroups ou, após Enter, os processos do cgroup escolhido.
+type CgroupView struct {
+	*tview.Flex
+	filter   *tview.InputField
+	table    *tview.Table
+	mu       sync.RWMutex
+	stats    []CgroupStat
+	procs    []ProcData
+	sortBy   string
+	selected string // Caminho do cgroup aberto; "" mostra a lista de cgroups.
+	updated  bool   // Já recebeu a primeira coleta.
+}
+
+// NewCgroupView cria a tela de cgroups.
+func NewCgroupView() *CgroupView {
+	v := &CgroupView{
+		filter: tview.NewInputField().SetLabel("Filtrar cgroups (caminho): ").SetLabelColor(tcell.ColorYellow),
+		table:  tview.NewTable().SetSelectable(true, false).SetFixed(1, 0),
+		sortBy: "cpu",
+	}
+	v.table.SetBorder(true)
+	v.filter.SetDoneFunc(func(key tcell.Key) {
+		v.refresh()
+	})
+	v.filter.SetChangedFunc(func(text string) {
+		v.refresh()
+	})
+	v.Flex = tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(v.filter, 1, 0, false).
+		AddItem(v.table, 0, 1, true)
+	v.refresh()
+	return v
+}
+
+// Update atualiza os cgroups e processos exibidos.
+func (v *CgroupView) Update(stats []CgroupStat, procs []ProcData) {
+	v.mu.Lock()
+	v.stats = stats
+	v.procs = procs
+	v.updated = true
+	v.mu.Unlock()
+	v.refresh()
+}
+
+// FilterFocused indica se o campo de filtro está recebendo as teclas.
+func (v *CgroupView) FilterFocused() bool {
+	return v.filter.HasFocus()
+}
+
+// Filter devolve o campo de filtro, para que a aplicação possa focá-lo.
+func (v *CgroupView) Filter() *tview.InputField {
+	return v.filter
+}
+
+// HandleKey trata as teclas da tabela: C/M/I/P/N ordenam, Enter abre o
+// cgroup selecionado e Esc volta para a lista. Devolve nil se a tecla foi
+// consumida.
+func (v *CgroupView) HandleKey(event *tcell.EventKey) *tcell.EventKey {
+	switch event.Key() {
+	case tcell.KeyEnter:
+		v.openSelected()
+		return nil
+	case tcell.KeyEscape:
+		v.mu.Lock()
+		v.selected = ""
+		v.mu.Unlock()
+		v.table.Select(1, 0)
+		v.refresh()
+		return nil
+	}
+	sortBy := ""
+	switch event.Rune() {
+	case 'c', 'C':
+		sortBy = "cpu"
+	case 'm', 'M':
+		sortBy = "mem"
+	case 'i', 'I':
+		sortBy = "io"
+	case 'p', 'P':
+		sortBy = "pids"
+	case 'n', 'N':
+		sortBy = "name"
+	default:
+		return event
+	}
+	v.mu.Lock()
+	v.sortBy = sortBy
+	v.mu.Unlock()
+	v.refresh()
+	return nil
+}
+
+// openSelected abre a lista de processos do cgroup da linha selecionada.
+func (v *CgroupView) openSelected() {
+	row, _ := v.table.GetSelection()
+	if row <= 0 {
+		return
+	}
+	ref, ok := v.table.GetCell(row, 0).GetReference().(string)
+	if !ok {
+		return
+	}
+	v.mu.Lock()
+	v.selected = ref
+	v.mu.Unlock()
+	v.table.Select(1, 0)
+	v.refresh()
+}
+
+// refresh redesenha a tabela com os dados atuais.
+func (v *CgroupView) refresh() {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	if v.selected != "" {
+		v.drawMembers()
+		return
+	}
+
+	v.table.SetTitle(tview.Escape(fmt.Sprintf(" Cgroups (ordenando por %s) | [/] Filtrar | [C]PU [M]em [I]/O [P]IDs [N]ome | [Enter] Processos | [Q] Voltar ",
+		cgroupSortLabels[v.sortBy])))
+	v.table.Clear()
+	if !v.updated {
+		v.table.SetCell(0, 0, tview.NewTableCell("Lendo os cgroups...").SetSelectable(false))
+		return
+	}
+	if v.stats == nil {
+		v.table.SetCell(0, 0, tview.NewTableCell(fmt.Sprintf("cgroup v2 indisponível (nenhum cgroup.controllers em %s).", sysPath("fs", "cgroup"))).SetSelectable(false))
+		return
+	}
+
+	headers := []string{"Cgroup", "CPU%", "Memória", "Limite", "Leitura/s", "Escrita/s", "PIDs"}
+	for i, header := range headers {
+		v.table.SetCell(0, i, tview.NewTableCell(header).SetTextColor(tcell.ColorYellow).SetSelectable(false))
+	}
+	for i, st := range filterAndSortCgroups(v.stats, v.filter.GetText(), v.sortBy) {
+		row := i + 1
+		limit := "-"
+		memColor := tcell.ColorGreen
+		if st.MemMax > 0 {
+			limit = formatBytesNetBox(st.MemMax)
+			if float64(st.MemCurrent) > 0.9*float64(st.MemMax) {
+				memColor = tcell.ColorRed
+			}
+		}
+		v.table.SetCell(row, 0, tview.NewTableCell(st.Path).SetTextColor(tcell.ColorWhite).SetReference(st.Path).SetExpansion(1))
+		v.table.SetCell(row, 1, tview.NewTableCell(fmt.Sprintf("%.2f", st.CPU)).SetTextColor(tcell.ColorGreen).SetAlign(tview.AlignRight))
+		v.table.SetCell(row, 2, tview.NewTableCell(formatBytesNetBox(st.MemCurrent)).SetTextColor(memColor).SetAlign(tview.AlignRight))
+		v.table.SetCell(row, 3, tview.NewTableCell(limit).SetTextColor(tcell.ColorBlue).SetAlign(tview.AlignRight))
+		v.table.SetCell(row, 4, tview.NewTableCell(formatBytes(uint64(st.IOReadRate))).SetTextColor(tcell.ColorWhite).SetAlign(tview.AlignRight))
+		v.table.SetCell(row, 5, tview.NewTableCell(formatBytes(uint64(st.IOWriteRate))).SetTextColor(tcell.ColorWhite).SetAlign(tview.AlignRight))
+		v.table.SetCell(row, 6, tview.NewTableCell(strconv.FormatUint(st.PIDs, 10)).SetTextColor(tcell.ColorWhite).SetAlign(tview.AlignRight))
+	}
+}
+
+// drawMembers lista os processos do cgroup aberto.
+func (v *CgroupView) drawMembers() {
+	v.table.Clear()
+	var cg CgroupStat
+	found := false
+	for _, st := range v.stats {
+		if st.Path == v.selected {
+			cg, found = st, true
+			break
+		}
+	}
+	v.table.SetTitle(tview.Escape(fmt.Sprintf(" Processos de %s | [Esc] Voltar aos cgroups | [Q] Voltar ", v.selected)))
+	if !found {
+		v.table.SetCell(0, 0, tview.NewTableCell("O cgroup não existe mais.").SetSelectable(false))
+		return
+	}
+
+	sortBy := v.sortBy
+	if sortBy != "mem" && sortBy != "cpu" {
+		sortBy = "pid"
+	}
+	members := filterAndSortProcs(cgroupMembers(v.stats, v.procs, cg), "", sortBy)
+
+	headers := []string{"PID", "Usuário", "CPU%", "MEM%", "Comando"}
+	for i, header := range headers {
+		v.table.SetCell(0, i, tview.NewTableCell(header).SetTextColor(tcell.ColorYellow).SetSelectable(false))
+	}
+	for i, p := range members {
+		row := i + 1
+		v.table.SetCell(row, 0, tview.NewTableCell(strconv.Itoa(int(p.PID))).SetTextColor(tcell.ColorWhite))
+		v.table.SetCell(row, 1, tview.NewTableCell(p.User).SetTextColor(tcell.ColorBlue))
+		v.table.SetCell(row, 2, tview.NewTableCell(fmt.Sprintf("%.2f", p.CPU)).SetTextColor(tcell.ColorGreen))
+		v.table.SetCell(row, 3, tview.NewTableCell(fmt.Sprintf("%.2f", p.Mem)).SetTextColor(tcell.ColorGreen))
+		v.table.SetCell(row, 4, tview.NewTableCell(p.Command).SetTextColor(tcell.ColorWhite).SetExpansion(1))
+	}
+}
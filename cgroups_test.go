@@ -0,0 +1,80 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCgroupSamplerSample(t *testing.T) {
+	root := fakeSys(t, map[string]string{
+		"fs/cgroup/cgroup.controllers":                      "cpu io memory pids",
+		"fs/cgroup/cpu.stat":                                "usage_usec 5000000\nuser_usec 3000000",
+		"fs/cgroup/system.slice/cpu.stat":                   "usage_usec 1000000",
+		"fs/cgroup/system.slice/memory.current":             "4096",
+		"fs/cgroup/system.slice/memory.max":                 "max",
+		"fs/cgroup/system.slice/io.stat":                    "8:0 rbytes=1000 wbytes=2000 rios=1 wios=2\n8:16 rbytes=500 wbytes=0",
+		"fs/cgroup/system.slice/pids.current":               "7",
+		"fs/cgroup/system.slice/nginx.service/cgroup.procs": "101\n102",
+		"fs/cgroup/system.slice/nginx.service/memory.max":   "1048576",
+	})
+
+	var s cgroupSampler
+	start := time.Unix(1000, 0)
+	byPath := func(stats []CgroupStat) map[string]CgroupStat {
+		m := make(map[string]CgroupStat, len(stats))
+		for _, st := range stats {
+			m[st.Path] = st
+		}
+		return m
+	}
+
+	first := byPath(s.sample(start))
+	if len(first) != 3 {
+		t.Fatalf("cgroups = %+v, want /, /system.slice e /system.slice/nginx.service", first)
+	}
+	slice := first["/system.slice"]
+	if slice.CPU != 0 || slice.IOReadRate != 0 {
+		t.Errorf("a primeira leitura não tem taxas: %+v", slice)
+	}
+	// "max" é sem limite: fica 0, como nos cgroups sem memory.max.
+	if slice.MemCurrent != 4096 || slice.MemMax != 0 || slice.PIDs != 7 {
+		t.Errorf("/system.slice = %+v", slice)
+	}
+	nginx := first["/system.slice/nginx.service"]
+	if nginx.MemMax != 1048576 || len(nginx.Procs) != 2 || nginx.Procs[0] != 101 || nginx.Procs[1] != 102 {
+		t.Errorf("/system.slice/nginx.service = %+v", nginx)
+	}
+
+	// Em 2 s, o cgroup usou 1 s de CPU (50%) e leu e escreveu mais bytes.
+	writeSysFile(t, root, "fs/cgroup/system.slice/cpu.stat", "usage_usec 2000000")
+	writeSysFile(t, root, "fs/cgroup/system.slice/io.stat", "8:0 rbytes=3000 wbytes=6000\n8:16 rbytes=500 wbytes=0")
+	writeSysFile(t, root, "fs/cgroup/cpu.stat", "usage_usec 1000") // Contador reiniciado.
+	second := byPath(s.sample(start.Add(2 * time.Second)))
+	slice = second["/system.slice"]
+	if slice.CPU != 50 || slice.IOReadRate != 1000 || slice.IOWriteRate != 2000 {
+		t.Errorf("taxas de /system.slice = CPU %v, leitura %v, escrita %v; want 50, 1000, 2000", slice.CPU, slice.IOReadRate, slice.IOWriteRate)
+	}
+	if cpu := second["/"].CPU; cpu != 0 {
+		t.Errorf("CPU da raiz com o contador reiniciado = %v, want 0", cpu)
+	}
+}
+
+func TestCgroupSamplerWithoutV2(t *testing.T) {
+	fakeSys(t, map[string]string{"fs/cgroup/cpu/cpu.shares": "1024"})
+	var s cgroupSampler
+	if stats := s.sample(time.Now()); stats != nil {
+		t.Errorf("sample() sem cgroup v2 = %+v, want nil", stats)
+	}
+
+	// A tela só avisa da falta do cgroup v2 depois da primeira coleta, e
+	// aponta o caminho de --sys-root.
+	v := NewCgroupView()
+	if text := v.table.GetCell(0, 0).Text; !strings.Contains(text, "Lendo") {
+		t.Errorf("antes da primeira coleta = %q", text)
+	}
+	v.Update(nil, nil)
+	if text := v.table.GetCell(0, 0).Text; !strings.Contains(text, sysPath("fs", "cgroup")) {
+		t.Errorf("sem cgroup v2 = %q, want o caminho %s", text, sysPath("fs", "cgroup"))
+	}
+}
@@ -0,0 +1,369 @@
+// /*********************************************************************************
+// * Projeto:     Batedor
+// * Componente:  Check - Verificações no formato dos plugins do Nagios/Icinga
+// *********************************************************************************/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// perfData é um item dos dados de desempenho, no formato
+// 'rótulo'=valor[unidade];aviso;crítico;mínimo;máximo.
+type perfData struct {
+	label      string
+	value      float64
+	unit       string
+	warn, crit string
+	min, max   string
+}
+
+func (p perfData) String() string {
+	label := p.label
+	if strings.ContainsAny(label, " '=") {
+		label = "'" + strings.ReplaceAll(label, "'", "''") + "'"
+	}
+	s := fmt.Sprintf("%s=%s%s;%s;%s;%s;%s", label, strconv.FormatFloat(p.value, 'f', -1, 64), p.unit, p.warn, p.crit, p.min, p.max)
+	return strings.TrimRight(s, ";")
+}
+
+// checkResult é a saída de uma verificação: a primeira linha do plugin.
+type checkResult struct {
+	status  checkStatus
+	summary string
+	perf    []perfData
+}
+
+// checkThresholds são os limites --warn e --crit de uma verificação em que
+// valores maiores são piores.
+type checkThresholds struct {
+	warn, crit float64
+}
+
+func (t *checkThresholds) register(fs *flag.FlagSet, warn, crit float64, unit string) {
+	fs.Float64Var(&t.warn, "warn", warn, "Limite de aviso ("+unit+"; sai com 1)")
+	fs.Float64Var(&t.crit, "crit", crit, "Limite crítico ("+unit+"; sai com 2)")
+}
+
+func (t checkThresholds) validate() error {
+	if t.warn > t.crit {
+		return fmt.Errorf("--warn (%g) deve ser menor ou igual a --crit (%g)", t.warn, t.crit)
+	}
+	return nil
+}
+
+// status compara o valor com os limites, como os plugins padrão: o limite
+// é excedido quando o valor passa dele.
+func (t checkThresholds) status(v float64) checkStatus {
+	switch {
+	case v > t.crit:
+		return statusCritical
+	case v > t.warn:
+		return statusWarning
+	}
+	return statusOK
+}
+
+func formatThreshold(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// checkFunc executa uma verificação com as opções dela. Um erro vira UNKNOWN.
+type checkFunc func(fs *flag.FlagSet, args []string) (checkResult, error)
+
+// checkKinds são as verificações de "batedor check".
+var checkKinds = map[string]checkFunc{
+	"cpu":     checkCPU,
+	"disk":    checkDisk,
+	"proc":    checkProc,
+	"latency": checkLatency,
+}
+
+// errCheckUsage indica que as opções já foram recusadas pelo FlagSet, que
+// mostrou a mensagem.
+var errCheckUsage = fmt.Errorf("opções inválidas")
+
+// runCheck implementa "batedor check tipo [opções]". A saída é uma linha
+// "TIPO ESTADO - resumo | dados de desempenho" e o código de saída é 0 (OK),
+// 1 (WARNING), 2 (CRITICAL) ou 3 (UNKNOWN), como esperam Nagios e Icinga.
+func runCheck(args []string) int {
+	names := make([]string, 0, len(checkKinds))
+	for name := range checkKinds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(args) == 0 || checkKinds[args[0]] == nil {
+		fmt.Printf("CHECK UNKNOWN - use batedor check %s [opções] (veja batedor check cpu -h)\n", strings.Join(names, "|"))
+		return int(statusUnknown)
+	}
+
+	kind := args[0]
+	fs := flag.NewFlagSet("check "+kind, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	result, err := checkKinds[kind](fs, args[1:])
+	if err == nil && fs.NArg() > 0 {
+		err = fmt.Errorf("argumento inesperado: %q", fs.Arg(0))
+	}
+	if err != nil {
+		if err == errCheckUsage {
+			err = fmt.Errorf("opções inválidas (veja batedor check %s -h)", kind)
+		}
+		result = checkResult{status: statusUnknown, summary: err.Error()}
+	}
+	writeCheckResult(os.Stdout, kind, result)
+	return int(result.status)
+}
+
+func writeCheckResult(w io.Writer, kind string, r checkResult) {
+	line := fmt.Sprintf("%s %s - %s", strings.ToUpper(kind), r.status, r.summary)
+	if len(r.perf) > 0 {
+		perf := make([]string, len(r.perf))
+		for i, p := range r.perf {
+			perf[i] = p.String()
+		}
+		line += " | " + strings.Join(perf, " ")
+	}
+	fmt.Fprintln(w, line)
+}
+
+// checkCPU mede o uso médio de CPU direto do /proc/stat, sem o coletor da
+// TUI: um plugin roda a cada poucos minutos e não deve consultar o Docker, o
+// kubelet, a rede ou o dmidecode para saber o uso de CPU.
+func checkCPU(fs *flag.FlagSet, args []string) (checkResult, error) {
+	var t checkThresholds
+	t.register(fs, 80, 95, "% de uso")
+	samples := fs.Int("samples", 1, "Número de medições; o uso comparado é a média")
+	interval := fs.Duration("interval", time.Second, "Duração de cada medição")
+	fs.StringVar(&procRoot, "proc-root", procRoot, "Raiz do procfs lida diretamente (ex.: /host/proc)")
+	if err := fs.Parse(args); err != nil {
+		return checkResult{}, errCheckUsage
+	}
+	if err := t.validate(); err != nil {
+		return checkResult{}, err
+	}
+	if *samples < 1 || *interval <= 0 {
+		return checkResult{}, fmt.Errorf("--samples deve ser ao menos 1 e --interval maior que zero")
+	}
+
+	var usage, iowait, steal float64
+	for i := 0; i < *samples; i++ {
+		u, times, err := measureCPU(*interval)
+		if err != nil {
+			return checkResult{}, err
+		}
+		usage += u / float64(*samples)
+		iowait += times.Iowait / float64(*samples)
+		steal += times.Steal / float64(*samples)
+	}
+	load1, load5, load15, err := readLoadAvg()
+	if err != nil {
+		return checkResult{}, err
+	}
+	return checkResult{
+		status:  t.status(usage),
+		summary: fmt.Sprintf("uso de CPU %.1f%% (carga %.2f %.2f %.2f)", usage, load1, load5, load15),
+		perf: []perfData{
+			{label: "cpu_usage", value: round2(usage), unit: "%", warn: formatThreshold(t.warn), crit: formatThreshold(t.crit), min: "0", max: "100"},
+			{label: "cpu_iowait", value: round2(iowait), unit: "%", min: "0", max: "100"},
+			{label: "cpu_steal", value: round2(steal), unit: "%", min: "0", max: "100"},
+			{label: "load1", value: round2(load1), min: "0"},
+			{label: "load5", value: round2(load5), min: "0"},
+			{label: "load15", value: round2(load15), min: "0"},
+		},
+	}, nil
+}
+
+// measureCPU lê o /proc/stat no início e no fim de interval e devolve o uso
+// total de CPU no intervalo (tudo menos idle e iowait, como o gráfico da
+// TUI) e o tempo de cada categoria.
+func measureCPU(interval time.Duration) (float64, CPUTimesPercent, error) {
+	before, err := readProcStat()
+	if err != nil {
+		return 0, CPUTimesPercent{}, fmt.Errorf("falha ao ler os tempos de CPU: %v", err)
+	}
+	time.Sleep(interval)
+	after, err := readProcStat()
+	if err != nil {
+		return 0, CPUTimesPercent{}, fmt.Errorf("falha ao ler os tempos de CPU: %v", err)
+	}
+	times := timesPercent(before.total, after.total)
+	if times == (CPUTimesPercent{}) {
+		return 0, times, fmt.Errorf("os tempos de CPU em %s não avançaram", procPath("stat"))
+	}
+	usage := 100 - times.Idle - times.Iowait
+	if usage < 0 {
+		usage = 0
+	}
+	return usage, times, nil
+}
+
+// readLoadAvg lê a carga média de 1, 5 e 15 minutos do /proc/loadavg.
+func readLoadAvg() (float64, float64, float64, error) {
+	data, err := os.ReadFile(procPath("loadavg"))
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 3 {
+		return 0, 0, 0, fmt.Errorf("%s: formato inesperado", procPath("loadavg"))
+	}
+	var avg [3]float64
+	for i := range avg {
+		if avg[i], err = strconv.ParseFloat(fields[i], 64); err != nil {
+			return 0, 0, 0, fmt.Errorf("%s: %v", procPath("loadavg"), err)
+		}
+	}
+	return avg[0], avg[1], avg[2], nil
+}
+
+// checkDisk confere o uso de um ponto de montagem.
+func checkDisk(fs *flag.FlagSet, args []string) (checkResult, error) {
+	var t checkThresholds
+	t.register(fs, 80, 90, "% usado")
+	mount := fs.String("mount", "/", "Ponto de montagem verificado")
+	if err := fs.Parse(args); err != nil {
+		return checkResult{}, errCheckUsage
+	}
+	if err := t.validate(); err != nil {
+		return checkResult{}, err
+	}
+
+	usage, err := disk.Usage(*mount)
+	if err != nil {
+		return checkResult{}, fmt.Errorf("%s: %v", *mount, err)
+	}
+	total := float64(usage.Total)
+	return checkResult{
+		status: t.status(usage.UsedPercent),
+		summary: fmt.Sprintf("%s %.1f%% usado (%s de %s, %s livres)", *mount, usage.UsedPercent,
+			formatBytesNetBox(usage.Used), formatBytesNetBox(usage.Total), formatBytesNetBox(usage.Free)),
+		perf: []perfData{
+			{label: *mount, value: round2(usage.UsedPercent), unit: "%", warn: formatThreshold(t.warn), crit: formatThreshold(t.crit), min: "0", max: "100"},
+			{label: *mount + " used", value: float64(usage.Used), unit: "B",
+				warn: formatThreshold(float64(int64(total * t.warn / 100))), crit: formatThreshold(float64(int64(total * t.crit / 100))),
+				min: "0", max: formatThreshold(total)},
+			{label: *mount + " inodes", value: round2(usage.InodesUsedPercent), unit: "%", min: "0", max: "100"},
+		},
+	}, nil
+}
+
+// checkProc conta os processos com o nome dado. Fora de --min e --max, o
+// estado é CRITICAL, como no check_procs. O uso de CPU é medido durante
+// --interval, e não a média desde o início de cada processo.
+func checkProc(fs *flag.FlagSet, args []string) (checkResult, error) {
+	name := fs.String("name", "", "Nome do processo (o mesmo da coluna de comando da TUI; obrigatório)")
+	min := fs.Int("min", 1, "Mínimo de processos")
+	max := fs.Int("max", -1, "Máximo de processos (padrão: sem limite)")
+	interval := fs.Duration("interval", time.Second, "Duração da medição do uso de CPU dos processos")
+	if err := fs.Parse(args); err != nil {
+		return checkResult{}, errCheckUsage
+	}
+	if *name == "" {
+		return checkResult{}, fmt.Errorf("informe o processo com --name")
+	}
+	if *max >= 0 && *max < *min {
+		return checkResult{}, fmt.Errorf("--max (%d) é menor que --min (%d)", *max, *min)
+	}
+	if *interval <= 0 {
+		return checkResult{}, fmt.Errorf("--interval deve ser maior que zero")
+	}
+
+	procs, err := process.Processes()
+	if err != nil {
+		return checkResult{}, err
+	}
+	var matched []*process.Process
+	before := make(map[int32]float64)
+	for _, p := range procs {
+		if n, err := p.Name(); err != nil || n != *name {
+			continue
+		}
+		matched = append(matched, p)
+		if times, err := p.Times(); err == nil {
+			before[p.Pid] = times.User + times.System
+		}
+	}
+	count := len(matched)
+
+	var cpu, mem float64
+	if count > 0 {
+		time.Sleep(*interval)
+	}
+	for _, p := range matched {
+		// Processos que terminaram durante a medição ficam de fora da soma.
+		times, err := p.Times()
+		if start, ok := before[p.Pid]; ok && err == nil {
+			cpu += (times.User + times.System - start) / interval.Seconds() * 100
+		}
+		m, _ := p.MemoryPercent()
+		mem += float64(m)
+	}
+
+	// Intervalo crítico no formato do Nagios: "min:" ou "min:max".
+	limits := fmt.Sprintf("%d:", *min)
+	expected := fmt.Sprintf("ao menos %d", *min)
+	status := statusOK
+	if count < *min {
+		status = statusCritical
+	}
+	if *max >= 0 {
+		limits += strconv.Itoa(*max)
+		expected = fmt.Sprintf("de %d a %d", *min, *max)
+		if count > *max {
+			status = statusCritical
+		}
+	}
+	return checkResult{
+		status:  status,
+		summary: fmt.Sprintf("%d processo(s) %s (esperado: %s)", count, *name, expected),
+		perf: []perfData{
+			{label: "procs", value: float64(count), crit: limits, min: "0"},
+			{label: "cpu", value: round2(cpu), unit: "%", min: "0"},
+			{label: "mem", value: round2(mem), unit: "%", min: "0", max: "100"},
+		},
+	}, nil
+}
+
+// checkLatency mede o tempo de conexão TCP com o mesmo destino da TUI (ou
+// outro, com --target). Sem conexão, o estado é CRITICAL.
+func checkLatency(fs *flag.FlagSet, args []string) (checkResult, error) {
+	var t checkThresholds
+	t.register(fs, 100, 200, "ms")
+	target := fs.String("target", latencyTarget, "Endereço host:porta medido")
+	timeout := fs.Duration("timeout", 5*time.Second, "Tempo máximo de espera pela conexão")
+	if err := fs.Parse(args); err != nil {
+		return checkResult{}, errCheckUsage
+	}
+	if err := t.validate(); err != nil {
+		return checkResult{}, err
+	}
+
+	rtt, err := measureLatency(*target, *timeout)
+	if err != nil {
+		return checkResult{status: statusCritical, summary: fmt.Sprintf("sem conexão com %s: %v", *target, err)}, nil
+	}
+	ms := float64(rtt.Microseconds()) / 1000
+	return checkResult{
+		status:  t.status(ms),
+		summary: fmt.Sprintf("latência até %s %.1f ms", *target, ms),
+		perf: []perfData{
+			{label: "latency", value: round2(ms), unit: "ms", warn: formatThreshold(t.warn), crit: formatThreshold(t.crit), min: "0"},
+		},
+	}, nil
+}
+
+// round2 arredonda para duas casas, o bastante para os gráficos dos dados
+// de desempenho.
+func round2(v float64) float64 {
+	return float64(int64(v*100+0.5)) / 100
+}
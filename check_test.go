@@ -0,0 +1,200 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckCPU(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want checkStatus
+	}{
+		{"abaixo dos limites", []string{"--interval", "20ms", "--samples", "2", "--warn", "101", "--crit", "102"}, statusOK},
+		{"acima do crítico", []string{"--interval", "20ms", "--warn", "-2", "--crit", "-1"}, statusCritical},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("check cpu", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			result, err := checkCPU(fs, tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.status != tt.want {
+				t.Errorf("status = %v, want %v (%s)", result.status, tt.want, result.summary)
+			}
+			labels := []string{"cpu_usage", "cpu_iowait", "cpu_steal", "load1", "load5", "load15"}
+			if len(result.perf) != len(labels) {
+				t.Fatalf("perf = %+v", result.perf)
+			}
+			for i, p := range result.perf {
+				if p.label != labels[i] || p.value < 0 || (p.unit == "%" && p.value > 100) {
+					t.Errorf("perf[%d] = %+v", i, p)
+				}
+			}
+		})
+	}
+
+	fs := flag.NewFlagSet("check cpu", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if _, err := checkCPU(fs, []string{"--samples", "0"}); err == nil {
+		t.Error("--samples 0 deveria ser recusado")
+	}
+}
+
+// runTestCheck executa uma verificação com as opções dadas.
+func runTestCheck(t *testing.T, check checkFunc, args ...string) checkResult {
+	t.Helper()
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	result, err := check(fs, args)
+	if err != nil {
+		t.Fatalf("%v: %v", args, err)
+	}
+	return result
+}
+
+func TestCheckCPUProcRoot(t *testing.T) {
+	old := procRoot
+	t.Cleanup(func() { procRoot = old })
+	root := t.TempDir()
+	writeSysFile(t, root, "stat", "cpu  100 0 50 1000 10 0 0 0 0 0\nctxt 10")
+	writeSysFile(t, root, "loadavg", "0.50 0.25 0.10 1/100 4242")
+
+	// Os tempos de um /proc/stat parado não avançam: sem medida, sem chute.
+	fs := flag.NewFlagSet("check cpu", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if _, err := checkCPU(fs, []string{"--proc-root", root, "--interval", "1ms"}); err == nil || !strings.Contains(err.Error(), root) {
+		t.Errorf("checkCPU() com /proc/stat parado = %v, want erro citando %s", err, root)
+	}
+	if l1, l5, l15, err := readLoadAvg(); err != nil || l1 != 0.5 || l5 != 0.25 || l15 != 0.1 {
+		t.Errorf("readLoadAvg() = %v %v %v, %v", l1, l5, l15, err)
+	}
+	writeSysFile(t, root, "loadavg", "")
+	if _, _, _, err := readLoadAvg(); err == nil {
+		t.Error("readLoadAvg() de um arquivo vazio deveria falhar")
+	}
+}
+
+func TestCheckDisk(t *testing.T) {
+	result := runTestCheck(t, checkDisk, "--mount", "/", "--warn", "100", "--crit", "100")
+	if result.status != statusOK {
+		t.Errorf("status = %v (%s)", result.status, result.summary)
+	}
+	if len(result.perf) != 3 || result.perf[0].label != "/" || result.perf[1].label != "/ used" || result.perf[2].label != "/ inodes" {
+		t.Fatalf("perf = %+v", result.perf)
+	}
+	if p := result.perf[1]; p.unit != "B" || p.warn != p.max || p.crit != p.max {
+		t.Errorf("perf de bytes com limite de 100%% = %+v", p)
+	}
+
+	if result := runTestCheck(t, checkDisk, "--warn", "-1", "--crit", "0"); result.status != statusCritical {
+		t.Errorf("acima do crítico = %v (%s)", result.status, result.summary)
+	}
+	fs := flag.NewFlagSet("check disk", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if _, err := checkDisk(fs, []string{"--mount", filepath.Join(t.TempDir(), "inexistente")}); err == nil {
+		t.Error("ponto de montagem inexistente deveria ser UNKNOWN")
+	}
+}
+
+func TestCheckProc(t *testing.T) {
+	startSleeper(t)
+	startSleeper(t)
+
+	tests := []struct {
+		name   string
+		args   []string
+		want   checkStatus
+		limits string
+	}{
+		{"ao menos um", []string{"--min", "1"}, statusOK, "1:"},
+		{"abaixo do mínimo", []string{"--min", "1000"}, statusCritical, "1000:"},
+		{"acima do máximo", []string{"--min", "0", "--max", "1"}, statusCritical, "0:1"},
+		{"dentro do intervalo", []string{"--min", "2", "--max", "1000"}, statusOK, "2:1000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"--name", "sleep", "--interval", "10ms"}, tt.args...)
+			result := runTestCheck(t, checkProc, args...)
+			if result.status != tt.want {
+				t.Errorf("status = %v, want %v (%s)", result.status, tt.want, result.summary)
+			}
+			if len(result.perf) != 3 || result.perf[0].crit != tt.limits || result.perf[0].value < 2 {
+				t.Fatalf("perf = %+v", result.perf)
+			}
+			if got, want := result.perf[0].String(), ";;"+tt.limits+";0"; !strings.HasSuffix(got, want) {
+				t.Errorf("perf = %s, want final %s", got, want)
+			}
+			if cpu := result.perf[1]; cpu.label != "cpu" || cpu.value < 0 || cpu.value > 5 {
+				t.Errorf("CPU de processos parados = %+v", cpu)
+			}
+		})
+	}
+
+	fs := flag.NewFlagSet("check proc", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if _, err := checkProc(fs, []string{"--name", "sleep", "--min", "3", "--max", "2"}); err == nil {
+		t.Error("--max menor que --min deveria ser recusado")
+	}
+}
+
+func TestCheckLatency(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	result := runTestCheck(t, checkLatency, "--target", ln.Addr().String(), "--warn", "5000", "--crit", "5000")
+	if result.status != statusOK || len(result.perf) != 1 || result.perf[0].label != "latency" || result.perf[0].crit != "5000" {
+		t.Errorf("listener local = %v %+v (%s)", result.status, result.perf, result.summary)
+	}
+
+	// Uma porta fechada é CRITICAL, não UNKNOWN: o destino não responde.
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := closed.Addr().String()
+	closed.Close()
+	result = runTestCheck(t, checkLatency, "--target", addr, "--timeout", "1s")
+	if result.status != statusCritical || len(result.perf) != 0 || !strings.Contains(result.summary, addr) {
+		t.Errorf("porta fechada = %v %+v (%s)", result.status, result.perf, result.summary)
+	}
+}
+
+func TestPerfDataString(t *testing.T) {
+	tests := []struct {
+		perf perfData
+		want string
+	}{
+		{perfData{label: "cpu_usage", value: 12.5, unit: "%", warn: "80", crit: "95", min: "0", max: "100"}, "cpu_usage=12.5%;80;95;0;100"},
+		{perfData{label: "load1", value: 0.25, min: "0"}, "load1=0.25;;;0"},
+		{perfData{label: "procs", value: 3, crit: "1:"}, "procs=3;;1:"},
+		{perfData{label: "latency", value: 1}, "latency=1"},
+		{perfData{label: "/ used", value: 1024, unit: "B", min: "0", max: "4096"}, "'/ used'=1024B;;;0;4096"},
+		{perfData{label: "it's", value: 1}, "'it''s'=1"},
+		{perfData{label: "a=b", value: 1}, "'a=b'=1"},
+	}
+	for _, tt := range tests {
+		if got := tt.perf.String(); got != tt.want {
+			t.Errorf("String() = %s, want %s", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,328 @@
+// /*********************************************************************************
+// * Projeto:     Batedor
+// * Componente:  Collector - Coleta única dos dados do sistema a cada ciclo
+// *********************************************************************************/
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/host"
+	"github.com/shirou/gopsutil/v3/mem"
+	gopsNet "github.com/shirou/gopsutil/v3/net"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// procRoot e sysRoot são as raízes de /proc e /sys lidas diretamente pelo
+// Batedor (fora do gopsutil).
+var (
+	procRoot = "/proc"
+	sysRoot  = "/sys"
+)
+
+// procPath monta um caminho dentro de procRoot.
+func procPath(elem ...string) string {
+	return filepath.Join(append([]string{procRoot}, elem...)...)
+}
+
+// sysPath monta um caminho dentro de sysRoot.
+func sysPath(elem ...string) string {
+	return filepath.Join(append([]string{sysRoot}, elem...)...)
+}
+
+// Snapshot reúne tudo o que foi coletado em um ciclo de atualização. É a
+// única fonte de dados dos widgets, do dashboard web e do histórico.
+type Snapshot struct {
+	Timestamp   time.Time
+	Cores       []float64
+	CPUUsage    float64 // Média de todos os núcleos.
+	CPU         CPUDetails
+	Mem         *mem.VirtualMemoryStat
+	Swap        *mem.SwapMemoryStat
+	SwapInRate  float64 // Bytes/s.
+	SwapOutRate float64 // Bytes/s.
+	Pressure    PressureInfo
+	Sensors     SensorInfo
+	PowerSupply PowerSupplyInfo
+	Cgroups     []CgroupStat // nil sem cgroup v2.
+	Containers  []Container
+	Pods        []Pod // Apenas em nós Kubernetes.
+	Disk        *disk.UsageStat
+	Host        *host.InfoStat
+	Motherboard string
+	Net         NetInfo
+	Procs       []ProcData
+	Alerts      []Alert // Regras de --alert disparadas nesta coleta.
+}
+
+// MemUsedPercent devolve o uso de memória ou 0 se a coleta falhou.
+func (s *Snapshot) MemUsedPercent() float64 {
+	if s.Mem == nil {
+		return 0
+	}
+	return s.Mem.UsedPercent
+}
+
+// MetricInfo descreve uma série gravável no histórico.
+type MetricInfo struct {
+	Label string
+	Unit  string // "%", "B", "B/s" ou "" (valor puro).
+}
+
+// metricInfos traz rótulo e unidade das séries conhecidas. Séries fora da
+// lista continuam sendo gravadas e exibidas, só que com o nome cru.
+var metricInfos = map[string]MetricInfo{
+	"cpu_usage":      {"CPU", "%"},
+	"mem_usage":      {"Memória", "%"},
+	"mem_available":  {"Memória disponível", "B"},
+	"mem_buffers":    {"Buffers", "B"},
+	"mem_cached":     {"Cache", "B"},
+	"mem_shared":     {"Memória compartilhada", "B"},
+	"mem_slab":       {"Slab", "B"},
+	"swap_usage":     {"Swap", "%"},
+	"swap_in_rate":   {"Entrada de swap", "B/s"},
+	"swap_out_rate":  {"Saída de swap", "B/s"},
+	"hugepages_used": {"Huge pages em uso", ""},
+	"load1":          {"Carga média (1 min)", ""},
+	"load5":          {"Carga média (5 min)", ""},
+	"load15":         {"Carga média (15 min)", ""},
+	"cpu_iowait":     {"CPU em iowait", "%"},
+	"cpu_steal":      {"CPU em steal", "%"},
+	"ctxt_rate":      {"Trocas de contexto/s", ""},
+	"intr_rate":      {"Interrupções/s", ""},
+	"disk_usage":     {"Disco (/)", "%"},
+	"net_down_rate":  {"Download", "B/s"},
+	"net_up_rate":    {"Upload", "B/s"},
+	"net_latency":    {"Latência (ms)", ""},
+	"temp_max":       {"Maior temperatura", "°C"},
+}
+
+// metricUnitPrefixes dá a unidade de séries criadas dinamicamente (uma por sensor).
+var metricUnitPrefixes = map[string]string{
+	"temp_":  "°C",
+	"fan_":   "RPM",
+	"power_": "W",
+}
+
+// metricInfo devolve rótulo e unidade de uma série.
+func metricInfo(name string) MetricInfo {
+	if info, ok := metricInfos[name]; ok {
+		return info
+	}
+	for prefix, unit := range metricUnitPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return MetricInfo{Label: name, Unit: unit}
+		}
+	}
+	return MetricInfo{Label: name}
+}
+
+// formatMetricValue formata um valor conforme a unidade da série.
+func formatMetricValue(v float64, unit string) string {
+	switch unit {
+	case "%":
+		return fmt.Sprintf("%.1f%%", v)
+	case "B":
+		return formatBytesNetBox(uint64(v))
+	case "B/s":
+		return formatBytes(uint64(v))
+	case "°C", "RPM", "W":
+		return fmt.Sprintf("%.1f %s", v, unit)
+	}
+	return fmt.Sprintf("%.1f", v)
+}
+
+// Metrics devolve as séries numéricas do snapshot, pelo nome usado no
+// histórico.
+func (s *Snapshot) Metrics() map[string]float64 {
+	m := map[string]float64{
+		"cpu_usage":     s.CPUUsage,
+		"mem_usage":     s.MemUsedPercent(),
+		"load1":         s.CPU.Load1,
+		"load5":         s.CPU.Load5,
+		"load15":        s.CPU.Load15,
+		"cpu_iowait":    s.CPU.Total.Iowait,
+		"cpu_steal":     s.CPU.Total.Steal,
+		"ctxt_rate":     s.CPU.CtxSwitchesPerSec,
+		"intr_rate":     s.CPU.InterruptsPerSec,
+		"net_down_rate": float64(s.Net.DownloadRate),
+		"net_up_rate":   float64(s.Net.UploadRate),
+	}
+	if s.Net.Latency >= 0 {
+		m["net_latency"] = float64(s.Net.Latency)
+	}
+	if s.Disk != nil {
+		m["disk_usage"] = s.Disk.UsedPercent
+	}
+	if v := s.Mem; v != nil {
+		m["mem_available"] = float64(v.Available)
+		m["mem_buffers"] = float64(v.Buffers)
+		m["mem_cached"] = float64(v.Cached)
+		m["mem_shared"] = float64(v.Shared)
+		m["mem_slab"] = float64(v.Slab)
+		m["hugepages_used"] = float64(v.HugePagesTotal - v.HugePagesFree)
+	}
+	if s.Swap != nil {
+		m["swap_usage"] = s.Swap.UsedPercent
+		m["swap_in_rate"] = s.SwapInRate
+		m["swap_out_rate"] = s.SwapOutRate
+	}
+	s.Pressure.psiMetrics(m)
+	s.Sensors.sensorMetrics(m)
+	s.PowerSupply.batteryMetrics(m)
+	return m
+}
+
+// Collector guarda o estado entre coletas (contadores de rede, tempos de
+// CPU) necessário para transformar contadores acumulados em taxas.
+type Collector struct {
+	mu                   sync.RWMutex
+	netBytesSentStart    uint64
+	netBytesRecvStart    uint64
+	lastNetBytesSent     uint64
+	lastNetBytesRecv     uint64
+	lastNetCheck         time.Time
+	motherboardInfo      string
+	publicIP             string
+	latency              int64
+	lastGlobalNetCheck   time.Time
+	primaryInterfaceName string
+	primaryInterfaceIP   string
+	cpuStat              cpuStatSampler
+	sensors              sensorSampler
+	cgroups              cgroupSampler
+	containers           containerSampler
+	kube                 kubeSampler
+	alerts               *AlertManager
+	lastSwapIn           uint64
+	lastSwapOut          uint64
+	lastSwapCheck        time.Time
+}
+
+// NewCollector cria um coletor com os contadores de rede zerados no
+// instante atual e dispara a consulta de IP público/latência.
+func NewCollector() *Collector {
+	initialNetCounters, _ := gopsNet.IOCounters(false)
+	var sentStart, recvStart uint64
+	if len(initialNetCounters) > 0 {
+		sentStart, recvStart = initialNetCounters[0].BytesSent, initialNetCounters[0].BytesRecv
+	}
+	ifaceName, ifaceIP := getPrimaryInterfaceInfo()
+
+	c := &Collector{
+		netBytesSentStart:    sentStart,
+		netBytesRecvStart:    recvStart,
+		lastNetBytesSent:     sentStart,
+		lastNetBytesRecv:     recvStart,
+		lastNetCheck:         time.Now(),
+		motherboardInfo:      getMotherboardInfo(),
+		lastGlobalNetCheck:   time.Now(),
+		primaryInterfaceName: ifaceName,
+		primaryInterfaceIP:   ifaceIP,
+		alerts:               NewAlertManager(alertRules),
+	}
+	go c.refreshGlobalNet()
+	return c
+}
+
+// refreshGlobalNet atualiza IP público e latência (chamadas lentas, feitas
+// fora do ciclo de coleta).
+func (c *Collector) refreshGlobalNet() {
+	ip := getPublicIP()
+	lat := getLatency()
+	c.mu.Lock()
+	c.publicIP = ip
+	c.latency = lat
+	c.mu.Unlock()
+}
+
+// Collect lê todos os dados do sistema e devolve um novo Snapshot.
+func (c *Collector) Collect() *Snapshot {
+	allCores, _ := cpu.Percent(0, true)
+	memInfo, _ := mem.VirtualMemory()
+	swapInfo, _ := mem.SwapMemory()
+	diskInfo, _ := disk.Usage("/")
+	hostInfo, _ := host.Info()
+	netCounters, _ := gopsNet.IOCounters(false)
+	procs, _ := process.Processes()
+
+	now := time.Now()
+	snap := &Snapshot{
+		Timestamp:   now,
+		Cores:       allCores,
+		Mem:         memInfo,
+		Swap:        swapInfo,
+		Pressure:    readPressure(),
+		Disk:        diskInfo,
+		Host:        hostInfo,
+		Motherboard: c.motherboardInfo,
+		Procs:       collectProcData(procs),
+		CPU:         c.cpuStat.sample(now),
+		Sensors:     c.sensors.sample(now),
+		PowerSupply: readPowerSupply(),
+		Cgroups:     c.cgroups.sample(now),
+	}
+	snap.Containers = c.containers.sample(now, snap.Cgroups)
+	snap.Pods = c.kube.sample(now, snap.Cgroups, snap.Containers)
+	labelContainerProcs(snap.Procs, snap.Containers)
+
+	var totalCPU float64
+	for _, core := range allCores {
+		totalCPU += core
+	}
+	if len(allCores) > 0 {
+		snap.CPUUsage = totalCPU / float64(len(allCores))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	duration := now.Sub(c.lastNetCheck).Seconds()
+	var recvRate, sentRate uint64
+	if duration > 0.1 && len(netCounters) > 0 {
+		currentNet := netCounters[0]
+		recvRate = uint64(float64(currentNet.BytesRecv-c.lastNetBytesRecv) / duration)
+		sentRate = uint64(float64(currentNet.BytesSent-c.lastNetBytesSent) / duration)
+		c.lastNetBytesRecv = currentNet.BytesRecv
+		c.lastNetBytesSent = currentNet.BytesSent
+	}
+	c.lastNetCheck = now
+
+	if swapInfo != nil {
+		elapsed := now.Sub(c.lastSwapCheck).Seconds()
+		if !c.lastSwapCheck.IsZero() && elapsed > 0 && swapInfo.Sin >= c.lastSwapIn && swapInfo.Sout >= c.lastSwapOut {
+			snap.SwapInRate = float64(swapInfo.Sin-c.lastSwapIn) / elapsed
+			snap.SwapOutRate = float64(swapInfo.Sout-c.lastSwapOut) / elapsed
+		}
+		c.lastSwapIn, c.lastSwapOut, c.lastSwapCheck = swapInfo.Sin, swapInfo.Sout, now
+	}
+
+	if time.Since(c.lastGlobalNetCheck) > 30*time.Second {
+		go c.refreshGlobalNet()
+		c.lastGlobalNetCheck = now
+	}
+
+	snap.Net = NetInfo{
+		DownloadRate:    recvRate,
+		UploadRate:      sentRate,
+		DownloadSession: c.lastNetBytesRecv - c.netBytesRecvStart,
+		UploadSession:   c.lastNetBytesSent - c.netBytesSentStart,
+		PublicIP:        c.publicIP,
+		Latency:         c.latency,
+		InterfaceName:   c.primaryInterfaceName,
+		LocalIP:         c.primaryInterfaceIP,
+	}
+	snap.Alerts = c.alerts.Evaluate(snap.Metrics(), now)
+	return snap
+}
+
+// AlertRules devolve as regras avaliadas por este coletor.
+func (c *Collector) AlertRules() []AlertRule {
+	return c.alerts.Rules()
+}
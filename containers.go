@@ -0,0 +1,567 @@
+// /*********************************************************************************
+// * Projeto:     Batedor
+// * Componente:  ContainerView - Contêineres Docker/Podman/containerd via cgroups
+// *********************************************************************************/
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// dockerSocket é o socket da API do Docker (ou do serviço compatível do
+// Podman), passado com --docker-socket. Vazio desativa a consulta: os
+// contêineres continuam sendo detectados pelos cgroups, só que sem nome e imagem.
+var dockerSocket string
+
+// containerScopePattern reconhece os escopos criados pelo systemd para cada
+// runtime (ex.: "docker-<id>.scope", "cri-containerd-<id>.scope").
+var containerScopePattern = regexp.MustCompile(`^(docker|libpod|cri-containerd|crio)-([0-9a-f]{64})\.scope$`)
+
+// containerIDPattern reconhece o ID puro usado pelo driver cgroupfs
+// (ex.: "/docker/<id>").
+var containerIDPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// containerRuntimes traduz o prefixo do cgroup para o nome do runtime.
+var containerRuntimes = map[string]string{
+	"docker":         "docker",
+	"libpod":         "podman",
+	"cri-containerd": "containerd",
+	"crio":           "cri-o",
+}
+
+// containerFromCgroup identifica o contêiner dono de um caminho de cgroup.
+// Devolve o caminho do cgroup do contêiner (que pode ser um ancestral do
+// caminho dado), o runtime e o ID completo.
+func containerFromCgroup(cgroupPath string) (containerPath, runtime, id string, ok bool) {
+	parts := strings.Split(cgroupPath, "/")
+	for i := len(parts) - 1; i > 0; i-- {
+		if m := containerScopePattern.FindStringSubmatch(parts[i]); m != nil {
+			return strings.Join(parts[:i+1], "/"), containerRuntimes[m[1]], m[2], true
+		}
+		if containerIDPattern.MatchString(parts[i]) {
+			runtime = parts[i-1]
+			if r, known := containerRuntimes[runtime]; known {
+				runtime = r
+			} else if runtime == "" || strings.HasPrefix(runtime, "kubepods") || strings.HasPrefix(runtime, "pod") {
+				runtime = "container"
+			}
+			return strings.Join(parts[:i+1], "/"), runtime, parts[i], true
+		}
+	}
+	return "", "", "", false
+}
+
+// procCgroup devolve o cgroup de um processo. Usa a linha do cgroup v2
+// ("0::/caminho") e, em sistemas só com v1, a primeira linha que aponte
+// para um contêiner.
+func procCgroup(pid int32) string {
+	f, err := os.Open(procPath(strconv.Itoa(int(pid)), "cgroup"))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	var v2, v1 string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		if fields[0] == "0" && fields[1] == "" {
+			v2 = fields[2]
+		} else if _, _, _, ok := containerFromCgroup(fields[2]); ok && v1 == "" {
+			v1 = fields[2]
+		}
+	}
+	if _, _, _, ok := containerFromCgroup(v2); ok || v1 == "" {
+		return v2
+	}
+	return v1
+}
+
+// Container é o uso de recursos de um contêiner.
+type Container struct {
+	ID          string
+	Runtime     string
+	Name        string // Nome no Kubernetes ou na API do Docker; vazio se desconhecido.
+	Image       string
+	CgroupPath  string
+	CPU         float64 // % de um núcleo.
+	MemCurrent  uint64
+	MemMax      uint64 // 0 sem limite.
+	IOReadRate  float64
+	IOWriteRate float64
+	NetRxRate   float64 // Bytes/s recebidos no namespace de rede do contêiner.
+	NetTxRate   float64
+	HostNet     bool // Contêiner usa a rede do host (--network host).
+	PIDs        uint64
+	PodUID      string // Preenchidos apenas em nós Kubernetes.
+	Pod         string
+	Namespace   string
+}
+
+// ShortID devolve os 12 primeiros caracteres do ID, como o docker ps.
+func (c Container) ShortID() string {
+	if len(c.ID) > 12 {
+		return c.ID[:12]
+	}
+	return c.ID
+}
+
+// Label é o nome exibido: o nome do contêiner ou, sem ele, o ID curto.
+func (c Container) Label() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return c.ShortID()
+}
+
+// PodLabel devolve "namespace/pod", o UID do pod quando os nomes são
+// desconhecidos, ou "" fora do Kubernetes.
+func (c Container) PodLabel() string {
+	if c.Pod != "" {
+		return c.Namespace + "/" + c.Pod
+	}
+	if c.PodUID != "" {
+		return "pod " + c.PodUID
+	}
+	return ""
+}
+
+// dockerContainer é o subconjunto usado da resposta de GET /containers/json.
+type dockerContainer struct {
+	ID    string   `json:"Id"`
+	Names []string `json:"Names"`
+	Image string   `json:"Image"`
+}
+
+// dockerClients guarda um cliente HTTP por socket, reaproveitado entre as
+// consultas de refreshMeta para manter a conexão aberta.
+var (
+	dockerClientsMu sync.Mutex
+	dockerClients   = make(map[string]*http.Client)
+)
+
+// dockerClient devolve o cliente do socket, criando-o na primeira consulta.
+func dockerClient(socket string) *http.Client {
+	dockerClientsMu.Lock()
+	defer dockerClientsMu.Unlock()
+	if client, ok := dockerClients[socket]; ok {
+		return client
+	}
+	client := &http.Client{
+		Timeout: 3 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+	dockerClients[socket] = client
+	return client
+}
+
+// listDockerContainers consulta a API do Docker pelo socket Unix.
+func listDockerContainers(socket string) ([]dockerContainer, error) {
+	client := dockerClient(socket)
+	resp, err := client.Get("http://docker/containers/json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API do Docker respondeu %s", resp.Status)
+	}
+	var list []dockerContainer
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// readNetDev soma os bytes recebidos e enviados em /proc/<pid>/net/dev,
+// ignorando a interface de loopback.
+func readNetDev(pid int32) (rx, tx uint64, ok bool) {
+	f, err := os.Open(procPath(strconv.Itoa(int(pid)), "net", "dev"))
+	if err != nil {
+		return 0, 0, false
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// "  eth0: rx_bytes rx_packets ... (8 campos) tx_bytes ..."
+		iface, data, found := strings.Cut(scanner.Text(), ":")
+		if !found || strings.TrimSpace(iface) == "lo" {
+			continue
+		}
+		fields := strings.Fields(data)
+		if len(fields) < 9 {
+			continue
+		}
+		r, _ := strconv.ParseUint(fields[0], 10, 64)
+		t, _ := strconv.ParseUint(fields[8], 10, 64)
+		rx += r
+		tx += t
+	}
+	return rx, tx, true
+}
+
+// sameNetNamespace indica se o processo está no namespace de rede do init.
+func sameNetNamespace(pid int32) bool {
+	own, err := os.Readlink(procPath(strconv.Itoa(int(pid)), "ns", "net"))
+	if err != nil {
+		return false
+	}
+	host, err := os.Readlink(procPath("1", "ns", "net"))
+	return err == nil && own == host
+}
+
+// containerSampler monta a lista de contêineres a partir dos cgroups,
+// calcula as taxas de rede e mantém um cache dos nomes vindos da API.
+type containerSampler struct {
+	mu            sync.RWMutex
+	meta          map[string]dockerContainer // Por ID completo.
+	lastMetaCheck time.Time
+	lastNet       map[string][2]uint64
+	lastCheck     time.Time
+}
+
+// refreshMeta atualiza o cache de nomes e imagens (chamada lenta, feita
+// fora do ciclo de coleta).
+func (s *containerSampler) refreshMeta() {
+	list, err := listDockerContainers(dockerSocket)
+	if err != nil {
+		log.Printf("Falha ao consultar a API do Docker em %s: %v", dockerSocket, err)
+		return
+	}
+	meta := make(map[string]dockerContainer, len(list))
+	for _, c := range list {
+		meta[c.ID] = c
+	}
+	s.mu.Lock()
+	s.meta = meta
+	s.mu.Unlock()
+}
+
+// sample devolve os contêineres encontrados entre os cgroups.
+func (s *containerSampler) sample(now time.Time, cgroups []CgroupStat) []Container {
+	if dockerSocket != "" && now.Sub(s.lastMetaCheck) > 10*time.Second {
+		s.lastMetaCheck = now
+		go s.refreshMeta()
+	}
+	s.mu.RLock()
+	meta := s.meta
+	s.mu.RUnlock()
+
+	elapsed := now.Sub(s.lastCheck).Seconds()
+	currentNet := make(map[string][2]uint64)
+	var containers []Container
+	for _, cg := range cgroups {
+		containerPath, runtime, id, ok := containerFromCgroup(cg.Path)
+		if !ok || containerPath != cg.Path {
+			continue
+		}
+		c := Container{
+			ID:          id,
+			Runtime:     runtime,
+			CgroupPath:  cg.Path,
+			CPU:         cg.CPU,
+			MemCurrent:  cg.MemCurrent,
+			MemMax:      cg.MemMax,
+			IOReadRate:  cg.IOReadRate,
+			IOWriteRate: cg.IOWriteRate,
+			PIDs:        cg.PIDs,
+		}
+		if m, ok := meta[id]; ok {
+			if len(m.Names) > 0 {
+				c.Name = strings.TrimPrefix(m.Names[0], "/")
+			}
+			c.Image = m.Image
+		}
+
+		// A rede é lida pelo namespace de qualquer processo do contêiner.
+		if pid, ok := firstMember(cgroups, cg); ok {
+			if sameNetNamespace(pid) {
+				c.HostNet = true
+			} else if rx, tx, ok := readNetDev(pid); ok {
+				currentNet[id] = [2]uint64{rx, tx}
+				if prev, ok := s.lastNet[id]; ok {
+					c.NetRxRate = counterRate(rx, prev[0], elapsed)
+					c.NetTxRate = counterRate(tx, prev[1], elapsed)
+				}
+			}
+		}
+		containers = append(containers, c)
+	}
+	s.lastNet = currentNet
+	s.lastCheck = now
+	return containers
+}
+
+// labelContainerProcs preenche as colunas de contêiner e de pod dos processos.
+func labelContainerProcs(procs []ProcData, containers []Container) {
+	byID := make(map[string]Container, len(containers))
+	for _, c := range containers {
+		byID[c.ID] = c
+	}
+	for i := range procs {
+		_, _, id, ok := containerFromCgroup(procCgroup(procs[i].PID))
+		if !ok {
+			continue
+		}
+		c, found := byID[id]
+		if !found {
+			c = Container{ID: id}
+		}
+		procs[i].Container = c.Label()
+		procs[i].Pod = c.PodLabel()
+	}
+}
+
+// firstMember devolve um processo qualquer do cgroup ou de seus filhos.
+func firstMember(cgroups []CgroupStat, cg CgroupStat) (int32, bool) {
+	for _, st := range cgroups {
+		if cg.IsAncestorOf(st.Path) && len(st.Procs) > 0 {
+			return st.Procs[0], true
+		}
+	}
+	return 0, false
+}
+
+// filterAndSortContainers aplica o filtro (nome, ID ou imagem) e a ordenação.
+func filterAndSortContainers(containers []Container, filter, sortBy string) []Container {
+	filter = strings.ToLower(filter)
+	list := make([]Container, 0, len(containers))
+	for _, c := range containers {
+		text := strings.ToLower(c.Name + " " + c.ID + " " + c.Image + " " + c.PodLabel())
+		if filter != "" && !strings.Contains(text, filter) {
+			continue
+		}
+		list = append(list, c)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		switch sortBy {
+		case "mem":
+			return list[i].MemCurrent > list[j].MemCurrent
+		case "io":
+			return list[i].IOReadRate+list[i].IOWriteRate > list[j].IOReadRate+list[j].IOWriteRate
+		case "net":
+			return list[i].NetRxRate+list[i].NetTxRate > list[j].NetRxRate+list[j].NetTxRate
+		case "name":
+			return list[i].Label() < list[j].Label()
+		default:
+			return list[i].CPU > list[j].CPU
+		}
+	})
+	return list
+}
+
+// containerSortLabels são os nomes exibidos para cada ordenação.
+var containerSortLabels = map[string]string{
+	"cpu":  "CPU",
+	"mem":  "Memória",
+	"io":   "E/S",
+	"net":  "Rede",
+	"name": "Nome",
+}
+
+// ContainerView é a tela de contêineres: um filtro e uma tabela que lista
+// os contêineres ou, após Enter, os processos do contêiner escolhido.
+type ContainerView struct {
+	*tview.Flex
+	filter     *tview.InputField
+	table      *tview.Table
+	mu         sync.RWMutex
+	containers []Container
+	cgroups    []CgroupStat
+	procs      []ProcData
+	sortBy     string
+	selected   string // ID do contêiner aberto; "" mostra a lista.
+}
+
+// NewContainerView cria a tela de contêineres.
+func NewContainerView() *ContainerView {
+	v := &ContainerView{
+		filter: tview.NewInputField().SetLabel("Filtrar contêineres (nome, ID, imagem, pod): ").SetLabelColor(tcell.ColorYellow),
+		table:  tview.NewTable().SetSelectable(true, false).SetFixed(1, 0),
+		sortBy: "cpu",
+	}
+	v.table.SetBorder(true)
+	v.filter.SetChangedFunc(func(text string) {
+		v.refresh()
+	})
+	v.Flex = tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(v.filter, 1, 0, false).
+		AddItem(v.table, 0, 1, true)
+	v.refresh()
+	return v
+}
+
+// Update atualiza os contêineres exibidos.
+func (v *ContainerView) Update(containers []Container, cgroups []CgroupStat, procs []ProcData) {
+	v.mu.Lock()
+	v.containers = containers
+	v.cgroups = cgroups
+	v.procs = procs
+	v.mu.Unlock()
+	v.refresh()
+}
+
+// Filter devolve o campo de filtro, para que a aplicação possa focá-lo.
+func (v *ContainerView) Filter() *tview.InputField {
+	return v.filter
+}
+
+// FilterFocused indica se o campo de filtro está recebendo as teclas.
+func (v *ContainerView) FilterFocused() bool {
+	return v.filter.HasFocus()
+}
+
+// HandleKey trata as teclas da tabela: C/M/I/R/N ordenam, Enter abre o
+// contêiner selecionado e Esc volta para a lista. Devolve nil se a tecla
+// foi consumida.
+func (v *ContainerView) HandleKey(event *tcell.EventKey) *tcell.EventKey {
+	switch event.Key() {
+	case tcell.KeyEnter:
+		row, _ := v.table.GetSelection()
+		if id, ok := v.table.GetCell(row, 0).GetReference().(string); ok && row > 0 {
+			v.mu.Lock()
+			v.selected = id
+			v.mu.Unlock()
+			v.table.Select(1, 0)
+			v.refresh()
+		}
+		return nil
+	case tcell.KeyEscape:
+		v.mu.Lock()
+		v.selected = ""
+		v.mu.Unlock()
+		v.table.Select(1, 0)
+		v.refresh()
+		return nil
+	}
+	sortBy := ""
+	switch event.Rune() {
+	case 'c', 'C':
+		sortBy = "cpu"
+	case 'm', 'M':
+		sortBy = "mem"
+	case 'i', 'I':
+		sortBy = "io"
+	case 'r', 'R':
+		sortBy = "net"
+	case 'n', 'N':
+		sortBy = "name"
+	default:
+		return event
+	}
+	v.mu.Lock()
+	v.sortBy = sortBy
+	v.mu.Unlock()
+	v.refresh()
+	return nil
+}
+
+// refresh redesenha a tabela com os dados atuais.
+func (v *ContainerView) refresh() {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	if v.selected != "" {
+		v.drawMembers()
+		return
+	}
+
+	v.table.SetTitle(tview.Escape(fmt.Sprintf(" Contêineres (ordenando por %s) | [/] Filtrar | [C]PU [M]em [I]/O [R]ede [N]ome | [Enter] Processos | [Q] Voltar ",
+		containerSortLabels[v.sortBy])))
+	v.table.Clear()
+	if len(v.containers) == 0 {
+		v.table.SetCell(0, 0, tview.NewTableCell("Nenhum contêiner encontrado nos cgroups (docker, podman, containerd, cri-o).").SetSelectable(false))
+		return
+	}
+
+	headers := []string{"Contêiner", "Pod", "ID", "Runtime", "Imagem", "CPU%", "Memória", "Limite", "Rede ↓/s", "Rede ↑/s", "Leitura/s", "Escrita/s", "PIDs"}
+	for i, header := range headers {
+		v.table.SetCell(0, i, tview.NewTableCell(header).SetTextColor(tcell.ColorYellow).SetSelectable(false))
+	}
+	for i, c := range filterAndSortContainers(v.containers, v.filter.GetText(), v.sortBy) {
+		row := i + 1
+		limit := "-"
+		if c.MemMax > 0 {
+			limit = formatBytesNetBox(c.MemMax)
+		}
+		rx, tx := formatBytes(uint64(c.NetRxRate)), formatBytes(uint64(c.NetTxRate))
+		if c.HostNet {
+			rx, tx = "host", "host"
+		}
+		v.table.SetCell(row, 0, tview.NewTableCell(c.Label()).SetTextColor(tcell.ColorWhite).SetReference(c.ID).SetExpansion(1))
+		v.table.SetCell(row, 1, tview.NewTableCell(c.PodLabel()).SetTextColor(tcell.ColorGreen))
+		v.table.SetCell(row, 2, tview.NewTableCell(c.ShortID()).SetTextColor(tcell.ColorBlue))
+		v.table.SetCell(row, 3, tview.NewTableCell(c.Runtime).SetTextColor(tcell.ColorBlue))
+		v.table.SetCell(row, 4, tview.NewTableCell(c.Image).SetTextColor(tcell.ColorWhite).SetMaxWidth(30))
+		v.table.SetCell(row, 5, tview.NewTableCell(fmt.Sprintf("%.2f", c.CPU)).SetTextColor(tcell.ColorGreen).SetAlign(tview.AlignRight))
+		v.table.SetCell(row, 6, tview.NewTableCell(formatBytesNetBox(c.MemCurrent)).SetTextColor(tcell.ColorGreen).SetAlign(tview.AlignRight))
+		v.table.SetCell(row, 7, tview.NewTableCell(limit).SetTextColor(tcell.ColorBlue).SetAlign(tview.AlignRight))
+		v.table.SetCell(row, 8, tview.NewTableCell(rx).SetTextColor(tcell.ColorWhite).SetAlign(tview.AlignRight))
+		v.table.SetCell(row, 9, tview.NewTableCell(tx).SetTextColor(tcell.ColorWhite).SetAlign(tview.AlignRight))
+		v.table.SetCell(row, 10, tview.NewTableCell(formatBytes(uint64(c.IOReadRate))).SetTextColor(tcell.ColorWhite).SetAlign(tview.AlignRight))
+		v.table.SetCell(row, 11, tview.NewTableCell(formatBytes(uint64(c.IOWriteRate))).SetTextColor(tcell.ColorWhite).SetAlign(tview.AlignRight))
+		v.table.SetCell(row, 12, tview.NewTableCell(strconv.FormatUint(c.PIDs, 10)).SetTextColor(tcell.ColorWhite).SetAlign(tview.AlignRight))
+	}
+}
+
+// drawMembers lista os processos do contêiner aberto.
+func (v *ContainerView) drawMembers() {
+	v.table.Clear()
+	var cont *Container
+	for i := range v.containers {
+		if v.containers[i].ID == v.selected {
+			cont = &v.containers[i]
+			break
+		}
+	}
+	if cont == nil {
+		v.table.SetTitle(tview.Escape(" Contêiner | [Esc] Voltar aos contêineres | [Q] Voltar "))
+		v.table.SetCell(0, 0, tview.NewTableCell("O contêiner não existe mais.").SetSelectable(false))
+		return
+	}
+	v.table.SetTitle(tview.Escape(fmt.Sprintf(" Processos de %s (%s) | [Esc] Voltar aos contêineres | [Q] Voltar ", cont.Label(), path.Base(cont.CgroupPath))))
+
+	sortBy := v.sortBy
+	if sortBy != "mem" && sortBy != "cpu" {
+		sortBy = "pid"
+	}
+	members := filterAndSortProcs(cgroupMembers(v.cgroups, v.procs, CgroupStat{Path: cont.CgroupPath}), "", sortBy)
+
+	headers := []string{"PID", "Usuário", "CPU%", "MEM%", "Comando"}
+	for i, header := range headers {
+		v.table.SetCell(0, i, tview.NewTableCell(header).SetTextColor(tcell.ColorYellow).SetSelectable(false))
+	}
+	for i, p := range members {
+		row := i + 1
+		v.table.SetCell(row, 0, tview.NewTableCell(strconv.Itoa(int(p.PID))).SetTextColor(tcell.ColorWhite))
+		v.table.SetCell(row, 1, tview.NewTableCell(p.User).SetTextColor(tcell.ColorBlue))
+		v.table.SetCell(row, 2, tview.NewTableCell(fmt.Sprintf("%.2f", p.CPU)).SetTextColor(tcell.ColorGreen))
+		v.table.SetCell(row, 3, tview.NewTableCell(fmt.Sprintf("%.2f", p.Mem)).SetTextColor(tcell.ColorGreen))
+		v.table.SetCell(row, 4, tview.NewTableCell(p.Command).SetTextColor(tcell.ColorWhite).SetExpansion(1))
+	}
+}
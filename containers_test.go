@@ -0,0 +1,138 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeDockerSocket serve handler em um socket Unix temporário e conta as
+// conexões abertas pelos clientes.
+func fakeDockerSocket(t *testing.T, handler http.HandlerFunc) (socket string, conns *atomic.Int32) {
+	t.Helper()
+	socket = filepath.Join(t.TempDir(), "docker.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conns = new(atomic.Int32)
+	srv := httptest.NewUnstartedServer(handler)
+	srv.Listener.Close()
+	srv.Listener = l
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	srv.Start()
+	t.Cleanup(func() {
+		srv.Close()
+		dockerClientsMu.Lock()
+		delete(dockerClients, socket)
+		dockerClientsMu.Unlock()
+	})
+	return socket, conns
+}
+
+func TestListDockerContainers(t *testing.T) {
+	socket, conns := fakeDockerSocket(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/containers/json" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"Id":"abc123","Names":["/web"],"Image":"nginx:1.27","State":"running"},{"Id":"def456","Names":[],"Image":"redis"}]`))
+	})
+
+	want := []dockerContainer{
+		{ID: "abc123", Names: []string{"/web"}, Image: "nginx:1.27"},
+		{ID: "def456", Names: []string{}, Image: "redis"},
+	}
+	for i := 0; i < 3; i++ {
+		got, err := listDockerContainers(socket)
+		if err != nil {
+			t.Fatalf("listDockerContainers() erro: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("listDockerContainers() = %+v, want %+v", got, want)
+		}
+	}
+	// As consultas periódicas reaproveitam a mesma conexão.
+	if n := conns.Load(); n != 1 {
+		t.Errorf("%d conexões abertas para 3 consultas, want 1", n)
+	}
+}
+
+func TestListDockerContainersErrors(t *testing.T) {
+	socket, _ := fakeDockerSocket(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/containers/json":
+			w.Write([]byte(`{"message":"não é uma lista"}`))
+		}
+	})
+	if _, err := listDockerContainers(socket); err == nil {
+		t.Error("resposta que não é uma lista deveria falhar")
+	}
+
+	errSocket, _ := fakeDockerSocket(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "permission denied", http.StatusForbidden)
+	})
+	if _, err := listDockerContainers(errSocket); err == nil {
+		t.Error("status 403 deveria falhar")
+	}
+
+	if _, err := listDockerContainers(filepath.Join(t.TempDir(), "ausente.sock")); err == nil {
+		t.Error("socket inexistente deveria falhar")
+	}
+}
+
+func TestContainerFromCgroup(t *testing.T) {
+	const id = "4d5a3c6b2e1f0a9b8c7d6e5f4a3b2c1d0e9f8a7b6c5d4e3f2a1b0c9d8e7f6a5b"
+	tests := []struct {
+		name          string
+		path          string
+		containerPath string
+		runtime       string
+	}{
+		{"docker systemd", "/system.slice/docker-" + id + ".scope", "/system.slice/docker-" + id + ".scope", "docker"},
+		{"docker cgroupfs", "/docker/" + id, "/docker/" + id, "docker"},
+		{"podman", "/machine.slice/libpod-" + id + ".scope", "/machine.slice/libpod-" + id + ".scope", "podman"},
+		{"podman rootless", "/user.slice/user-1000.slice/user@1000.service/user.slice/libpod-" + id + ".scope",
+			"/user.slice/user-1000.slice/user@1000.service/user.slice/libpod-" + id + ".scope", "podman"},
+		{"containerd", "/kubepods.slice/kubepods-pod0f6c3a5e_8d2b_4c1e_9a7f_123456789abc.slice/cri-containerd-" + id + ".scope",
+			"/kubepods.slice/kubepods-pod0f6c3a5e_8d2b_4c1e_9a7f_123456789abc.slice/cri-containerd-" + id + ".scope", "containerd"},
+		{"cri-o", "/kubepods.slice/kubepods-besteffort.slice/crio-" + id + ".scope",
+			"/kubepods.slice/kubepods-besteffort.slice/crio-" + id + ".scope", "cri-o"},
+		{"kubepods cgroupfs", "/kubepods/burstable/pod0f6c3a5e-8d2b-4c1e-9a7f-123456789abc/" + id,
+			"/kubepods/burstable/pod0f6c3a5e-8d2b-4c1e-9a7f-123456789abc/" + id, "container"},
+		{"runtime desconhecido", "/lxc/" + id, "/lxc/" + id, "lxc"},
+		// Processos em cgroups aninhados pertencem ao contêiner ancestral.
+		{"aninhado em .scope", "/system.slice/docker-" + id + ".scope/init.scope", "/system.slice/docker-" + id + ".scope", "docker"},
+		{"aninhado em cgroupfs", "/docker/" + id + "/app/worker", "/docker/" + id, "docker"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			containerPath, runtime, gotID, ok := containerFromCgroup(tt.path)
+			if !ok || containerPath != tt.containerPath || runtime != tt.runtime || gotID != id {
+				t.Errorf("containerFromCgroup() = %q, %q, %q, %v; want %q, %q, %q", containerPath, runtime, gotID, ok, tt.containerPath, tt.runtime, id)
+			}
+		})
+	}
+
+	for _, path := range []string{
+		"",
+		"/",
+		"/user.slice/user-1000.slice/session-3.scope",
+		"/system.slice/docker.service",
+		"/system.slice/docker-" + id[:12] + ".scope", // ID curto.
+		"/system.slice/rkt-" + id + ".scope",         // Escopo de runtime desconhecido.
+	} {
+		if _, _, _, ok := containerFromCgroup(path); ok {
+			t.Errorf("containerFromCgroup(%q) reconheceu um contêiner", path)
+		}
+	}
+}
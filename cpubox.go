@@ -6,6 +6,10 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -13,18 +17,29 @@ import (
 	"github.com/rivo/tview"
 )
 
+// cpuGroup é um conjunto de núcleos que compartilham nó NUMA ou soquete.
+type cpuGroup struct {
+	label string
+	cores []int
+}
+
 // CPUBox é um widget customizado para exibir o uso de múltiplos núcleos de CPU.
+// O layout é escolhido a cada Draw conforme o espaço disponível: uma linha
+// por núcleo, várias colunas ou, em máquinas muito grandes, um mapa de calor
+// com uma célula colorida por núcleo.
 type CPUBox struct {
 	*tview.Box
-	mu    sync.RWMutex
-	cores []float64 // Armazena o uso percentual de cada core.
+	mu     sync.RWMutex
+	cores  []float64  // Armazena o uso percentual de cada core.
+	groups []cpuGroup // Agrupamento por nó NUMA/soquete (vazio se houver um só).
 }
 
 // NewCPUBox cria um novo widget CPUBox.
 func NewCPUBox() *CPUBox {
 	return &CPUBox{
-		Box:   tview.NewBox().SetBorder(true).SetTitle("Uso de CPU (por Núcleo)"),
-		cores: []float64{},
+		Box:    tview.NewBox().SetBorder(true).SetTitle("Uso de CPU (por Núcleo)"),
+		cores:  []float64{},
+		groups: readCPUGroups(),
 	}
 }
 
@@ -35,6 +50,140 @@ func (c *CPUBox) Update(cores []float64) {
 	c.cores = cores
 }
 
+// parseCPUList interpreta listas do sysfs no formato "0-3,8,10-11".
+func parseCPUList(list string) []int {
+	var cpus []int
+	for _, part := range strings.Split(strings.TrimSpace(list), ",") {
+		if part == "" {
+			continue
+		}
+		bounds := strings.SplitN(part, "-", 2)
+		start, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			continue
+		}
+		end := start
+		if len(bounds) == 2 {
+			if end, err = strconv.Atoi(bounds[1]); err != nil {
+				continue
+			}
+		}
+		for i := start; i <= end; i++ {
+			cpus = append(cpus, i)
+		}
+	}
+	return cpus
+}
+
+// readCPUGroups descobre os nós NUMA (ou, na falta deles, os soquetes) da
+// máquina. Com um único grupo não há o que agrupar e nil é devolvido.
+func readCPUGroups() []cpuGroup {
+	var groups []cpuGroup
+
+	nodes, _ := filepath.Glob(sysPath("devices", "system", "node", "node[0-9]*"))
+	for _, node := range nodes {
+		data, err := os.ReadFile(filepath.Join(node, "cpulist"))
+		if err != nil {
+			continue
+		}
+		if cpus := parseCPUList(string(data)); len(cpus) > 0 {
+			groups = append(groups, cpuGroup{label: "Nó " + strings.TrimPrefix(filepath.Base(node), "node"), cores: cpus})
+		}
+	}
+
+	if len(groups) <= 1 {
+		groups = nil
+		sockets := make(map[int][]int)
+		paths, _ := filepath.Glob(sysPath("devices", "system", "cpu", "cpu[0-9]*", "topology", "physical_package_id"))
+		for _, p := range paths {
+			id, err := readUintFile(p)
+			cpu := cpuIndexFromPath(p)
+			if err != nil || cpu < 0 {
+				continue
+			}
+			sockets[int(id)] = append(sockets[int(id)], cpu)
+		}
+		for id, cpus := range sockets {
+			sort.Ints(cpus)
+			groups = append(groups, cpuGroup{label: fmt.Sprintf("Soq %d", id), cores: cpus})
+		}
+	}
+
+	if len(groups) <= 1 {
+		return nil
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].cores[0] < groups[j].cores[0] })
+	return groups
+}
+
+// cpuUsageColor define a cor com base no uso.
+func cpuUsageColor(usage float64) tcell.Color {
+	if usage > 75 {
+		return tcell.ColorRed
+	} else if usage > 50 {
+		return tcell.ColorYellow
+	}
+	return tcell.ColorGreen
+}
+
+// heatColor é a escala de cores do mapa de calor (mais níveis que a barra).
+func heatColor(usage float64) tcell.Color {
+	switch {
+	case usage >= 90:
+		return tcell.ColorRed
+	case usage >= 70:
+		return tcell.ColorOrangeRed
+	case usage >= 50:
+		return tcell.ColorYellow
+	case usage >= 25:
+		return tcell.ColorGreen
+	case usage >= 5:
+		return tcell.ColorDarkGreen
+	}
+	return tcell.ColorDarkSlateGray
+}
+
+// usageBar monta uma barra de blocos cheios de até maxWidth caracteres.
+func usageBar(usage float64, maxWidth int) string {
+	if maxWidth < 0 {
+		maxWidth = 0
+	}
+	barLen := int(usage / 100.0 * float64(maxWidth))
+	if barLen > maxWidth {
+		barLen = maxWidth
+	}
+	return strings.Repeat("█", barLen)
+}
+
+// visibleGroups devolve os grupos a desenhar, descartando núcleos que não
+// aparecem na leitura atual (ex.: CPUs offline) e índices inválidos
+// (cpuIndexFromPath devolve -1 quando não acha o "cpuN" no caminho).
+func (c *CPUBox) visibleGroups() []cpuGroup {
+	if len(c.groups) == 0 {
+		all := make([]int, len(c.cores))
+		for i := range all {
+			all[i] = i
+		}
+		return []cpuGroup{{cores: all}}
+	}
+	var groups []cpuGroup
+	for _, g := range c.groups {
+		var cores []int
+		for _, i := range g.cores {
+			if i >= 0 && i < len(c.cores) {
+				cores = append(cores, i)
+			}
+		}
+		if len(cores) > 0 {
+			groups = append(groups, cpuGroup{label: g.label, cores: cores})
+		}
+	}
+	return groups
+}
+
+// Largura mínima de uma coluna no modo de lista com várias colunas.
+const cpuColumnMinWidth = 22
+
 // Draw desenha o widget na tela.
 func (c *CPUBox) Draw(screen tcell.Screen) {
 	c.Box.Draw(screen)
@@ -46,45 +195,123 @@ func (c *CPUBox) Draw(screen tcell.Screen) {
 		return
 	}
 
-	// Caracteres para desenhar a barra de uso.
-	barChars := []rune{' ', '▏', '▎', '▍', '▌', '▋', '▊', '▉', '█'}
-	
-	// Desenha uma linha para cada core.
-	for i, coreUsage := range c.cores {
-		// Não desenha mais linhas do que a altura permite.
-		if i >= height {
-			break
+	// Primeira linha: média de todos os núcleos.
+	var total float64
+	for _, usage := range c.cores {
+		total += usage
+	}
+	avg := total / float64(len(c.cores))
+	avgLabel := fmt.Sprintf("Média (%d): [%5.1f%%]", len(c.cores), avg)
+	tview.Print(screen, fmt.Sprintf("%s [%s]", avgLabel, usageBar(avg, width-len(avgLabel)-2)), x+1, y, width-2, tview.AlignLeft, cpuUsageColor(avg))
+	if height == 1 {
+		return
+	}
+	y, height = y+1, height-1
+
+	groups := c.visibleGroups()
+	headerLines := 0
+	if len(groups) > 1 {
+		headerLines = len(groups)
+	}
+
+	// Procura o menor número de colunas em que todos os núcleos cabem.
+	for cols := 1; cols == 1 || cols*cpuColumnMinWidth <= width; cols++ {
+		lines := headerLines
+		for _, g := range groups {
+			lines += (len(g.cores) + cols - 1) / cols
+		}
+		if lines <= height {
+			c.drawColumns(screen, x, y, width, groups, cols)
+			return
+		}
+	}
+	c.drawHeatmap(screen, x, y, width, height, groups)
+}
+
+// drawColumns desenha uma barra por núcleo, distribuindo os núcleos de cada
+// grupo em cols colunas (preenchidas de cima para baixo).
+func (c *CPUBox) drawColumns(screen tcell.Screen, x, y, width int, groups []cpuGroup, cols int) {
+	colWidth := (width - 1) / cols
+	row := 0
+	for _, g := range groups {
+		if len(groups) > 1 {
+			tview.Print(screen, fmt.Sprintf("[ %s: CPUs %d-%d ]", g.label, g.cores[0], g.cores[len(g.cores)-1]), x+1, y+row, width-2, tview.AlignLeft, tcell.ColorYellow)
+			row++
 		}
+		rows := (len(g.cores) + cols - 1) / cols
+		for k, core := range g.cores {
+			usage := c.cores[core]
+			col, line := k/rows, k%rows
 
-		// Texto do label, ex: "Core 0:  25.7%"
-		labelText := fmt.Sprintf("Núcleo %-2d: [%5.1f%%]", i, coreUsage)
-		
-		// Calcula o comprimento da barra de uso.
-		barMaxWidth := width - len(labelText) - 2 // Deixa espaço para o label e um padding
-		if barMaxWidth < 0 {
-			barMaxWidth = 0
+			var labelText string
+			if cols == 1 {
+				// Texto do label, ex: "Núcleo 0 : [ 25.7%]"
+				labelText = fmt.Sprintf("Núcleo %-2d: [%5.1f%%]", core, usage)
+			} else {
+				labelText = fmt.Sprintf("%3d [%5.1f%%]", core, usage)
+			}
+			fullLine := fmt.Sprintf("%s [%s]", labelText, usageBar(usage, colWidth-len(labelText)-3))
+			tview.Print(screen, fullLine, x+1+col*colWidth, y+row+line, colWidth-1, tview.AlignLeft, cpuUsageColor(usage))
 		}
-		
-		barLen := int(coreUsage / 100.0 * float64(barMaxWidth))
+		row += rows
+	}
+}
 
-		// Cria a string da barra.
-		var bar strings.Builder
-		for k := 0; k < barLen; k++ {
-			bar.WriteRune(barChars[len(barChars)-1]) // Caractere de bloco cheio
+// drawHeatmap desenha uma célula colorida por núcleo, uma faixa por grupo.
+func (c *CPUBox) drawHeatmap(screen tcell.Screen, x, y, width, height int, groups []cpuGroup) {
+	labelWidth := 0
+	if len(groups) > 1 {
+		labelWidth = 7
+	}
+	// Reserva a última linha para a legenda quando há espaço.
+	rows := height
+	if rows > 2 {
+		rows--
+		legend := []struct {
+			text  string
+			color tcell.Color
+		}{{"<5 ", heatColor(0)}, {"<25 ", heatColor(5)}, {"<50 ", heatColor(25)}, {"<70 ", heatColor(50)}, {"<90 ", heatColor(70)}, {"≥90%", heatColor(90)}}
+		lx := x + 1
+		for _, l := range legend {
+			screen.SetContent(lx, y+height-1, '█', nil, tcell.StyleDefault.Foreground(l.color))
+			tview.Print(screen, l.text, lx+1, y+height-1, len(l.text), tview.AlignLeft, tcell.ColorWhite)
+			lx += len(l.text) + 2
 		}
+	}
 
-		// Monta a string final da linha.
-		fullLine := fmt.Sprintf("%s [%s]", labelText, bar.String())
+	cellsPerLine := width - 2 - labelWidth
+	if cellsPerLine <= 0 {
+		return
+	}
+	// Células com espaçamento ficam mais legíveis quando cabem.
+	cellWidth := 2
+	needed := 0
+	for _, g := range groups {
+		needed += (len(g.cores)*2 + cellsPerLine - 1) / cellsPerLine
+	}
+	if needed > rows {
+		cellWidth = 1
+	}
+	perLine := cellsPerLine / cellWidth
 
-		// Define a cor da barra com base no uso.
-		barColor := tcell.ColorGreen
-		if coreUsage > 75 {
-			barColor = tcell.ColorRed
-		} else if coreUsage > 50 {
-			barColor = tcell.ColorYellow
+	row := 0
+	for _, g := range groups {
+		if row >= rows {
+			return
 		}
-		
-		// Imprime a linha na tela.
-		tview.Print(screen, fullLine, x+1, y+i, width-2, tview.AlignLeft, barColor)
+		if labelWidth > 0 {
+			tview.Print(screen, g.label, x+1, y+row, labelWidth, tview.AlignLeft, tcell.ColorYellow)
+		}
+		for k, core := range g.cores {
+			line, col := k/perLine, k%perLine
+			if row+line >= rows {
+				// Sem espaço: indica quantos núcleos ficaram de fora.
+				hidden := fmt.Sprintf("+%d", len(g.cores)-k)
+				tview.Print(screen, hidden, x+width-1-len(hidden), y+rows-1, len(hidden), tview.AlignLeft, tcell.ColorWhite)
+				return
+			}
+			screen.SetContent(x+1+labelWidth+col*cellWidth, y+row+line, '█', nil, tcell.StyleDefault.Foreground(heatColor(c.cores[core])))
+		}
+		row += (len(g.cores) + perLine - 1) / perLine
 	}
-}
\ No newline at end of file
+}
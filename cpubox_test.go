@@ -0,0 +1,51 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVisibleGroupsSkipsInvalidCores(t *testing.T) {
+	c := NewCPUBox()
+	c.groups = []cpuGroup{
+		{label: "Nó 0", cores: []int{-1, 0, 1}},
+		{label: "Nó 1", cores: []int{2, 3, 7}},
+		{label: "Nó 2", cores: []int{8, 9}},
+	}
+	c.Update([]float64{10, 20, 30, 40})
+
+	got := c.visibleGroups()
+	want := []cpuGroup{
+		{label: "Nó 0", cores: []int{0, 1}},
+		{label: "Nó 1", cores: []int{2, 3}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("visibleGroups() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseCPUList(t *testing.T) {
+	tests := []struct {
+		list string
+		want []int
+	}{
+		{"0-3,8,10-11", []int{0, 1, 2, 3, 8, 10, 11}},
+		{"0-3,8,10-11\n", []int{0, 1, 2, 3, 8, 10, 11}}, // Como lido do sysfs.
+		{"5", []int{5}},
+		{"2-2", []int{2}},
+		{"", nil},
+		{"\n", nil},
+		{"0,,2,", []int{0, 2}},
+		// Trechos malformados são ignorados sem descartar o resto.
+		{"3-1,4", []int{4}},
+		{"a-3,4", []int{4}},
+		{"1-b,4", []int{4}},
+		{"-1,4", []int{4}},
+		{"1-2-3,4", []int{4}},
+	}
+	for _, tt := range tests {
+		if got := parseCPUList(tt.list); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseCPUList(%q) = %v, want %v", tt.list, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,374 @@
+// /*********************************************************************************
+// * Projeto:     Batedor
+// * Componente:  CPUDetailsBox - Carga, tempos de CPU, trocas de contexto e frequência
+// *********************************************************************************/
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/load"
+)
+
+// CPUTimesPercent é a divisão percentual do tempo de um núcleo no intervalo.
+type CPUTimesPercent struct {
+	User    float64
+	System  float64
+	Nice    float64
+	Iowait  float64
+	Irq     float64
+	Softirq float64
+	Steal   float64
+	Idle    float64
+}
+
+// CPUDetails armazena os dados exibidos na tela de detalhes da CPU.
+type CPUDetails struct {
+	Load1             float64
+	Load5             float64
+	Load15            float64
+	Total             CPUTimesPercent
+	PerCore           []CPUTimesPercent
+	CtxSwitchesPerSec float64
+	InterruptsPerSec  float64
+	ProcsRunning      int
+	ProcsBlocked      int
+	FreqMHz           []float64 // Frequência atual de cada núcleo (vazia se indisponível).
+}
+
+// AvgFreqMHz devolve a frequência média dos núcleos, ou 0 se desconhecida.
+func (d CPUDetails) AvgFreqMHz() float64 {
+	if len(d.FreqMHz) == 0 {
+		return 0
+	}
+	var total float64
+	for _, f := range d.FreqMHz {
+		total += f
+	}
+	return total / float64(len(d.FreqMHz))
+}
+
+// procStat são os contadores globais de /proc/stat que o gopsutil não expõe,
+// mais a linha "cpu" com os tempos somados de todos os núcleos (em ticks).
+type procStat struct {
+	total        cpu.TimesStat
+	ctxt         uint64
+	intr         uint64
+	procsRunning int
+	procsBlocked int
+}
+
+// readProcStat lê os tempos de CPU, trocas de contexto, interrupções e a
+// fila de execução.
+func readProcStat() (procStat, error) {
+	var st procStat
+	f, err := os.Open(procPath("stat"))
+	if err != nil {
+		return st, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024) // A linha "intr" é enorme.
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "cpu":
+			st.total = parseCPUTimes(fields[1:])
+		case "ctxt":
+			st.ctxt, _ = strconv.ParseUint(fields[1], 10, 64)
+		case "intr":
+			st.intr, _ = strconv.ParseUint(fields[1], 10, 64)
+		case "procs_running":
+			st.procsRunning, _ = strconv.Atoi(fields[1])
+		case "procs_blocked":
+			st.procsBlocked, _ = strconv.Atoi(fields[1])
+		}
+	}
+	return st, scanner.Err()
+}
+
+// parseCPUTimes converte os campos de uma linha "cpu" do /proc/stat (user
+// nice system idle iowait irq softirq steal ...). Kernels antigos têm menos
+// colunas; as que faltam ficam zeradas.
+func parseCPUTimes(fields []string) cpu.TimesStat {
+	var v [8]float64
+	for i := 0; i < len(v) && i < len(fields); i++ {
+		v[i], _ = strconv.ParseFloat(fields[i], 64)
+	}
+	return cpu.TimesStat{CPU: "cpu-total", User: v[0], Nice: v[1], System: v[2], Idle: v[3],
+		Iowait: v[4], Irq: v[5], Softirq: v[6], Steal: v[7]}
+}
+
+// readCPUFreqs lê a frequência atual de cada núcleo em MHz, primeiro pelo
+// cpufreq do sysfs e, na falta dele, pelo /proc/cpuinfo.
+func readCPUFreqs() []float64 {
+	paths, _ := filepath.Glob(sysPath("devices", "system", "cpu", "cpu[0-9]*", "cpufreq", "scaling_cur_freq"))
+	if len(paths) > 0 {
+		// Ordena numericamente (cpu2 antes de cpu10).
+		sort.Slice(paths, func(i, j int) bool { return cpuIndexFromPath(paths[i]) < cpuIndexFromPath(paths[j]) })
+		freqs := make([]float64, 0, len(paths))
+		for _, p := range paths {
+			khz, err := readUintFile(p)
+			if err != nil {
+				continue
+			}
+			freqs = append(freqs, float64(khz)/1000)
+		}
+		if len(freqs) > 0 {
+			return freqs
+		}
+	}
+
+	f, err := os.Open(procPath("cpuinfo"))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var freqs []float64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "cpu MHz") {
+			continue
+		}
+		if idx := strings.Index(line, ":"); idx >= 0 {
+			if mhz, err := strconv.ParseFloat(strings.TrimSpace(line[idx+1:]), 64); err == nil {
+				freqs = append(freqs, mhz)
+			}
+		}
+	}
+	return freqs
+}
+
+// cpuIndexFromPath extrai o N de ".../cpuN/...".
+func cpuIndexFromPath(p string) int {
+	for _, part := range strings.Split(p, string(filepath.Separator)) {
+		if strings.HasPrefix(part, "cpu") {
+			if n, err := strconv.Atoi(part[3:]); err == nil {
+				return n
+			}
+		}
+	}
+	return -1
+}
+
+// readUintFile lê um arquivo do sysfs/procfs que contém um único número.
+func readUintFile(path string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// cpuStatSampler transforma os contadores acumulados da CPU em
+// percentuais e taxas por segundo entre duas amostras.
+type cpuStatSampler struct {
+	lastTotal cpu.TimesStat
+	lastCores []cpu.TimesStat
+	lastStat  procStat
+	lastCheck time.Time
+}
+
+func (s *cpuStatSampler) sample(now time.Time) CPUDetails {
+	var d CPUDetails
+
+	if avg, err := load.Avg(); err == nil {
+		d.Load1, d.Load5, d.Load15 = avg.Load1, avg.Load5, avg.Load15
+	}
+
+	totals, _ := cpu.Times(false)
+	cores, _ := cpu.Times(true)
+	if len(totals) > 0 && !s.lastCheck.IsZero() {
+		d.Total = timesPercent(s.lastTotal, totals[0])
+	}
+	if len(cores) == len(s.lastCores) {
+		d.PerCore = make([]CPUTimesPercent, len(cores))
+		for i := range cores {
+			d.PerCore[i] = timesPercent(s.lastCores[i], cores[i])
+		}
+	}
+
+	st, err := readProcStat()
+	if err == nil {
+		d.ProcsRunning, d.ProcsBlocked = st.procsRunning, st.procsBlocked
+		elapsed := now.Sub(s.lastCheck).Seconds()
+		if !s.lastCheck.IsZero() && elapsed > 0 && st.ctxt >= s.lastStat.ctxt && st.intr >= s.lastStat.intr {
+			d.CtxSwitchesPerSec = float64(st.ctxt-s.lastStat.ctxt) / elapsed
+			d.InterruptsPerSec = float64(st.intr-s.lastStat.intr) / elapsed
+		}
+		s.lastStat = st
+	}
+
+	d.FreqMHz = readCPUFreqs()
+
+	if len(totals) > 0 {
+		s.lastTotal = totals[0]
+	}
+	s.lastCores = cores
+	s.lastCheck = now
+	return d
+}
+
+// timesPercent calcula quanto de cada categoria foi usado entre duas leituras.
+func timesPercent(prev, cur cpu.TimesStat) CPUTimesPercent {
+	// No Linux o tempo de guest já está incluído em user/nice.
+	total := func(t cpu.TimesStat) float64 {
+		return t.User + t.System + t.Nice + t.Iowait + t.Irq + t.Softirq + t.Steal + t.Idle
+	}
+	delta := total(cur) - total(prev)
+	if delta <= 0 {
+		return CPUTimesPercent{}
+	}
+	pct := func(a, b float64) float64 {
+		v := (b - a) / delta * 100
+		if v < 0 {
+			return 0
+		}
+		return v
+	}
+	return CPUTimesPercent{
+		User:    pct(prev.User, cur.User),
+		System:  pct(prev.System, cur.System),
+		Nice:    pct(prev.Nice, cur.Nice),
+		Iowait:  pct(prev.Iowait, cur.Iowait),
+		Irq:     pct(prev.Irq, cur.Irq),
+		Softirq: pct(prev.Softirq, cur.Softirq),
+		Steal:   pct(prev.Steal, cur.Steal),
+		Idle:    pct(prev.Idle, cur.Idle),
+	}
+}
+
+// CPUDetailsBox é o widget da tela de detalhes da CPU.
+type CPUDetailsBox struct {
+	*tview.Box
+	mu      sync.RWMutex
+	details CPUDetails
+	cores   int
+	offset  int // Primeira linha de núcleo exibida (rolagem).
+}
+
+// NewCPUDetailsBox cria um novo widget CPUDetailsBox.
+func NewCPUDetailsBox() *CPUDetailsBox {
+	return &CPUDetailsBox{
+		Box: tview.NewBox().SetBorder(true).SetTitle(tview.Escape(" Detalhes da CPU | [↑]/[↓] Rolar | [Q] Voltar ")),
+	}
+}
+
+// Update atualiza os dados exibidos.
+func (c *CPUDetailsBox) Update(details CPUDetails) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.details = details
+	c.cores = len(details.PerCore)
+}
+
+// Scroll rola a lista de núcleos.
+func (c *CPUDetailsBox) Scroll(delta int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.offset += delta
+	if c.offset > c.cores-1 {
+		c.offset = c.cores - 1
+	}
+	if c.offset < 0 {
+		c.offset = 0
+	}
+}
+
+// timesLine formata uma linha da tabela de tempos de CPU.
+func timesLine(label string, t CPUTimesPercent, mhz float64) string {
+	// Iowait e steal altos são os sinais que interessam; ganham cor própria.
+	iowaitColor := "white"
+	if t.Iowait > 25 {
+		iowaitColor = "red"
+	} else if t.Iowait > 10 {
+		iowaitColor = "yellow"
+	}
+	stealColor := "white"
+	if t.Steal > 10 {
+		stealColor = "red"
+	} else if t.Steal > 2 {
+		stealColor = "yellow"
+	}
+	freq := "    -"
+	if mhz > 0 {
+		freq = fmt.Sprintf("%5.0f", mhz)
+	}
+	return fmt.Sprintf("[yellow]%-8s[white] %6.1f %6.1f %6.1f [%s]%6.1f[white] %6.1f %6.1f [%s]%6.1f[white] %6.1f %s",
+		label, t.User, t.System, t.Nice, iowaitColor, t.Iowait, t.Irq, t.Softirq, stealColor, t.Steal, t.Idle, freq)
+}
+
+// Draw desenha o widget na tela.
+func (c *CPUDetailsBox) Draw(screen tcell.Screen) {
+	c.Box.Draw(screen)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	x, y, width, height := c.GetInnerRect()
+	if width <= 0 || height <= 0 {
+		return
+	}
+	d := c.details
+
+	lines := []string{
+		fmt.Sprintf("[yellow]Carga média (1/5/15 min): [white]%.2f  %.2f  %.2f", d.Load1, d.Load5, d.Load15),
+		fmt.Sprintf("[yellow]Fila de execução: [white]%d executando, %d bloqueados em E/S", d.ProcsRunning, d.ProcsBlocked),
+		fmt.Sprintf("[yellow]Trocas de contexto: [white]%.0f/s   [yellow]Interrupções: [white]%.0f/s", d.CtxSwitchesPerSec, d.InterruptsPerSec),
+	}
+	if avg := d.AvgFreqMHz(); avg > 0 {
+		lines = append(lines, fmt.Sprintf("[yellow]Frequência média: [white]%.0f MHz", avg))
+	} else {
+		lines = append(lines, "[yellow]Frequência média: [white]N/A")
+	}
+
+	// Diagnóstico rápido: CPU ocupada esperando disco x CPU realmente ocupada.
+	busy := d.Total.User + d.Total.System + d.Total.Nice
+	switch {
+	case d.Total.Iowait > 20:
+		lines = append(lines, "[red]Diagnóstico: gargalo de E/S (iowait alto)")
+	case d.Total.Steal > 10:
+		lines = append(lines, "[red]Diagnóstico: CPU roubada pelo hipervisor (steal alto)")
+	case busy > 80:
+		lines = append(lines, "[red]Diagnóstico: limitado por CPU")
+	default:
+		lines = append(lines, "[green]Diagnóstico: sem saturação aparente")
+	}
+
+	lines = append(lines, "",
+		fmt.Sprintf("[green]%-8s %6s %6s %6s %6s %6s %6s %6s %6s %5s", "Núcleo", "user", "sys", "nice", "iowait", "irq", "soft", "steal", "idle", "MHz"),
+		timesLine("Total", d.Total, d.AvgFreqMHz()))
+
+	row := 0
+	for _, line := range lines {
+		if row >= height {
+			return
+		}
+		tview.Print(screen, line, x+1, y+row, width-2, tview.AlignLeft, tcell.ColorWhite)
+		row++
+	}
+
+	for i := c.offset; i < len(d.PerCore) && row < height; i++ {
+		var mhz float64
+		if i < len(d.FreqMHz) {
+			mhz = d.FreqMHz[i]
+		}
+		tview.Print(screen, timesLine(fmt.Sprintf("%d", i), d.PerCore[i], mhz), x+1, y+row, width-2, tview.AlignLeft, tcell.ColorWhite)
+		row++
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+)
+
+// fakeProc monta uma árvore do procfs em um diretório temporário, aponta
+// procRoot para ela e devolve a raiz. Os caminhos de files são relativos à
+// raiz.
+func fakeProc(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for path, content := range files {
+		writeSysFile(t, root, path, content)
+	}
+	old := procRoot
+	procRoot = root
+	t.Cleanup(func() { procRoot = old })
+	return root
+}
+
+func writeSysFile(t *testing.T, root, path, content string) {
+	t.Helper()
+	full := filepath.Join(root, path)
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(full, []byte(content+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadProcStat(t *testing.T) {
+	fakeProc(t, map[string]string{"stat": strings.Join([]string{
+		"cpu  4705 356 584 3699176 23 0 12 7 0 0",
+		"cpu0 1393 280 290 924591 11 0 6 3 0 0",
+		"cpu1 3312 76 294 2774585 12 0 6 4 0 0",
+		"intr 114930548 113199788 3 0 5 263 0 4 [...]" + strings.Repeat(" 0", 20000), // Maior que o buffer padrão do Scanner.
+		"ctxt 1990473",
+		"btime 1062191376",
+		"processes 2915",
+		"procs_running 3",
+		"procs_blocked 1",
+		"softirq 183433 0 21755 12 39 1137 231 21459 2263",
+	}, "\n")})
+
+	st, err := readProcStat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.ctxt != 1990473 || st.intr != 114930548 || st.procsRunning != 3 || st.procsBlocked != 1 {
+		t.Errorf("readProcStat() = %+v", st)
+	}
+	// Só a linha agregada "cpu" conta; as dos núcleos são ignoradas.
+	want := cpu.TimesStat{CPU: "cpu-total", User: 4705, Nice: 356, System: 584, Idle: 3699176, Iowait: 23, Softirq: 12, Steal: 7}
+	if st.total != want {
+		t.Errorf("total = %+v, want %+v", st.total, want)
+	}
+
+	fakeProc(t, nil)
+	if _, err := readProcStat(); err == nil {
+		t.Error("readProcStat() sem /proc/stat deveria falhar")
+	}
+}
+
+func TestTimesPercent(t *testing.T) {
+	// Kernels antigos sem as colunas de iowait, irq, softirq e steal.
+	prev := parseCPUTimes(strings.Fields("100 0 100 800"))
+	cur := parseCPUTimes(strings.Fields("150 0 150 900 0 0 0 0"))
+	want := CPUTimesPercent{User: 25, System: 25, Idle: 50}
+	if got := timesPercent(prev, cur); got != want {
+		t.Errorf("timesPercent() = %+v, want %+v", got, want)
+	}
+
+	prev = cpu.TimesStat{User: 10, Iowait: 10, Steal: 0, Idle: 80}
+	cur = cpu.TimesStat{User: 20, Iowait: 30, Steal: 10, Idle: 140}
+	want = CPUTimesPercent{User: 10, Iowait: 20, Steal: 10, Idle: 60}
+	if got := timesPercent(prev, cur); got != want {
+		t.Errorf("timesPercent() = %+v, want %+v", got, want)
+	}
+
+	// Sem avanço (ou com contadores reiniciados) não há percentual.
+	if got := timesPercent(cur, cur); got != (CPUTimesPercent{}) {
+		t.Errorf("timesPercent() sem avanço = %+v", got)
+	}
+	if got := timesPercent(cur, prev); got != (CPUTimesPercent{}) {
+		t.Errorf("timesPercent() com contadores reiniciados = %+v", got)
+	}
+}
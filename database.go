@@ -7,80 +7,280 @@ package main
 import (
 	"database/sql"
 	"fmt" // <-- ESTA LINHA FOI ADICIONADA
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3" // O driver do SQLite
 )
 
-const dbFile = "./batedor_history.db"
+// legacyDBFile é onde versões antigas gravavam o histórico: no diretório em
+// que o Batedor era iniciado.
+const legacyDBFile = "batedor_history.db"
 
+// dbPath é o arquivo do banco de histórico (--db); vazio usa defaultDBPath.
+var dbPath string
+
+// systemDBPath é o local padrão do banco quando o Batedor roda como root.
+var systemDBPath = "/var/lib/batedor/history.db"
+
+// migrateLegacyDB indica se resolveDBPath pode copiar o banco de versões
+// antigas para o local padrão. Só a TUI liga: os subcomandos e serviços
+// leem o antigo onde ele está.
+var migrateLegacyDB bool
+
+// db é o banco SQLite aberto pelo armazenamento sqlite, que também guarda a
+// trilha de auditoria do dashboard web.
 var db *sql.DB
 
+// dbErr guarda por que o histórico não pôde ser aberto. O Batedor continua
+// funcionando sem histórico e as telas que dependem dele exibem o motivo.
+var dbErr error
+
+// Esquemas atuais das tabelas. A coluna host identifica a máquina de origem:
+// "" para o host local e o hostname do agente nas amostras recebidas pelo
+// servidor de histórico.
+const (
+	metricsSchema = `metrics (
+		host TEXT NOT NULL DEFAULT '',
+		timestamp DATETIME NOT NULL,
+		metric_name TEXT NOT NULL,
+		value REAL NOT NULL,
+		PRIMARY KEY (host, timestamp, metric_name)
+	)`
+	processSamplesSchema = `process_samples (
+		host TEXT NOT NULL DEFAULT '',
+		timestamp DATETIME NOT NULL,
+		pid INTEGER NOT NULL,
+		user TEXT NOT NULL,
+		command TEXT NOT NULL,
+		cpu REAL NOT NULL,
+		mem REAL NOT NULL,
+		PRIMARY KEY (host, timestamp, pid)
+	)`
+)
+
+// fleetHostKey é o "host" que agrega todas as máquinas do histórico.
+const fleetHostKey = "*"
+
 // MetricRecord representa um único registro de dados históricos.
 type MetricRecord struct {
 	Timestamp time.Time
 	Value     float64
 }
 
-// initDatabase abre a conexão com o banco de dados e cria a tabela se ela não existir.
-func initDatabase() error {
-	var err error
-	db, err = sql.Open("sqlite3", dbFile)
+// ProcessRecord representa um processo gravado junto com as métricas do host,
+// usado para responder "quem estava consumindo" em um ponto do histórico.
+type ProcessRecord struct {
+	Timestamp time.Time
+	PID       int32
+	User      string
+	Command   string
+	CPU       float64
+	Mem       float64
+}
+
+// AuditEntry é uma ação pedida pelo dashboard web, gravada com o resultado.
+type AuditEntry struct {
+	Timestamp  time.Time
+	User       string
+	Role       string
+	RemoteAddr string
+	Action     string
+	PID        int32
+	Command    string
+	Detail     string // Sinal ou prioridade pedidos.
+	Outcome    string // "ok", "negado" ou a mensagem de erro.
+}
+
+// defaultDBPath devolve o local padrão do banco: /var/lib/batedor para o
+// root (o Batedor rodando como serviço) e, para os demais usuários,
+// $XDG_DATA_HOME/batedor ou ~/.local/share/batedor.
+func defaultDBPath() (string, error) {
+	if os.Geteuid() == 0 {
+		return systemDBPath, nil
+	}
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" || !filepath.IsAbs(dir) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("não foi possível achar o diretório de dados (use --db): %v", err)
+		}
+		dir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dir, "batedor", "history.db"), nil
+}
+
+// resolveDBPath escolhe o arquivo do banco: o de --db ou o local padrão.
+// Se o padrão ainda não existe e há um batedor_history.db de versões antigas
+// no diretório atual, a TUI (migrateLegacyDB) o copia para o local padrão;
+// nos demais casos, o antigo é usado onde está. O original nunca é apagado.
+func resolveDBPath() (string, error) {
+	if dbPath != "" {
+		return dbPath, nil
+	}
+	path, err := defaultDBPath()
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		return path, nil
+	}
+	if _, err := os.Stat(legacyDBFile); err != nil {
+		return path, nil
+	}
+	if !migrateLegacyDB {
+		log.Printf("Usando o histórico antigo em ./%s (a TUI o copia para %s)", legacyDBFile, path)
+		return legacyDBFile, nil
+	}
+	if err := copyLegacyDB(path); err != nil {
+		log.Printf("Usando o histórico antigo em ./%s (não foi possível copiá-lo para %s: %v)", legacyDBFile, path, err)
+		return legacyDBFile, nil
+	}
+	log.Printf("Histórico copiado de ./%s para %s, onde passa a ser gravado; o arquivo antigo pode ser apagado", legacyDBFile, path)
+	return path, nil
+}
+
+// copyLegacyDB copia o banco antigo para path com VACUUM INTO, que inclui o
+// que ainda estiver no WAL e não altera o original.
+func copyLegacyDB(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("falha ao criar o diretório de dados: %v", err)
+	}
+	src, err := sql.Open("sqlite3", "file:"+legacyDBFile+"?mode=ro")
 	if err != nil {
 		return err
 	}
+	defer src.Close()
+	if _, err := src.Exec("VACUUM INTO ?", path); err != nil {
+		os.Remove(path)
+		return err
+	}
+	return nil
+}
 
-	sqlStmt := `
-	CREATE TABLE IF NOT EXISTS metrics (
-		timestamp DATETIME NOT NULL,
-		metric_name TEXT NOT NULL,
-		value REAL NOT NULL,
-		PRIMARY KEY (timestamp, metric_name)
-	);
-	`
-	_, err = db.Exec(sqlStmt)
-	return err
+// initDatabase abre os armazenamentos de histórico (--store; o padrão é o
+// banco SQLite) e inicia uma fila de gravação para cada um. Em caso de erro,
+// o histórico fica desativado e dbErr guarda o motivo.
+func initDatabase() error {
+	specs := storeSpecs
+	if len(specs) == 0 {
+		specs = storesFlag{"sqlite"}
+	}
+	for _, spec := range specs {
+		s, err := openStore(spec)
+		if err != nil {
+			for _, opened := range stores {
+				opened.Close()
+			}
+			stores, db, dbErr = nil, nil, err
+			return err
+		}
+		stores = append(stores, s)
+	}
+
+	for _, s := range stores {
+		dbWriter = append(dbWriter, newHistoryWriter(s))
+		if _, writeOnly := s.(writeOnlyStore); store == nil && !writeOnly {
+			store = s
+		}
+	}
+	if storeRetention > 0 {
+		go runRetention()
+	}
+	return nil
 }
 
-// logMetric salva uma nova métrica no banco de dados.
-func logMetric(name string, value float64) {
-	if db == nil {
-		return
+// closeDatabase grava o que ainda está nas filas e fecha os armazenamentos.
+func closeDatabase() {
+	dbWriter.Close()
+	for _, s := range stores {
+		if err := s.Close(); err != nil {
+			log.Printf("Histórico: falha ao fechar %s: %v", s, err)
+		}
 	}
+}
 
-	stmt, err := db.Prepare("INSERT INTO metrics(timestamp, metric_name, value) values(?,?,?)")
+// openDatabase abre o banco SQLite em path, confere se ele está íntegro e
+// aplica as migrações pendentes.
+func openDatabase(path string) (*sql.DB, error) {
+	// _busy_timeout espera por outro processo que esteja gravando em vez de
+	// falhar na hora com "database is locked". Com WAL, as leituras da tela
+	// de histórico e da API não bloqueiam a gravação (e vice-versa), e
+	// synchronous=NORMAL só sincroniza o disco nos checkpoints. Os instantes
+	// são gravados em UTC e _loc=auto os devolve no fuso local.
+	conn, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=5000&_journal_mode=WAL&_synchronous=NORMAL&_loc=auto")
 	if err != nil {
-		return
+		return nil, err
 	}
-	defer stmt.Close()
 
-	_, err = stmt.Exec(time.Now(), name, value)
+	var check string
+	if err := conn.QueryRow("PRAGMA quick_check").Scan(&check); err != nil {
+		conn.Close()
+		if strings.Contains(err.Error(), "locked") || strings.Contains(err.Error(), "busy") {
+			return nil, fmt.Errorf("%s está bloqueado por outro processo: %v", path, err)
+		}
+		return nil, fmt.Errorf("não foi possível ler %s (arquivo corrompido ou não é um banco SQLite? mova-o para recriar o histórico): %v", path, err)
+	}
+	if check != "ok" {
+		conn.Close()
+		return nil, fmt.Errorf("%s está corrompido (%s); mova-o para recriar o histórico", path, check)
+	}
+
+	if err := migrate(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return conn, nil
 }
 
-// getMetricsForLast24h busca os dados históricos de uma métrica específica.
-func getMetricsForLast24h(metricName string) ([]MetricRecord, error) {
-	if db == nil {
-		return nil, fmt.Errorf("banco de dados não inicializado")
+// errNoDatabase é o erro das consultas feitas sem banco aberto.
+func errNoDatabase() error {
+	if dbErr != nil {
+		return fmt.Errorf("histórico indisponível: %v", dbErr)
 	}
+	return fmt.Errorf("banco de dados não inicializado")
+}
+
+// errNoStore é o erro das consultas ao histórico sem armazenamento que as
+// responda.
+func errNoStore() error {
+	if dbErr == nil && len(stores) > 0 {
+		return fmt.Errorf("nenhum armazenamento configurado permite consultas (use --store sqlite ou --store memory)")
+	}
+	return errNoDatabase()
+}
+
+// storeHistoryBatch coloca na fila de gravação as métricas e os processos
+// enviados por um agente ao servidor de histórico.
+func storeHistoryBatch(b HistoryBatch) error {
+	return dbWriter.Enqueue(b)
+}
 
-	rows, err := db.Query(`
-		SELECT timestamp, value FROM metrics 
-		WHERE metric_name = ? AND timestamp >= ? 
-		ORDER BY timestamp ASC`,
-		metricName, time.Now().Add(-24*time.Hour),
+// logAudit grava uma ação na trilha de auditoria e devolve o id da linha,
+// para que setAuditOutcome registre o resultado depois.
+func logAudit(e AuditEntry) (int64, error) {
+	if db == nil {
+		return 0, errNoDatabase()
+	}
+	res, err := db.Exec(`
+		INSERT INTO audit_log(timestamp, user, role, remote_addr, action, pid, command, detail, outcome)
+		values(?,?,?,?,?,?,?,?,?)`,
+		e.Timestamp.UTC(), e.User, e.Role, e.RemoteAddr, e.Action, e.PID, e.Command, e.Detail, e.Outcome,
 	)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	defer rows.Close()
+	return res.LastInsertId()
+}
 
-	var records []MetricRecord
-	for rows.Next() {
-		var rec MetricRecord
-		if err := rows.Scan(&rec.Timestamp, &rec.Value); err != nil {
-			return nil, err
-		}
-		records = append(records, rec)
+// setAuditOutcome troca o resultado de uma linha gravada por logAudit.
+func setAuditOutcome(id int64, outcome string) error {
+	if db == nil {
+		return errNoDatabase()
 	}
-	return records, nil
-}
\ No newline at end of file
+	_, err := db.Exec("UPDATE audit_log SET outcome = ? WHERE id = ?", outcome, id)
+	return err
+}
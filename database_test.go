@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestResolveDBPathLegacy(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	oldSystem, oldMigrate, oldPath := systemDBPath, migrateLegacyDB, dbPath
+	t.Cleanup(func() {
+		os.Chdir(wd)
+		systemDBPath, migrateLegacyDB, dbPath = oldSystem, oldMigrate, oldPath
+	})
+	t.Setenv("XDG_DATA_HOME", filepath.Join(dir, "data"))
+	systemDBPath = filepath.Join(dir, "data", "batedor", "history.db")
+	want, err := defaultDBPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbPath = ""
+
+	// Banco de uma versão antiga, no diretório atual.
+	legacy, err := openDatabase(legacyDBFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC)
+	if err := (&sqliteStore{db: legacy}).Write([]HistoryBatch{{Timestamp: ts, Metrics: map[string]float64{"cpu_usage": 42}}}); err != nil {
+		t.Fatal(err)
+	}
+	legacy.Close()
+
+	// Fora da TUI, o antigo é lido onde está e nada é criado.
+	migrateLegacyDB = false
+	if got, err := resolveDBPath(); err != nil || got != legacyDBFile {
+		t.Fatalf("resolveDBPath() sem migração = %q, %v; want %q", got, err, legacyDBFile)
+	}
+	if _, err := os.Stat(filepath.Dir(want)); !os.IsNotExist(err) {
+		t.Errorf("diretório de dados criado sem migração: %v", err)
+	}
+
+	// A TUI copia para o local padrão e mantém o original.
+	migrateLegacyDB = true
+	for i := 0; i < 2; i++ {
+		if got, err := resolveDBPath(); err != nil || got != want {
+			t.Fatalf("resolveDBPath() na TUI = %q, %v; want %q", got, err, want)
+		}
+	}
+	if _, err := os.Stat(legacyDBFile); err != nil {
+		t.Errorf("o banco antigo não pode sumir: %v", err)
+	}
+	conn, err := openDatabase(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	records, err := (&sqliteStore{db: conn}).Query(RangeQuery{Metric: "cpu_usage", From: ts, To: ts})
+	if err != nil || len(records) != 1 || records[0].Value != 42 {
+		t.Errorf("cópia = %+v, %v; want o registro do banco antigo", records, err)
+	}
+
+	// Com --db, o antigo é ignorado.
+	dbPath = filepath.Join(dir, "outro.db")
+	if got, err := resolveDBPath(); err != nil || got != dbPath {
+		t.Errorf("resolveDBPath() com --db = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,222 @@
+// /*********************************************************************************
+// * Projeto:     Batedor
+// * Componente:  Export - Exportação do histórico em CSV, JSON e NDJSON
+// *********************************************************************************/
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportFormats são os formatos aceitos por --format.
+var exportFormats = []string{"csv", "json", "ndjson"}
+
+// ExportRow é um ponto exportado.
+type ExportRow struct {
+	Timestamp time.Time
+	Host      string
+	Metric    string
+	Value     float64
+}
+
+// writeExport escreve os pontos no formato pedido. O CSV tem cabeçalho e o
+// instante em RFC 3339; o JSON é uma lista e o NDJSON, um objeto por linha.
+func writeExport(w io.Writer, format string, rows []ExportRow) error {
+	switch format {
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"timestamp", "host", "metric", "value"})
+		for _, r := range rows {
+			cw.Write([]string{r.Timestamp.Format(time.RFC3339Nano), r.Host, r.Metric, strconv.FormatFloat(r.Value, 'f', -1, 64)})
+		}
+		cw.Flush()
+		return cw.Error()
+	case "json":
+		if rows == nil {
+			rows = []ExportRow{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rows)
+	case "ndjson":
+		enc := json.NewEncoder(w)
+		for _, r := range rows {
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("formato desconhecido: %q (use %s)", format, strings.Join(exportFormats, ", "))
+}
+
+// parseExportTime interpreta --from e --to: "now", uma duração contada para
+// trás a partir de agora (24h, 90m) ou um instante absoluto (RFC 3339,
+// "2006-01-02 15:04[:05]" ou "2006-01-02", no fuso local). Um instante RFC
+// 3339 é convertido para UTC, como os gravados no banco, para que o fuso
+// informado não apareça nos limites da consulta.
+func parseExportTime(value string, now time.Time) (time.Time, error) {
+	if value == "now" {
+		return now, nil
+	}
+	if d, err := time.ParseDuration(strings.TrimPrefix(value, "-")); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t.UTC(), nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("instante inválido: %q (use RFC 3339, AAAA-MM-DD [HH:MM[:SS]], uma duração como 24h ou now)", value)
+}
+
+// runExport implementa "batedor export".
+func runExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Uso: batedor export --metric cpu_usage[,mem_usage] [--from 24h] [--to now] [--format csv|json|ndjson] [-o arquivo]")
+		fs.PrintDefaults()
+	}
+	metrics := fs.String("metric", "", "Séries a exportar, separadas por vírgula (obrigatório)")
+	host := fs.String("host", "", `Host das séries: vazio é o host local e "*" a média de todos (por --step, padrão 1m)`)
+	from := fs.String("from", "24h", "Início: RFC 3339, AAAA-MM-DD [HH:MM[:SS]] ou uma duração antes de agora")
+	to := fs.String("to", "now", "Fim, no mesmo formato de --from")
+	step := fs.Duration("step", 0, "Agrega os pontos em intervalos deste tamanho (ex.: 5m; padrão: sem agregação)")
+	agg := fs.String("agg", "avg", "Agregação usada com --step: avg, min, max, sum ou last")
+	format := fs.String("format", "csv", "Formato de saída: csv, json ou ndjson")
+	output := fs.String("o", "", "Arquivo de saída (padrão: saída padrão)")
+	fs.StringVar(&dbPath, "db", "", "Arquivo do banco de histórico (padrão: o mesmo da TUI)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	err := func() error {
+		if *metrics == "" {
+			return fmt.Errorf("informe a série com --metric (veja a tecla Tab na tela de Histórico)")
+		}
+		if err := validAggregation(*agg); err != nil {
+			return err
+		}
+		if !validExportFormat(*format) {
+			return fmt.Errorf("formato desconhecido: %q (use %s)", *format, strings.Join(exportFormats, ", "))
+		}
+		now := time.Now()
+		start, err := parseExportTime(*from, now)
+		if err != nil {
+			return err
+		}
+		end, err := parseExportTime(*to, now)
+		if err != nil {
+			return err
+		}
+		if end.Before(start) {
+			return fmt.Errorf("--to (%s) é anterior a --from (%s)", end.Format(time.RFC3339), start.Format(time.RFC3339))
+		}
+		if *host == fleetHostKey && *step == 0 {
+			*step = time.Minute
+		}
+
+		if err := openHistoryForReading(); err != nil {
+			return err
+		}
+		defer closeDatabase()
+
+		var rows []ExportRow
+		for _, metric := range strings.Split(*metrics, ",") {
+			metric = strings.TrimSpace(metric)
+			records, err := store.Query(RangeQuery{Host: *host, Metric: metric, From: start, To: end, Step: *step, Agg: *agg})
+			if err != nil {
+				return err
+			}
+			for _, rec := range records {
+				rows = append(rows, ExportRow{Timestamp: rec.Timestamp, Host: *host, Metric: metric, Value: rec.Value})
+			}
+		}
+
+		if *output == "" {
+			err = writeExport(os.Stdout, *format, rows)
+		} else {
+			err = writeExportFile(*output, *format, rows)
+		}
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			fmt.Fprintf(os.Stderr, "Nenhum ponto de %s entre %s e %s\n", *metrics, start.Format("2006-01-02 15:04"), end.Format("2006-01-02 15:04"))
+		}
+		return nil
+	}()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "batedor export: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// writeExportFile grava a exportação em path. O erro de Close também conta:
+// é nele que aparece uma gravação que não coube no disco.
+func writeExportFile(path, format string, rows []ExportRow) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = writeExport(f, format, rows)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func validExportFormat(format string) bool {
+	for _, f := range exportFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// openHistoryForReading abre o banco local para os subcomandos, sem criar um
+// banco vazio quando ainda não há histórico.
+func openHistoryForReading() error {
+	path, err := resolveDBPath()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("nenhum histórico em %s (use --db)", path)
+	}
+	dbPath = path
+	return initDatabase()
+}
+
+// exportFileName monta o nome do arquivo exportado pela tela de Histórico.
+func exportFileName(metric, host string, now time.Time) string {
+	name := "batedor_" + metric
+	switch host {
+	case "":
+	case fleetHostKey:
+		name += "_todos"
+	default:
+		name += "_" + host
+	}
+	name = strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ' ' || r == ':' {
+			return '_'
+		}
+		return r
+	}, name)
+	return filepath.Clean(name + "_" + now.Format("20060102-150405") + ".csv")
+}
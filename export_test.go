@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseExportTime(t *testing.T) {
+	now := time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"now", now},
+		{"90m", now.Add(-90 * time.Minute)},
+		{"-24h", now.Add(-24 * time.Hour)},
+		{"2026-03-10T12:30:00-03:00", time.Date(2026, 3, 10, 15, 30, 0, 0, time.UTC)},
+		{"2026-03-10T21:00:00.5+05:30", time.Date(2026, 3, 10, 15, 30, 0, 5e8, time.UTC)},
+		{"2026-03-10 12:30", time.Date(2026, 3, 10, 12, 30, 0, 0, time.Local)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseExportTime(tt.value, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("parseExportTime(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+			if strings.Contains(tt.value, "T") && got.Location() != time.UTC {
+				t.Errorf("parseExportTime(%q) no fuso %v, want UTC", tt.value, got.Location())
+			}
+		})
+	}
+	if _, err := parseExportTime("ontem", now); err == nil {
+		t.Error("parseExportTime(\"ontem\") deveria falhar")
+	}
+}
+
+func TestRunExportLegacyDB(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	oldSystem, oldMigrate, oldPath := systemDBPath, migrateLegacyDB, dbPath
+	t.Cleanup(func() {
+		os.Chdir(wd)
+		systemDBPath, migrateLegacyDB, dbPath = oldSystem, oldMigrate, oldPath
+		store, stores, dbWriter, db, dbErr = nil, nil, nil, nil, nil
+	})
+	t.Setenv("XDG_DATA_HOME", filepath.Join(dir, "data"))
+	systemDBPath = filepath.Join(dir, "data", "batedor", "history.db")
+	migrateLegacyDB, dbPath = false, ""
+
+	legacy, err := openDatabase(legacyDBFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC)
+	var batches []HistoryBatch
+	for i := 0; i < 4; i++ {
+		batches = append(batches, HistoryBatch{Timestamp: base.Add(time.Duration(i) * time.Minute), Metrics: map[string]float64{"cpu_usage": float64(i)}})
+	}
+	if err := (&sqliteStore{db: legacy}).Write(batches); err != nil {
+		t.Fatal(err)
+	}
+	legacy.Close()
+
+	// Os limites em UTC-3 selecionam 15:01 e 15:02 UTC.
+	out := filepath.Join(dir, "saida.csv")
+	code := runExport([]string{"--metric", "cpu_usage", "--from", "2026-03-10T12:01:00-03:00", "--to", "2026-03-10T12:02:00-03:00", "-o", out})
+	if code != 0 {
+		t.Fatalf("runExport() = %d", code)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 || !strings.HasSuffix(lines[1], ",cpu_usage,1") || !strings.HasSuffix(lines[2], ",cpu_usage,2") {
+		t.Errorf("exportação =\n%s", data)
+	}
+
+	// A exportação lê o banco antigo onde está: não o copia nem o move.
+	if _, err := os.Stat(legacyDBFile); err != nil {
+		t.Errorf("o banco antigo não pode sumir: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "data")); !os.IsNotExist(err) {
+		t.Errorf("diretório de dados criado pela exportação: %v", err)
+	}
+
+	// Um -o que não pode ser criado é um erro.
+	store, stores, dbWriter = nil, nil, nil
+	if code := runExport([]string{"--metric", "cpu_usage", "-o", filepath.Join(dir, "nao", "existe.csv")}); code != 1 {
+		t.Errorf("runExport() com -o inválido = %d, want 1", code)
+	}
+}
@@ -0,0 +1,352 @@
+// /*********************************************************************************
+// * Projeto:     Batedor
+// * Componente:  FleetView - Frota de agentes remotos, com um resumo por host
+// *********************************************************************************/
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/gorilla/websocket"
+	"github.com/rivo/tview"
+)
+
+// fleetStaleAfter é quanto tempo sem dados até o agente ser considerado offline.
+const fleetStaleAfter = 5 * time.Second
+
+// fleetTLS são as opções de TLS das conexões com os agentes.
+var fleetTLS struct {
+	CAFile   string // Certificado (PEM) aceito além das autoridades do sistema.
+	Insecure bool   // Não verifica o certificado (ex.: --agent-tls-self-signed).
+}
+
+// fleetTLSConfig monta o TLS das conexões com os agentes a partir de
+// fleetTLS. Devolve nil sem opções: as URLs wss:// usam as autoridades do
+// sistema e os endereços sem esquema seguem em ws://.
+func fleetTLSConfig() (*tls.Config, error) {
+	if fleetTLS.CAFile == "" && !fleetTLS.Insecure {
+		return nil, nil
+	}
+	config := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: fleetTLS.Insecure}
+	if fleetTLS.CAFile != "" {
+		data, err := os.ReadFile(fleetTLS.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("%s: nenhum certificado PEM encontrado", fleetTLS.CAFile)
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
+
+// agentURL monta a URL WebSocket de um agente a partir de "host:porta"
+// (em wss:// quando secure) ou de uma URL completa (ws:// ou wss://), que
+// recebe agentPath se não tiver caminho.
+func agentURL(addr string, secure bool) string {
+	if strings.HasPrefix(addr, "ws://") || strings.HasPrefix(addr, "wss://") {
+		if u, err := url.Parse(addr); err == nil && (u.Path == "" || u.Path == "/") {
+			u.Path = agentPath
+			return u.String()
+		}
+		return addr
+	}
+	if secure {
+		return "wss://" + addr + agentPath
+	}
+	return "ws://" + addr + agentPath
+}
+
+// fleetHost é a conexão com um agente e a última coleta recebida dele.
+type fleetHost struct {
+	addr     string
+	url      string
+	token    string
+	dialer   *websocket.Dialer
+	stop     <-chan struct{} // Fechado por Fleet.Close.
+	mu       sync.RWMutex
+	last     *Snapshot
+	lastSeen time.Time
+	err      error
+}
+
+// run mantém a conexão com o agente, reconectando com espera crescente,
+// até a frota ser encerrada.
+func (h *fleetHost) run() {
+	backoff := time.Second
+	for {
+		err := h.stream()
+		h.mu.Lock()
+		h.err = err
+		h.mu.Unlock()
+
+		select {
+		case <-h.stop:
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+		if err == nil {
+			backoff = time.Second
+		}
+	}
+}
+
+// stream conecta ao agente e lê coletas até a conexão cair ou a frota ser
+// encerrada.
+func (h *fleetHost) stream() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-h.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+h.token)
+	conn, resp, err := h.dialer.DialContext(ctx, h.url, header)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusUnauthorized {
+			return fmt.Errorf("token recusado pelo agente")
+		}
+		return err
+	}
+	defer conn.Close()
+	go func() {
+		// Interrompe a leitura em andamento quando a frota é encerrada.
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(fleetStaleAfter * 2))
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		var snap Snapshot
+		if err := json.Unmarshal(data, &snap); err != nil {
+			return fmt.Errorf("coleta inválida: %v", err)
+		}
+		h.mu.Lock()
+		h.last = &snap
+		h.lastSeen = time.Now()
+		h.err = nil
+		h.mu.Unlock()
+	}
+}
+
+// FleetHostStatus é o resumo de um agente exibido na tela de frota.
+type FleetHostStatus struct {
+	Addr     string
+	Online   bool
+	LastSeen time.Time
+	Err      error
+	Snap     *Snapshot // Última coleta recebida; nil se nunca conectou.
+}
+
+// Hostname devolve o nome informado pelo agente ou, sem ele, o endereço.
+func (s FleetHostStatus) Hostname() string {
+	if s.Snap != nil && s.Snap.Host != nil && s.Snap.Host.Hostname != "" {
+		return s.Snap.Host.Hostname
+	}
+	return s.Addr
+}
+
+// Fleet acompanha vários agentes remotos.
+type Fleet struct {
+	hosts []*fleetHost
+	stop  chan struct{}
+	once  sync.Once
+	wg    sync.WaitGroup
+}
+
+// NewFleet cria a frota e inicia a conexão com cada agente. Com tlsConfig,
+// os endereços sem esquema usam wss:// e o certificado é conferido por ele.
+func NewFleet(addrs []string, tlsConfig *tls.Config) *Fleet {
+	dialer := &websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: 10 * time.Second,
+		TLSClientConfig:  tlsConfig,
+	}
+	f := &Fleet{stop: make(chan struct{})}
+	for _, addr := range addrs {
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			continue
+		}
+		h := &fleetHost{addr: addr, url: agentURL(addr, tlsConfig != nil), token: agentToken, dialer: dialer, stop: f.stop}
+		f.hosts = append(f.hosts, h)
+		f.wg.Add(1)
+		go func() {
+			defer f.wg.Done()
+			h.run()
+		}()
+	}
+	return f
+}
+
+// Close encerra as conexões com os agentes e espera as goroutines de cada
+// um terminarem. A última coleta de cada agente continua disponível.
+func (f *Fleet) Close() {
+	if f == nil {
+		return
+	}
+	f.once.Do(func() { close(f.stop) })
+	f.wg.Wait()
+}
+
+// Status devolve o resumo de todos os agentes, na ordem da linha de comando.
+func (f *Fleet) Status() []FleetHostStatus {
+	if f == nil {
+		return nil
+	}
+	list := make([]FleetHostStatus, 0, len(f.hosts))
+	for _, h := range f.hosts {
+		h.mu.RLock()
+		list = append(list, FleetHostStatus{
+			Addr:     h.addr,
+			Online:   h.last != nil && time.Since(h.lastSeen) < fleetStaleAfter,
+			LastSeen: h.lastSeen,
+			Err:      h.err,
+			Snap:     h.last,
+		})
+		h.mu.RUnlock()
+	}
+	return list
+}
+
+// Latest devolve a última coleta de um agente (ainda que antiga) e se ele
+// está online.
+func (f *Fleet) Latest(addr string) (*Snapshot, bool) {
+	for _, s := range f.Status() {
+		if s.Addr == addr {
+			return s.Snap, s.Online
+		}
+	}
+	return nil, false
+}
+
+// FleetView é a tela de frota: uma linha por host, com o host local no topo.
+// Enter passa a exibir o host escolhido nos widgets da tela principal.
+type FleetView struct {
+	*tview.Table
+	mu      sync.RWMutex
+	local   *Snapshot
+	hosts   []FleetHostStatus
+	current string // Endereço exibido na tela principal; "" é o host local.
+}
+
+// NewFleetView cria a tela de frota.
+func NewFleetView() *FleetView {
+	v := &FleetView{Table: tview.NewTable().SetSelectable(true, false).SetFixed(1, 0)}
+	v.SetBorder(true).SetTitle(tview.Escape(" Frota | [Enter] Exibir o host na tela principal | [Q] Voltar "))
+	return v
+}
+
+// Update atualiza o host local, os agentes e qual deles está em exibição.
+func (v *FleetView) Update(local *Snapshot, hosts []FleetHostStatus, current string) {
+	v.mu.Lock()
+	v.local = local
+	v.hosts = hosts
+	v.current = current
+	v.mu.Unlock()
+	v.refresh()
+}
+
+// Selected devolve o endereço da linha selecionada ("" para o host local).
+func (v *FleetView) Selected() (string, bool) {
+	row, _ := v.GetSelection()
+	addr, ok := v.GetCell(row, 0).GetReference().(string)
+	return addr, ok && row > 0
+}
+
+// fleetRow preenche uma linha da tabela com o resumo de uma coleta.
+func (v *FleetView) fleetRow(row int, ref, name, status string, statusColor tcell.Color, snap *Snapshot) {
+	marker := "  "
+	if ref == v.current {
+		marker = "▶ "
+	}
+	v.SetCell(row, 0, tview.NewTableCell(marker+name).SetTextColor(tcell.ColorWhite).SetReference(ref).SetExpansion(1))
+	v.SetCell(row, 1, tview.NewTableCell(status).SetTextColor(statusColor).SetMaxWidth(40))
+	if snap == nil {
+		for col := 2; col <= 7; col++ {
+			v.SetCell(row, col, tview.NewTableCell("-").SetAlign(tview.AlignRight))
+		}
+		return
+	}
+	disk := "-"
+	if snap.Disk != nil {
+		disk = fmt.Sprintf("%.1f", snap.Disk.UsedPercent)
+	}
+	alertColor := tcell.ColorGreen
+	if len(snap.Alerts) > 0 {
+		alertColor = tcell.ColorRed
+	}
+	v.SetCell(row, 2, tview.NewTableCell(fmt.Sprintf("%.1f", snap.CPUUsage)).SetTextColor(tcell.ColorGreen).SetAlign(tview.AlignRight))
+	v.SetCell(row, 3, tview.NewTableCell(fmt.Sprintf("%.1f", snap.MemUsedPercent())).SetTextColor(tcell.ColorGreen).SetAlign(tview.AlignRight))
+	v.SetCell(row, 4, tview.NewTableCell(disk).SetTextColor(tcell.ColorGreen).SetAlign(tview.AlignRight))
+	v.SetCell(row, 5, tview.NewTableCell(formatBytes(snap.Net.DownloadRate)).SetTextColor(tcell.ColorWhite).SetAlign(tview.AlignRight))
+	v.SetCell(row, 6, tview.NewTableCell(formatBytes(snap.Net.UploadRate)).SetTextColor(tcell.ColorWhite).SetAlign(tview.AlignRight))
+	v.SetCell(row, 7, tview.NewTableCell(fmt.Sprintf("%d", len(snap.Alerts))).SetTextColor(alertColor).SetAlign(tview.AlignRight))
+}
+
+// refresh redesenha a tabela com os dados atuais.
+func (v *FleetView) refresh() {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	v.Clear()
+	headers := []string{"Host", "Estado", "CPU%", "MEM%", "Disco%", "Rede ↓/s", "Rede ↑/s", "Alertas"}
+	for i, header := range headers {
+		v.SetCell(0, i, tview.NewTableCell(header).SetTextColor(tcell.ColorYellow).SetSelectable(false))
+	}
+
+	localName := "local"
+	if v.local != nil && v.local.Host != nil {
+		localName = v.local.Host.Hostname + " (local)"
+	}
+	v.fleetRow(1, "", localName, "local", tcell.ColorGreen, v.local)
+
+	for i, h := range v.hosts {
+		name := h.Hostname()
+		if name != h.Addr {
+			name += " (" + h.Addr + ")"
+		}
+		status, color := "online", tcell.ColorGreen
+		if !h.Online {
+			status, color = "offline", tcell.ColorRed
+			if h.Err != nil {
+				status += ": " + h.Err.Error()
+			} else if !h.LastSeen.IsZero() {
+				status += " desde " + h.LastSeen.Format("15:04:05")
+			}
+		}
+		v.fleetRow(i+2, h.Addr, name, status, color, h.Snap)
+	}
+
+	if len(v.hosts) == 0 {
+		v.SetCell(3, 0, tview.NewTableCell("Nenhum agente configurado. Use --fleet host1:9091,host2:9091 e --agent-token.").SetSelectable(false))
+	}
+}
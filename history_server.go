@@ -0,0 +1,483 @@
+// /*********************************************************************************
+// * Projeto:     Batedor
+// * Componente:  Servidor de Histórico - Agrega o histórico de vários agentes
+// *********************************************************************************/
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// samplesPath é a rota que recebe as amostras enviadas pelos agentes.
+const samplesPath = "/api/samples"
+
+// HistoryBatch é uma amostra de histórico de um host: as métricas de um
+// instante e os processos que mais consumiam recursos nele.
+type HistoryBatch struct {
+	Host      string
+	Timestamp time.Time
+	Metrics   map[string]float64
+	Procs     []ProcData
+}
+
+// newHistoryBatch monta a amostra de histórico de uma coleta.
+func newHistoryBatch(host string, ts time.Time, snap *Snapshot) HistoryBatch {
+	return HistoryBatch{
+		Host:      host,
+		Timestamp: ts,
+		Metrics:   snap.Metrics(),
+		Procs:     topProcesses(snap.Procs, topProcessCount),
+	}
+}
+
+// snapshotHostname devolve o hostname informado na coleta.
+func snapshotHostname(snap *Snapshot) string {
+	if snap.Host != nil {
+		return snap.Host.Hostname
+	}
+	return ""
+}
+
+// historySource é de onde o HistoryGraph e a API lêem o histórico: o banco
+// local ou um servidor de histórico remoto (--history-url).
+type historySource interface {
+	Hosts() ([]string, error)
+	MetricNames() ([]string, error)
+	Metrics(host, metric string) ([]MetricRecord, error)
+	TopProcessesAt(host string, ts time.Time, window time.Duration) ([]ProcessRecord, error)
+}
+
+// history é a fonte usada pela TUI e pelo dashboard web.
+var history historySource = localHistory{}
+
+// localHistory lê o histórico do armazenamento local (veja store).
+type localHistory struct{}
+
+func (localHistory) Hosts() ([]string, error) {
+	if store == nil {
+		return nil, errNoStore()
+	}
+	series, err := store.Series()
+	return seriesHosts(series), err
+}
+
+func (localHistory) MetricNames() ([]string, error) {
+	if store == nil {
+		return nil, errNoStore()
+	}
+	series, err := store.Series()
+	return seriesMetrics(series), err
+}
+
+// Metrics devolve as últimas 24 horas da série. Com host igual a
+// fleetHostKey, devolve a média por minuto entre todos os hosts.
+func (localHistory) Metrics(host, metric string) ([]MetricRecord, error) {
+	if store == nil {
+		return nil, errNoStore()
+	}
+	now := time.Now()
+	q := RangeQuery{Host: host, Metric: metric, From: now.Add(-24 * time.Hour), To: now}
+	if host == fleetHostKey {
+		q.Step, q.Agg = time.Minute, "avg"
+	}
+	return store.Query(q)
+}
+
+func (localHistory) TopProcessesAt(host string, ts time.Time, window time.Duration) ([]ProcessRecord, error) {
+	ps, ok := store.(processStore)
+	if !ok {
+		return nil, errNoStore()
+	}
+	return ps.TopProcessesAt(host, ts, window)
+}
+
+// remoteHistory lê o histórico da API de um servidor de histórico.
+type remoteHistory struct {
+	base   string
+	client *http.Client
+}
+
+// newRemoteHistory lê do servidor em base; tlsConfig vem de fleetTLSConfig.
+func newRemoteHistory(base string, tlsConfig *tls.Config) remoteHistory {
+	return remoteHistory{base: historyServerURL(base, tlsConfig != nil), client: historyClient(5*time.Second, tlsConfig)}
+}
+
+// historyServerURL completa o endereço do servidor de histórico: sem
+// esquema, usa https:// quando secure (há TLS configurado para os clientes)
+// e http:// caso contrário. Em http:// fora do localhost, avisa que o token
+// trafega às claras.
+func historyServerURL(base string, secure bool) string {
+	base = strings.TrimRight(base, "/")
+	if !strings.HasPrefix(base, "http://") && !strings.HasPrefix(base, "https://") {
+		if secure {
+			base = "https://" + base
+		} else {
+			base = "http://" + base
+		}
+	}
+	if u, err := url.Parse(base); err == nil && u.Scheme == "http" && !isLoopback(hostWithPort(u)) {
+		log.Printf("Atenção: o servidor de histórico %s é acessado sem TLS; o token e as amostras trafegam às claras (use https:// ou --fleet-tls-ca)", base)
+	}
+	return base
+}
+
+// hostWithPort devolve host:porta de uma URL, com a porta padrão do esquema.
+func hostWithPort(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	if u.Scheme == "https" {
+		return net.JoinHostPort(u.Hostname(), "443")
+	}
+	return net.JoinHostPort(u.Hostname(), "80")
+}
+
+// historyClient cria o cliente HTTP das conexões com o servidor de histórico.
+func historyClient(timeout time.Duration, tlsConfig *tls.Config) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// get faz um GET autenticado na API e decodifica a resposta JSON em out.
+func (r remoteHistory) get(path string, query url.Values, out interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, r.base+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+agentToken)
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("servidor de histórico respondeu %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (r remoteHistory) Hosts() ([]string, error) {
+	var hosts []string
+	return hosts, r.get("/api/hosts", nil, &hosts)
+}
+
+func (r remoteHistory) MetricNames() ([]string, error) {
+	var names []string
+	return names, r.get("/api/metrics", nil, &names)
+}
+
+func (r remoteHistory) Metrics(host, metric string) ([]MetricRecord, error) {
+	var records []MetricRecord
+	return records, r.get("/api/history", url.Values{"host": {host}, "metric": {metric}}, &records)
+}
+
+func (r remoteHistory) TopProcessesAt(host string, ts time.Time, window time.Duration) ([]ProcessRecord, error) {
+	var records []ProcessRecord
+	query := url.Values{"host": {host}, "ts": {ts.Format(time.RFC3339Nano)}, "window": {window.String()}}
+	return records, r.get("/api/processes", query, &records)
+}
+
+// writeJSON responde com v em JSON.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Falha ao responder: %v", err)
+	}
+}
+
+// requireToken recusa requisições sem o token Bearer esperado. Com token
+// vazio, a rota fica aberta.
+func requireToken(token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token != "" && !tokenMatches(bearerToken(r), token) {
+			http.Error(w, "token inválido", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// registerHistoryAPI registra as rotas de leitura do histórico. O parâmetro
+// host vazio é o host local e "*" é a média de todos os hosts.
+func registerHistoryAPI(mux *http.ServeMux, src historySource, token string) {
+	mux.HandleFunc("/api/hosts", requireToken(token, func(w http.ResponseWriter, r *http.Request) {
+		hosts, err := src.Hosts()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, hosts)
+	}))
+	mux.HandleFunc("/api/metrics", requireToken(token, func(w http.ResponseWriter, r *http.Request) {
+		names, err := src.MetricNames()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if r.URL.Query().Get("info") == "" {
+			writeJSON(w, names)
+			return
+		}
+		// Com ?info=1, devolve também o rótulo e a unidade de cada série.
+		type seriesInfo struct {
+			Name, Label, Unit string
+		}
+		infos := make([]seriesInfo, len(names))
+		for i, name := range names {
+			info := metricInfo(name)
+			infos[i] = seriesInfo{Name: name, Label: info.Label, Unit: info.Unit}
+		}
+		writeJSON(w, infos)
+	}))
+	mux.HandleFunc("/api/history", requireToken(token, func(w http.ResponseWriter, r *http.Request) {
+		metric := r.URL.Query().Get("metric")
+		if metric == "" {
+			http.Error(w, "parâmetro metric obrigatório", http.StatusBadRequest)
+			return
+		}
+		records, err := src.Metrics(r.URL.Query().Get("host"), metric)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, records)
+	}))
+	// Estado da fila de gravação do banco local: linhas pendentes, gravadas,
+	// descartadas e a última falha.
+	mux.HandleFunc("/api/db", requireToken(token, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, dbWriter.Stats())
+	}))
+	mux.HandleFunc("/api/processes", requireToken(token, func(w http.ResponseWriter, r *http.Request) {
+		ts, err := time.Parse(time.RFC3339Nano, r.URL.Query().Get("ts"))
+		if err != nil {
+			http.Error(w, "parâmetro ts inválido (use RFC 3339)", http.StatusBadRequest)
+			return
+		}
+		window := historyProcessWindow
+		if v := r.URL.Query().Get("window"); v != "" {
+			if window, err = time.ParseDuration(v); err != nil {
+				http.Error(w, "parâmetro window inválido", http.StatusBadRequest)
+				return
+			}
+		}
+		records, err := src.TopProcessesAt(r.URL.Query().Get("host"), ts, window)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, records)
+	}))
+}
+
+// historyServerHandler monta as rotas do servidor de histórico: o envio das
+// amostras dos agentes e a API de leitura.
+func historyServerHandler(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(samplesPath, requireToken(token, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "use POST", http.StatusMethodNotAllowed)
+			return
+		}
+		var batch HistoryBatch
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&batch); err != nil {
+			http.Error(w, "amostra inválida: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if batch.Host == "" || batch.Host == fleetHostKey {
+			http.Error(w, "amostra sem host", http.StatusBadRequest)
+			return
+		}
+		// Cada agente envia o instante no próprio fuso; todos são gravados em UTC.
+		batch.Timestamp = batch.Timestamp.UTC()
+		// A amostra é gravada em segundo plano; com a fila cheia, o agente
+		// recebe 503 e a mantém na sua própria fila para reenviar.
+		if err := storeHistoryBatch(batch); err != nil {
+			log.Printf("Servidor de histórico: amostra de %s recusada: %v", batch.Host, err)
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	registerHistoryAPI(mux, localHistory{}, token)
+	return mux
+}
+
+// runHistoryServer executa o Batedor sem TUI, gravando as amostras enviadas
+// pelos agentes (--push) e servindo o histórico de todos eles. O TLS usa as
+// mesmas opções do agente (--agent-tls-*), pois protege o mesmo token.
+func runHistoryServer(addr string) error {
+	if agentToken == "" {
+		return fmt.Errorf("o servidor de histórico exige --agent-token (ou BATEDOR_AGENT_TOKEN)")
+	}
+	tlsConfig, err := serverTLSConfig(addr, agentTLS.CertFile, agentTLS.KeyFile, agentTLS.SelfSigned)
+	if err != nil {
+		return fmt.Errorf("TLS do servidor de histórico: %v", err)
+	}
+	if err := initDatabase(); err != nil {
+		return fmt.Errorf("falha ao inicializar banco de dados: %v", err)
+	}
+
+	// Ao receber SIGINT ou SIGTERM, para de aceitar amostras e grava as que
+	// ainda estão na fila antes de sair.
+	srv := &http.Server{Addr: addr, Handler: historyServerHandler(agentToken), TLSConfig: tlsConfig}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}()
+
+	if tlsConfig != nil {
+		log.Printf("Servidor de histórico do Batedor em https://%s (amostras em %s)", addr, samplesPath)
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		if !isLoopback(addr) {
+			log.Printf("Atenção: o servidor de histórico escuta em %s sem TLS; o token e as amostras trafegam às claras (use --agent-tls-cert/--agent-tls-key ou --agent-tls-self-signed)", addr)
+		}
+		log.Printf("Servidor de histórico do Batedor em http://%s (amostras em %s)", addr, samplesPath)
+		err = srv.ListenAndServe()
+	}
+	if err == http.ErrServerClosed {
+		err = nil
+	}
+	closeDatabase()
+	if err == nil {
+		log.Printf("Servidor de histórico encerrado")
+	}
+	return err
+}
+
+// historyPushQueue é quantas amostras aguardam envio enquanto o servidor
+// está fora do ar; as mais antigas são descartadas primeiro.
+const historyPushQueue = 60
+
+// historyPushRetry é a primeira espera antes de reenviar; ela dobra a cada
+// falha, até um minuto.
+const historyPushRetry = time.Second
+
+// historyPush envia o histórico ao servidor central (--push); nil desativa.
+var historyPush *historyPusher
+
+// historyPusher envia as amostras de histórico para um servidor central.
+type historyPusher struct {
+	url    string
+	token  string
+	client *http.Client
+	retry  time.Duration // Primeira espera depois de uma falha.
+	mu     sync.Mutex
+	queue  []HistoryBatch
+	wake   chan struct{}
+}
+
+// newHistoryPusher cria o envio para o servidor em base e inicia a fila.
+// tlsConfig vem de fleetTLSConfig; com ele, endereços sem esquema usam
+// https://.
+func newHistoryPusher(base string, tlsConfig *tls.Config) *historyPusher {
+	p := &historyPusher{
+		url:    historyServerURL(base, tlsConfig != nil) + samplesPath,
+		token:  agentToken,
+		client: historyClient(10*time.Second, tlsConfig),
+		retry:  historyPushRetry,
+		wake:   make(chan struct{}, 1),
+	}
+	go p.run()
+	return p
+}
+
+// Push enfileira uma amostra sem bloquear a coleta.
+func (p *historyPusher) Push(b HistoryBatch) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	if len(p.queue) >= historyPushQueue {
+		p.queue = p.queue[1:]
+	}
+	p.queue = append(p.queue, b)
+	p.mu.Unlock()
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run envia as amostras na ordem, tentando de novo com espera crescente
+// enquanto o servidor recusar ou estiver inacessível.
+func (p *historyPusher) run() {
+	backoff := p.retry
+	for range p.wake {
+		for {
+			p.mu.Lock()
+			if len(p.queue) == 0 {
+				p.mu.Unlock()
+				break
+			}
+			b := p.queue[0]
+			p.mu.Unlock()
+
+			if err := p.send(b); err != nil {
+				log.Printf("Falha ao enviar histórico para %s: %v", p.url, err)
+				time.Sleep(backoff)
+				if backoff < time.Minute {
+					backoff *= 2
+				}
+				continue
+			}
+			backoff = p.retry
+
+			p.mu.Lock()
+			if len(p.queue) > 0 && p.queue[0].Timestamp.Equal(b.Timestamp) {
+				p.queue = p.queue[1:]
+			}
+			p.mu.Unlock()
+		}
+	}
+}
+
+// send faz o POST de uma amostra.
+func (p *historyPusher) send(b HistoryBatch) error {
+	data, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, p.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+p.token)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("token recusado pelo servidor")
+	}
+	if resp.StatusCode == http.StatusBadRequest {
+		// Repetir não adianta: a amostra é descartada para não travar a fila.
+		log.Printf("Amostra de histórico de %s recusada pelo servidor e descartada", b.Timestamp.Format(time.RFC3339))
+		return nil
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("servidor respondeu %s", resp.Status)
+	}
+	return nil
+}
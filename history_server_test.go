@@ -0,0 +1,258 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// useTestWriter troca dbWriter por uma fila sem goroutine sobre s.
+func useTestWriter(t *testing.T, s Store) *historyWriter {
+	t.Helper()
+	w := newManualWriter(s)
+	old := dbWriter
+	dbWriter = historyWriters{w}
+	t.Cleanup(func() { dbWriter = old })
+	return w
+}
+
+func TestStoreHistoryBatch(t *testing.T) {
+	old := dbWriter
+	dbWriter = nil
+	err := storeHistoryBatch(testBatch("srv1", 1))
+	dbWriter = old
+	if err == nil {
+		t.Error("storeHistoryBatch() sem armazenamento deveria falhar")
+	}
+
+	s := &fakeStore{}
+	w := useTestWriter(t, s)
+	if err := storeHistoryBatch(testBatch("srv1", 3)); err != nil {
+		t.Fatal(err)
+	}
+	w.flush()
+	if got := s.written(); len(got) != 1 || got[0].Host != "srv1" || len(got[0].Metrics) != 3 {
+		t.Errorf("gravado = %+v", got)
+	}
+}
+
+func TestHistoryServerSamples(t *testing.T) {
+	s := &fakeStore{}
+	w := useTestWriter(t, s)
+	srv := httptest.NewServer(historyServerHandler("segredo"))
+	t.Cleanup(srv.Close)
+
+	post := func(token, body string) int {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+samplesPath, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	sample := `{"Host":"srv1","Timestamp":"2026-03-10T12:00:00-03:00","Metrics":{"cpu_usage":12}}`
+
+	tests := []struct {
+		name  string
+		token string
+		body  string
+		want  int
+	}{
+		{"sem token", "", sample, http.StatusUnauthorized},
+		{"token errado", "outro", sample, http.StatusUnauthorized},
+		{"JSON inválido", "segredo", `{"Host":`, http.StatusBadRequest},
+		{"sem host", "segredo", `{"Metrics":{"cpu_usage":1}}`, http.StatusBadRequest},
+		{"host da frota", "segredo", `{"Host":"*","Metrics":{"cpu_usage":1}}`, http.StatusBadRequest},
+		{"aceita", "segredo", sample, http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := post(tt.token, tt.body); got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	resp, err := http.Get(srv.URL + samplesPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized && resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET sem token = %d", resp.StatusCode)
+	}
+
+	w.flush()
+	got := s.written()
+	if len(got) != 1 {
+		t.Fatalf("%d amostras gravadas, want 1", len(got))
+	}
+	if want := time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC); !got[0].Timestamp.Equal(want) || got[0].Timestamp.Location() != time.UTC {
+		t.Errorf("instante gravado = %v, want %v em UTC", got[0].Timestamp, want)
+	}
+
+	// Com a fila cheia, o agente recebe 503 e reenvia depois.
+	for w.Stats().QueuedRows < writerMaxRows {
+		w.Enqueue(testBatch("srv2", 1000))
+	}
+	if got := post("segredo", sample); got != http.StatusServiceUnavailable {
+		t.Errorf("com a fila cheia = %d, want 503", got)
+	}
+}
+
+func TestLocalHistoryFleetAverage(t *testing.T) {
+	m := newMemoryStore(100)
+	old := store
+	store = m
+	t.Cleanup(func() { store = old })
+
+	now := time.Now().Truncate(time.Minute)
+	m.Write([]HistoryBatch{
+		{Host: "srv1", Timestamp: now.Add(-2*time.Minute + time.Second), Metrics: map[string]float64{"cpu_usage": 10}},
+		{Host: "srv2", Timestamp: now.Add(-2*time.Minute + 20*time.Second), Metrics: map[string]float64{"cpu_usage": 30}},
+		{Host: "srv1", Timestamp: now.Add(-time.Minute + time.Second), Metrics: map[string]float64{"cpu_usage": 50}},
+	})
+
+	records, err := localHistory{}.Metrics(fleetHostKey, "cpu_usage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Value != 20 || records[1].Value != 50 {
+		t.Fatalf("média da frota = %+v, want 20 e 50", records)
+	}
+	if !records[0].Timestamp.Equal(now.Add(-2 * time.Minute)) {
+		t.Errorf("instante do primeiro ponto = %v, want o início do minuto", records[0].Timestamp)
+	}
+	hosts, err := localHistory{}.Hosts()
+	if err != nil || strings.Join(hosts, ",") != "srv1,srv2" {
+		t.Errorf("Hosts() = %v, %v", hosts, err)
+	}
+}
+
+// pushServer responde às amostras com os status de statuses, em ordem, e
+// depois com 202.
+type pushServer struct {
+	mu       sync.Mutex
+	statuses []int
+	received []HistoryBatch
+	auth     []string
+}
+
+func (s *pushServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var b HistoryBatch
+	json.NewDecoder(r.Body).Decode(&b)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.auth = append(s.auth, r.Header.Get("Authorization"))
+	status := http.StatusAccepted
+	if len(s.statuses) > 0 {
+		status, s.statuses = s.statuses[0], s.statuses[1:]
+	}
+	if status == http.StatusAccepted {
+		s.received = append(s.received, b)
+	}
+	w.WriteHeader(status)
+}
+
+func (s *pushServer) hosts() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hosts := make([]string, len(s.received))
+	for i, b := range s.received {
+		hosts[i] = b.Host
+	}
+	return hosts
+}
+
+// startTestPusher cria o envio sem iniciar a goroutine, com espera curta.
+func startTestPusher(t *testing.T, url string, client *http.Client) *historyPusher {
+	t.Helper()
+	p := &historyPusher{url: url + samplesPath, token: "segredo", client: client, retry: time.Millisecond, wake: make(chan struct{}, 1)}
+	return p
+}
+
+func waitHosts(t *testing.T, s *pushServer, want string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for strings.Join(s.hosts(), ",") != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("amostras recebidas = %v, want %s", s.hosts(), want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestHistoryPusherRetryAndDrop(t *testing.T) {
+	// Duas falhas temporárias, depois uma amostra recusada (400), que é
+	// descartada para não travar a fila.
+	s := &pushServer{statuses: []int{http.StatusServiceUnavailable, http.StatusInternalServerError, http.StatusAccepted, http.StatusBadRequest}}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+
+	p := startTestPusher(t, srv.URL, srv.Client())
+	p.Push(HistoryBatch{Host: "a", Timestamp: time.Unix(1, 0)})
+	p.Push(HistoryBatch{Host: "b", Timestamp: time.Unix(2, 0)})
+	p.Push(HistoryBatch{Host: "c", Timestamp: time.Unix(3, 0)})
+	go p.run()
+	t.Cleanup(func() { close(p.wake) })
+
+	waitHosts(t, s, "a,c")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, auth := range s.auth {
+		if auth != "Bearer segredo" {
+			t.Errorf("Authorization = %q", auth)
+		}
+	}
+}
+
+func TestHistoryPusherQueueLimit(t *testing.T) {
+	p := startTestPusher(t, "http://127.0.0.1:1", http.DefaultClient)
+	for i := 0; i < historyPushQueue+5; i++ {
+		p.Push(HistoryBatch{Host: "a", Timestamp: time.Unix(int64(i), 0)})
+	}
+	if len(p.queue) != historyPushQueue || p.queue[0].Timestamp.Unix() != 5 {
+		t.Errorf("fila com %d amostras a partir de %v, want %d a partir de 5", len(p.queue), p.queue[0].Timestamp.Unix(), historyPushQueue)
+	}
+	var nilPusher *historyPusher
+	nilPusher.Push(HistoryBatch{}) // Sem --push, não faz nada.
+}
+
+func TestHistoryPusherTLS(t *testing.T) {
+	s := &pushServer{}
+	srv := httptest.NewTLSServer(s)
+	t.Cleanup(srv.Close)
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+
+	oldToken := agentToken
+	agentToken = "segredo"
+	t.Cleanup(func() { agentToken = oldToken })
+
+	// Sem esquema e com TLS configurado, o endereço usa https://.
+	addr := strings.TrimPrefix(srv.URL, "https://")
+	p := newHistoryPusher(addr, &tls.Config{RootCAs: pool})
+	t.Cleanup(func() { close(p.wake) })
+	if !strings.HasPrefix(p.url, "https://") {
+		t.Fatalf("url = %s, want https://", p.url)
+	}
+	p.Push(HistoryBatch{Host: "tls", Timestamp: time.Unix(1, 0)})
+	waitHosts(t, s, "tls")
+
+	if got := historyServerURL("central:9092", false); got != "http://central:9092" {
+		t.Errorf("historyServerURL sem TLS = %s", got)
+	}
+	if got := historyServerURL("http://central:9092/", true); got != "http://central:9092" {
+		t.Errorf("historyServerURL com esquema = %s", got)
+	}
+}
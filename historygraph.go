@@ -6,7 +6,12 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
@@ -17,15 +22,29 @@ type HistoryGraph struct {
 	*tview.Box
 	mu         sync.RWMutex
 	data       []MetricRecord
-	metricName string
+	metric     string   // Série exibida (nome gravado no banco).
+	series     []string // Séries disponíveis no banco, para [Tab].
+	host       string   // Host exibido: "" é o local e fleetHostKey a média de todos.
+	hosts      []string // Hosts com histórico, para [O].
 	maxVal     float64
 	minVal     float64
+	cursor     int             // Índice do ponto selecionado em data (-1 = sem cursor).
+	lastWidth  int             // Largura útil do gráfico no último Draw, usada para o passo do cursor.
+	topProcs   []ProcessRecord // Maiores consumidores no ponto do cursor.
+	err        error           // Falha ao ler o histórico, exibida no lugar do gráfico.
+	notice     string          // Resultado da última exportação ([E]).
+	noticeErr  bool            // notice é uma falha (em vermelho).
 }
 
+// historyProcessWindow é a distância máxima entre o ponto do cursor e a
+// amostra de processos usada para exibi-lo.
+const historyProcessWindow = 2 * time.Minute
+
 func NewHistoryGraph() *HistoryGraph {
 	return &HistoryGraph{
-		Box:        tview.NewBox().SetBorder(true),
-		metricName: "CPU",
+		Box:    tview.NewBox().SetBorder(true),
+		metric: "cpu_usage",
+		cursor: -1,
 	}
 }
 
@@ -34,20 +53,29 @@ func (h *HistoryGraph) LoadData() {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	metricToFetch := "cpu_usage"
-	if h.metricName == "Memória" {
-		metricToFetch = "mem_usage"
+	if names, err := history.MetricNames(); err == nil {
+		h.series = names
+	}
+	if hosts, err := history.Hosts(); err == nil {
+		h.hosts = hosts
+		if len(hosts) > 1 {
+			h.hosts = append(h.hosts, fleetHostKey)
+		}
 	}
 
-	data, err := getMetricsForLast24h(metricToFetch)
+	h.cursor = -1
+	h.topProcs = nil
+	h.notice, h.noticeErr = "", false
+	// MUDANÇA: O texto aqui foi simplificado e corrigido.
+	h.SetTitle(tview.Escape(fmt.Sprintf(" Histórico de %s em %s (Últimas 24h) | [C]/[M] CPU/Memória | [Tab] Outras séries | [O] Outro host | [←]/[→] Cursor | [E] Exportar | [Q] Sair ", metricInfo(h.metric).Label, historyHostLabel(h.host))))
+
+	data, err := history.Metrics(h.host, h.metric)
+	h.err = err
 	if err != nil {
 		h.data = []MetricRecord{}
 		return
 	}
-
 	h.data = data
-	// MUDANÇA: O texto aqui foi simplificado e corrigido.
-	h.SetTitle(fmt.Sprintf(" Histórico de Uso de %s (Últimas 24h) | [C]/[M] Trocar | [Q] Sair ", h.metricName))
 
 	if len(h.data) > 0 {
 		h.maxVal = h.data[0].Value
@@ -66,32 +94,240 @@ func (h *HistoryGraph) LoadData() {
 	}
 }
 
-// ToggleMetric alterna entre CPU e Memória.
-func (h *HistoryGraph) ToggleMetric() {
+// SetMetric troca a série exibida.
+func (h *HistoryGraph) SetMetric(name string) {
 	h.mu.Lock()
-	if h.metricName == "CPU" {
-		h.metricName = "Memória"
-	} else {
-		h.metricName = "CPU"
+	h.metric = name
+	h.mu.Unlock()
+	h.LoadData()
+}
+
+// NextMetric avança (ou volta, com delta negativo) para outra série gravada.
+func (h *HistoryGraph) NextMetric(delta int) {
+	h.mu.Lock()
+	if len(h.series) == 0 {
+		h.mu.Unlock()
+		return
+	}
+	idx := 0
+	for i, name := range h.series {
+		if name == h.metric {
+			idx = i
+			break
+		}
+	}
+	idx = (idx + delta + len(h.series)) % len(h.series)
+	h.metric = h.series[idx]
+	h.mu.Unlock()
+	h.LoadData()
+}
+
+// NextHost alterna entre os hosts com histórico e a média de todos eles.
+func (h *HistoryGraph) NextHost() {
+	h.mu.Lock()
+	if len(h.hosts) == 0 {
+		h.mu.Unlock()
+		return
+	}
+	idx := -1
+	for i, host := range h.hosts {
+		if host == h.host {
+			idx = i
+			break
+		}
 	}
+	h.host = h.hosts[(idx+1)%len(h.hosts)]
 	h.mu.Unlock()
 	h.LoadData()
 }
 
+// historyHostLabel devolve o nome exibido para um host do histórico.
+func historyHostLabel(host string) string {
+	switch host {
+	case "":
+		return "host local"
+	case fleetHostKey:
+		return "todos os hosts (média)"
+	}
+	return host
+}
+
+// isMemoryMetric indica se a série é de memória (para ordenar o painel de processos).
+func isMemoryMetric(name string) bool {
+	return strings.HasPrefix(name, "mem_") || strings.HasPrefix(name, "swap_") || strings.HasPrefix(name, "psi_memory")
+}
+
+// Export grava a série exibida em um CSV no diretório atual e mostra o
+// nome do arquivo (ou o erro) no topo do gráfico.
+func (h *HistoryGraph) Export() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.data) == 0 {
+		h.notice, h.noticeErr = "Nada para exportar.", true
+		return
+	}
+	rows := make([]ExportRow, len(h.data))
+	for i, rec := range h.data {
+		rows[i] = ExportRow{Timestamp: rec.Timestamp, Host: h.host, Metric: h.metric, Value: rec.Value}
+	}
+
+	name := exportFileName(h.metric, h.host, time.Now())
+	err := func() error {
+		f, err := os.Create(name)
+		if err != nil {
+			return err
+		}
+		if err := writeExport(f, "csv", rows); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}()
+	if err != nil {
+		h.notice, h.noticeErr = "Falha ao exportar: "+err.Error(), true
+		return
+	}
+	if abs, err := filepath.Abs(name); err == nil {
+		name = abs
+	}
+	h.notice, h.noticeErr = fmt.Sprintf("%d pontos exportados para %s", len(rows), name), false
+}
+
+// MoveCursor move o cursor pelo gráfico (delta negativo = para trás) e
+// carrega os processos que mais consumiam recursos naquele momento.
+func (h *HistoryGraph) MoveCursor(delta int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.data) == 0 {
+		return
+	}
+
+	// Um passo do cursor equivale a uma coluna do gráfico.
+	step := 1
+	if h.lastWidth > 0 && len(h.data) > h.lastWidth {
+		step = len(h.data) / h.lastWidth
+	}
+
+	if h.cursor < 0 {
+		h.cursor = len(h.data) - 1
+	} else {
+		h.cursor += delta * step
+	}
+	if h.cursor < 0 {
+		h.cursor = 0
+	}
+	if h.cursor >= len(h.data) {
+		h.cursor = len(h.data) - 1
+	}
+
+	// A média da frota não tem processos: cada host grava os seus.
+	var procs []ProcessRecord
+	if h.host != fleetHostKey {
+		var err error
+		if procs, err = history.TopProcessesAt(h.host, h.data[h.cursor].Timestamp, historyProcessWindow); err != nil {
+			procs = nil
+		}
+	}
+	if isMemoryMetric(h.metric) {
+		sort.Slice(procs, func(i, j int) bool { return procs[i].Mem > procs[j].Mem })
+	}
+	if len(procs) > topProcessCount {
+		procs = procs[:topProcessCount]
+	}
+	h.topProcs = procs
+}
+
+// ClearCursor remove o cursor e o painel de processos.
+func (h *HistoryGraph) ClearCursor() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.cursor = -1
+	h.topProcs = nil
+}
+
+// drawTopProcesses desenha o painel "maiores consumidores" abaixo do gráfico.
+func (h *HistoryGraph) drawTopProcesses(screen tcell.Screen, x, y, width int) {
+	rec := h.data[h.cursor]
+	info := metricInfo(h.metric)
+	header := fmt.Sprintf("Maiores consumidores em %s (%s: %s)", rec.Timestamp.Format("02/01 15:04:05"), info.Label, formatMetricValue(rec.Value, info.Unit))
+	tview.Print(screen, header, x+1, y, width-2, tview.AlignLeft, tcell.ColorYellow)
+
+	if h.host == fleetHostKey {
+		tview.Print(screen, "Escolha um host com [O] para ver os processos deste ponto.", x+1, y+1, width-2, tview.AlignLeft, tcell.ColorWhite)
+		return
+	}
+	if len(h.topProcs) == 0 {
+		tview.Print(screen, "Nenhuma amostra de processos gravada perto deste ponto.", x+1, y+1, width-2, tview.AlignLeft, tcell.ColorWhite)
+		return
+	}
+
+	tview.Print(screen, fmt.Sprintf("%-8s %-12s %7s %7s  %s", "PID", "Usuário", "CPU%", "MEM%", "Comando"), x+1, y+1, width-2, tview.AlignLeft, tcell.ColorGreen)
+	for i, p := range h.topProcs {
+		line := fmt.Sprintf("%-8d %-12.12s %7.2f %7.2f  %s", p.PID, p.User, p.CPU, p.Mem, p.Command)
+		tview.Print(screen, line, x+1, y+2+i, width-2, tview.AlignLeft, tcell.ColorWhite)
+	}
+}
+
 // Draw desenha o gráfico na tela.
 func (h *HistoryGraph) Draw(screen tcell.Screen) {
 	h.Box.Draw(screen)
-	h.mu.RLock()
-	defer h.mu.RUnlock()
+	h.mu.Lock()
+	defer h.mu.Unlock()
 
 	x, y, width, height := h.GetInnerRect()
+	if h.err != nil && width > 2 && height > 2 {
+		tview.Print(screen, tview.Escape(h.err.Error()), x+1, y+(height/2), width-2, tview.AlignCenter, tcell.ColorRed)
+		return
+	}
 	if width <= 2 || height <= 2 || len(h.data) == 0 {
 		tview.Print(screen, "Coletando dados históricos... (Aguarde alguns minutos)", x+1, y+(height/2), width-2, tview.AlignCenter, tcell.ColorYellow)
+		if h.notice != "" {
+			tview.Print(screen, tview.Escape(h.notice), x+1, y, width-2, tview.AlignLeft, tcell.ColorRed)
+		}
 		return
 	}
+	h.lastWidth = width - 4
+
+	if h.notice != "" && height > 3 {
+		color := tcell.ColorGreen
+		if h.noticeErr {
+			color = tcell.ColorRed
+		}
+		tview.Print(screen, tview.Escape(h.notice), x+1, y, width-2, tview.AlignLeft, color)
+		y++
+		height--
+	}
 
-	yAxisLabelMax := fmt.Sprintf("%.0f%%", h.maxVal)
-	yAxisLabelMin := fmt.Sprintf("%.0f%%", h.minVal)
+	// Falhas da fila de gravação aparecem na primeira linha até a próxima
+	// gravação bem-sucedida.
+	for _, stats := range dbWriter.Stats() {
+		if stats.LastError == "" || height <= 3 {
+			continue
+		}
+		msg := fmt.Sprintf("Falha ao gravar histórico em %s (%d linhas na fila): %s", stats.Store, stats.QueuedRows, stats.LastError)
+		tview.Print(screen, tview.Escape(msg), x+1, y, width-2, tview.AlignLeft, tcell.ColorRed)
+		y++
+		height--
+	}
+
+	// Com o cursor ativo, a parte de baixo é reservada para o painel de processos.
+	if h.cursor >= 0 {
+		panelHeight := topProcessCount + 3
+		if panelHeight > height/2 {
+			panelHeight = height / 2
+		}
+		h.drawTopProcesses(screen, x, y+height-panelHeight+1, width)
+		height -= panelHeight
+		if height <= 2 {
+			return
+		}
+	}
+
+	unit := metricInfo(h.metric).Unit
+	yAxisLabelMax := formatMetricValue(h.maxVal, unit)
+	yAxisLabelMin := formatMetricValue(h.minVal, unit)
 	tview.Print(screen, yAxisLabelMax, x, y, width-2, tview.AlignLeft, tcell.ColorYellow)
 	tview.Print(screen, yAxisLabelMin, x, y+height-1, width-2, tview.AlignLeft, tcell.ColorYellow)
 
@@ -116,10 +352,24 @@ func (h *HistoryGraph) Draw(screen tcell.Screen) {
 
 		char := '•'
 		color := tcell.ColorAqua
-		if h.metricName == "CPU" {
+		if h.metric == "cpu_usage" {
 			color = tcell.ColorGreen
 		}
 
 		screen.SetContent(x+i+2, y+yPos, char, nil, tcell.StyleDefault.Foreground(color))
 	}
+
+	if h.cursor >= 0 {
+		// Primeira coluna cujo ponto corresponde ao cursor.
+		col := (h.cursor*(width-4) + len(h.data) - 1) / len(h.data)
+		if col > width-5 {
+			col = width - 5
+		}
+		for row := 0; row < height-1; row++ {
+			mainc, _, _, _ := screen.GetContent(x+col+2, y+row)
+			if mainc == ' ' {
+				screen.SetContent(x+col+2, y+row, '│', nil, tcell.StyleDefault.Foreground(tcell.ColorYellow))
+			}
+		}
+	}
 }
\ No newline at end of file
@@ -0,0 +1,211 @@
+// /*********************************************************************************
+// * Projeto:     Batedor
+// * Componente:  HistoryWriter - Gravação do histórico em lotes, fora da coleta
+// *********************************************************************************/
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Parâmetros da fila de gravação.
+const (
+	writerFlushInterval = time.Second // Tempo máximo de uma amostra na fila.
+	writerBatchRows     = 500         // Linhas que disparam a gravação antes do intervalo.
+	writerMaxRows       = 100000      // Acima disso, novas amostras são recusadas.
+	writerMaxAttempts   = 3           // Tentativas antes de descartar um lote.
+)
+
+// dbWriter grava o histórico em segundo plano, uma fila por armazenamento;
+// vazio enquanto não há armazenamento aberto.
+var dbWriter historyWriters
+
+// HistoryWriterStats resume o estado da fila de gravação de um armazenamento.
+type HistoryWriterStats struct {
+	Store       string    // Armazenamento da fila (veja --store).
+	QueuedRows  int       // Linhas aguardando gravação.
+	WrittenRows uint64    // Linhas gravadas desde o início.
+	DroppedRows uint64    // Linhas recusadas com a fila cheia ou descartadas após falhas.
+	Flushes     uint64    // Gravações concluídas (transações, no SQLite).
+	LastFlush   time.Time // Última gravação bem-sucedida.
+	LastError   string    // Última falha de gravação; vazio depois de um sucesso.
+	LastErrorAt time.Time
+}
+
+// historyWriter acumula as amostras em memória e as grava em lotes, cada lote
+// em uma chamada a Store.Write, para que a coleta nunca espere pelo disco ou
+// pela rede.
+type historyWriter struct {
+	store    Store
+	mu       sync.Mutex
+	queue    []HistoryBatch
+	rows     int // Linhas em queue.
+	attempts int // Falhas seguidas ao gravar a fila atual.
+	stats    HistoryWriterStats
+	wake     chan struct{}
+	closing  chan struct{}
+	done     chan struct{}
+}
+
+// newHistoryWriter cria a fila de gravação do armazenamento e inicia sua
+// goroutine.
+func newHistoryWriter(s Store) *historyWriter {
+	w := &historyWriter{
+		store:   s,
+		wake:    make(chan struct{}, 1),
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// batchRows é quantas linhas o lote ocupa no banco.
+func batchRows(b HistoryBatch) int {
+	return len(b.Metrics) + len(b.Procs)
+}
+
+// Enqueue coloca um lote na fila sem bloquear. Com a fila cheia (o disco não
+// acompanha, o banco está bloqueado ou o servidor remoto está fora do ar), o
+// lote é recusado.
+func (w *historyWriter) Enqueue(b HistoryBatch) error {
+	n := batchRows(b)
+	if n == 0 {
+		return nil
+	}
+
+	w.mu.Lock()
+	if w.rows+n > writerMaxRows {
+		w.stats.DroppedRows += uint64(n)
+		w.mu.Unlock()
+		return fmt.Errorf("fila de gravação de %s cheia (%d linhas)", w.store, writerMaxRows)
+	}
+	w.queue = append(w.queue, b)
+	w.rows += n
+	full := w.rows >= writerBatchRows
+	w.mu.Unlock()
+
+	if full {
+		select {
+		case w.wake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Stats devolve o estado atual da fila.
+func (w *historyWriter) Stats() HistoryWriterStats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	stats := w.stats
+	stats.Store = w.store.String()
+	stats.QueuedRows = w.rows
+	return stats
+}
+
+// Close grava o que restou na fila e encerra a goroutine.
+func (w *historyWriter) Close() {
+	close(w.closing)
+	<-w.done
+}
+
+func (w *historyWriter) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(writerFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.wake:
+		case <-w.closing:
+			w.flush()
+			if n := w.Stats().QueuedRows; n > 0 {
+				log.Printf("Histórico: %d linhas não gravadas em %s ao encerrar", n, w.store)
+			}
+			return
+		}
+		w.flush()
+	}
+}
+
+// flush grava a fila inteira de uma vez. Em caso de falha, os lotes
+// voltam para a frente da fila e são tentados de novo no próximo ciclo; depois
+// de writerMaxAttempts falhas seguidas, são descartados.
+func (w *historyWriter) flush() {
+	w.mu.Lock()
+	batches, rows := w.queue, w.rows
+	w.queue, w.rows = nil, 0
+	w.mu.Unlock()
+	if len(batches) == 0 {
+		return
+	}
+
+	err := w.store.Write(batches)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err == nil {
+		if w.stats.LastError != "" {
+			log.Printf("Histórico: gravação em %s normalizada", w.store)
+		}
+		w.attempts = 0
+		w.stats.WrittenRows += uint64(rows)
+		w.stats.Flushes++
+		w.stats.LastFlush = time.Now()
+		w.stats.LastError = ""
+		return
+	}
+
+	if w.stats.LastError == "" {
+		log.Printf("Histórico: falha ao gravar %d linhas em %s: %v", rows, w.store, err)
+	}
+	w.stats.LastError = err.Error()
+	w.stats.LastErrorAt = time.Now()
+	w.attempts++
+	if w.attempts >= writerMaxAttempts {
+		log.Printf("Histórico: %d linhas descartadas em %s após %d tentativas", rows, w.store, w.attempts)
+		w.stats.DroppedRows += uint64(rows)
+		w.attempts = 0
+		return
+	}
+	w.queue = append(batches, w.queue...)
+	w.rows += rows
+}
+
+// historyWriters são as filas de todos os armazenamentos abertos.
+type historyWriters []*historyWriter
+
+// Enqueue coloca o lote na fila de cada armazenamento. Com algum deles
+// recusando, devolve o erro; os demais continuam gravando.
+func (ws historyWriters) Enqueue(b HistoryBatch) error {
+	if len(ws) == 0 {
+		return errNoDatabase()
+	}
+	var firstErr error
+	for _, w := range ws {
+		if err := w.Enqueue(b); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Stats devolve o estado da fila de cada armazenamento.
+func (ws historyWriters) Stats() []HistoryWriterStats {
+	stats := make([]HistoryWriterStats, len(ws))
+	for i, w := range ws {
+		stats[i] = w.Stats()
+	}
+	return stats
+}
+
+// Close grava o que restou em todas as filas.
+func (ws historyWriters) Close() {
+	for _, w := range ws {
+		w.Close()
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeStore guarda os lotes gravados e falha nas primeiras fails chamadas.
+type fakeStore struct {
+	mu     sync.Mutex
+	fails  int
+	calls  int
+	writes []HistoryBatch
+}
+
+func (s *fakeStore) Write(batches []HistoryBatch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if s.fails > 0 {
+		s.fails--
+		return errors.New("database is locked")
+	}
+	s.writes = append(s.writes, batches...)
+	return nil
+}
+
+func (s *fakeStore) written() []HistoryBatch {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]HistoryBatch(nil), s.writes...)
+}
+
+func (s *fakeStore) Query(RangeQuery) ([]MetricRecord, error) { return nil, errStoreUnsupported{s} }
+func (s *fakeStore) Series() ([]Series, error)                { return nil, errStoreUnsupported{s} }
+func (s *fakeStore) Retain(time.Time) error                   { return nil }
+func (s *fakeStore) Close() error                             { return nil }
+func (s *fakeStore) String() string                           { return "fake" }
+
+// testBatch monta uma amostra com rows métricas.
+func testBatch(host string, rows int) HistoryBatch {
+	b := HistoryBatch{Host: host, Timestamp: time.Unix(1000, 0), Metrics: make(map[string]float64, rows)}
+	for i := 0; i < rows; i++ {
+		b.Metrics[fmt.Sprintf("m%d", i)] = float64(i)
+	}
+	return b
+}
+
+// newManualWriter cria a fila sem a goroutine, para que o teste chame flush.
+func newManualWriter(s Store) *historyWriter {
+	return &historyWriter{store: s, wake: make(chan struct{}, 1)}
+}
+
+func TestHistoryWriterRetry(t *testing.T) {
+	s := &fakeStore{fails: 2}
+	w := newManualWriter(s)
+	w.Enqueue(testBatch("a", 3))
+
+	w.flush()
+	if st := w.Stats(); st.QueuedRows != 3 || st.LastError == "" || st.WrittenRows != 0 {
+		t.Fatalf("depois da primeira falha: %+v", st)
+	}
+	// Amostras novas ficam atrás das que voltaram para a fila.
+	w.Enqueue(testBatch("b", 2))
+	w.flush()
+	if st := w.Stats(); st.QueuedRows != 5 || st.LastError == "" || st.WrittenRows != 0 {
+		t.Fatalf("depois da segunda falha: %+v", st)
+	}
+	w.flush()
+	st := w.Stats()
+	if st.QueuedRows != 0 || st.WrittenRows != 5 || st.Flushes != 1 || st.LastError != "" || st.DroppedRows != 0 {
+		t.Fatalf("depois do sucesso: %+v", st)
+	}
+	got := s.written()
+	if len(got) != 2 || got[0].Host != "a" || got[1].Host != "b" {
+		t.Errorf("lotes gravados = %+v, want a e b, nessa ordem", got)
+	}
+}
+
+func TestHistoryWriterDropsAfterMaxAttempts(t *testing.T) {
+	s := &fakeStore{fails: writerMaxAttempts}
+	w := newManualWriter(s)
+	w.Enqueue(testBatch("a", 4))
+	for i := 0; i < writerMaxAttempts; i++ {
+		w.flush()
+	}
+	st := w.Stats()
+	if st.QueuedRows != 0 || st.DroppedRows != 4 || st.WrittenRows != 0 || st.LastError == "" {
+		t.Fatalf("Stats() = %+v, want as 4 linhas descartadas", st)
+	}
+
+	// Depois do descarte, as tentativas recomeçam do zero.
+	w.Enqueue(testBatch("b", 1))
+	w.flush()
+	if st := w.Stats(); st.WrittenRows != 1 || st.LastError != "" || s.calls != writerMaxAttempts+1 {
+		t.Errorf("Stats() = %+v (%d chamadas), want b gravado", st, s.calls)
+	}
+}
+
+func TestHistoryWriterOverflow(t *testing.T) {
+	w := newManualWriter(&fakeStore{})
+	const rows = 1000
+	for i := 0; i < writerMaxRows/rows; i++ {
+		if err := w.Enqueue(testBatch("a", rows)); err != nil {
+			t.Fatalf("Enqueue %d: %v", i, err)
+		}
+	}
+	if err := w.Enqueue(testBatch("a", rows)); err == nil {
+		t.Fatal("Enqueue com a fila cheia deveria falhar")
+	}
+	if err := w.Enqueue(testBatch("a", 1)); err == nil {
+		t.Fatal("Enqueue com a fila cheia deveria falhar mesmo com uma linha")
+	}
+	if err := w.Enqueue(HistoryBatch{}); err != nil {
+		t.Errorf("lote vazio não ocupa a fila: %v", err)
+	}
+	st := w.Stats()
+	if st.QueuedRows != writerMaxRows || st.DroppedRows != rows+1 {
+		t.Fatalf("Stats() = %+v, want %d na fila e %d recusadas", st, writerMaxRows, rows+1)
+	}
+
+	// Gravada a fila, ela volta a aceitar amostras.
+	w.flush()
+	if err := w.Enqueue(testBatch("a", rows)); err != nil {
+		t.Errorf("Enqueue depois de gravar: %v", err)
+	}
+	if st := w.Stats(); st.WrittenRows != writerMaxRows || st.QueuedRows != rows {
+		t.Errorf("Stats() = %+v", st)
+	}
+}
+
+func TestHistoryWriterFlushOnClose(t *testing.T) {
+	s := &fakeStore{}
+	w := newHistoryWriter(s)
+	// Abaixo de writerBatchRows e antes do intervalo: só Close grava.
+	for i := 0; i < 3; i++ {
+		if err := w.Enqueue(testBatch(fmt.Sprint(i), 10)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+	if got := s.written(); len(got) != 3 {
+		t.Fatalf("%d lotes gravados ao fechar, want 3", len(got))
+	}
+	if st := w.Stats(); st.QueuedRows != 0 || st.WrittenRows != 30 {
+		t.Errorf("Stats() = %+v", st)
+	}
+
+	// Uma falha no fechamento deixa as linhas contadas como na fila.
+	failing := newHistoryWriter(&fakeStore{fails: 1})
+	failing.Enqueue(testBatch("a", 5))
+	failing.Close()
+	if st := failing.Stats(); st.QueuedRows != 5 || st.WrittenRows != 0 {
+		t.Errorf("Stats() depois de fechar com falha = %+v", st)
+	}
+}
+
+func TestHistoryWriterWakesOnBatchRows(t *testing.T) {
+	s := &fakeStore{}
+	w := newHistoryWriter(s)
+	defer w.Close()
+	w.Enqueue(testBatch("a", writerBatchRows))
+	// Sem esperar o intervalo: a fila acorda ao atingir writerBatchRows.
+	deadline := time.Now().Add(writerFlushInterval / 2)
+	for len(s.written()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("a fila não gravou ao atingir writerBatchRows")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// benchmarkMetrics é o tamanho de uma amostra: as séries gravadas pela TUI
+// a cada intervalo.
+const benchmarkMetrics = 40
+
+// BenchmarkHistoryWriter compara a fila em lotes com a gravação anterior,
+// em que cada métrica era um INSERT com sua própria transação.
+func BenchmarkHistoryWriter(b *testing.B) {
+	sample := testBatch("", benchmarkMetrics)
+
+	b.Run("por linha", func(b *testing.B) {
+		conn, err := openDatabase(filepath.Join(b.TempDir(), "history.db"))
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer conn.Close()
+		// O antigo logMetric: prepara e executa um INSERT por métrica.
+		logMetric := func(ts time.Time, name string, value float64) error {
+			stmt, err := conn.Prepare("INSERT OR REPLACE INTO metrics(host, timestamp, metric_name, value) values(?,?,?,?)")
+			if err != nil {
+				return err
+			}
+			defer stmt.Close()
+			_, err = stmt.Exec("", ts.UTC(), name, value)
+			return err
+		}
+		start := time.Now()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			ts := time.Unix(int64(i), 0)
+			for name, value := range sample.Metrics {
+				if err := logMetric(ts, name, value); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+		b.StopTimer()
+		b.ReportMetric(float64(b.N*benchmarkMetrics)/time.Since(start).Seconds(), "linhas/s")
+	})
+
+	b.Run("em lotes", func(b *testing.B) {
+		conn, err := openDatabase(filepath.Join(b.TempDir(), "history.db"))
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer conn.Close()
+		// Grava a cada writerBatchRows linhas, como quando a fila acorda a
+		// goroutine, sem depender do intervalo.
+		w := newManualWriter(&sqliteStore{db: conn})
+		start := time.Now()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			batch := sample
+			batch.Timestamp = time.Unix(int64(i), 0)
+			if err := w.Enqueue(batch); err != nil {
+				b.Fatal(err)
+			}
+			if w.Stats().QueuedRows >= writerBatchRows {
+				w.flush()
+			}
+		}
+		w.flush()
+		b.StopTimer()
+		if st := w.Stats(); st.WrittenRows != uint64(b.N*benchmarkMetrics) {
+			b.Fatalf("Stats() = %+v, want %d linhas gravadas", st, b.N*benchmarkMetrics)
+		}
+		b.ReportMetric(float64(b.N*benchmarkMetrics)/time.Since(start).Seconds(), "linhas/s")
+	})
+}
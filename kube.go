@@ -0,0 +1,542 @@
+// /*********************************************************************************
+// * Projeto:     Batedor
+// * Componente:  PodView - Pods do Kubernetes no nó (cgroups kubepods + kubelet)
+// *********************************************************************************/
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// Opções da integração com o Kubernetes (ver main).
+var (
+	kubeLogRoot        = "/var/log" // Onde ficam containers/ e pods/ do kubelet.
+	kubeletURL         string       // Ex.: https://127.0.0.1:10250; vazio desativa.
+	kubeletTokenFile   string
+	kubeletInsecureTLS bool
+)
+
+// kubePodPattern reconhece o cgroup de um pod, nos dois drivers:
+// "kubepods-burstable-pod<uid>.slice" (systemd, com "_" no lugar de "-")
+// e "pod<uid>" (cgroupfs).
+var kubePodPattern = regexp.MustCompile(`^(?:kubepods-(?:burstable-|besteffort-)?)?pod([0-9a-f]{8}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{12})(?:\.slice)?$`)
+
+// podFromCgroup identifica o pod dono de um caminho de cgroup. Devolve o
+// caminho do cgroup do pod, o UID e a classe de QoS.
+func podFromCgroup(cgroupPath string) (podPath, uid, qos string, ok bool) {
+	if !strings.Contains(cgroupPath, "kubepods") {
+		return "", "", "", false
+	}
+	parts := strings.Split(cgroupPath, "/")
+	for i, part := range parts {
+		m := kubePodPattern.FindStringSubmatch(part)
+		if m == nil {
+			continue
+		}
+		qos = "Guaranteed"
+		parent := strings.Join(parts[:i], "/")
+		if strings.Contains(parent, "burstable") {
+			qos = "Burstable"
+		} else if strings.Contains(parent, "besteffort") {
+			qos = "BestEffort"
+		}
+		return strings.Join(parts[:i+1], "/"), strings.ReplaceAll(m[1], "_", "-"), qos, true
+	}
+	return "", "", "", false
+}
+
+// kubePodMeta é o nome de um pod, pelo UID.
+type kubePodMeta struct {
+	Name      string
+	Namespace string
+}
+
+// kubeContainerMeta é o pod e o nome de um contêiner, pelo ID.
+type kubeContainerMeta struct {
+	PodUID    string
+	Pod       string
+	Namespace string
+	Name      string
+}
+
+// readKubeLogs obtém nomes de pods e contêineres pelos diretórios de log do
+// kubelet, que não exigem credenciais:
+//
+//	<raiz>/pods/<namespace>_<pod>_<uid>/
+//	<raiz>/containers/<pod>_<namespace>_<contêiner>-<id>.log
+func readKubeLogs(root string) (map[string]kubePodMeta, map[string]kubeContainerMeta) {
+	pods := make(map[string]kubePodMeta)
+	containers := make(map[string]kubeContainerMeta)
+
+	dirs, _ := os.ReadDir(filepath.Join(root, "pods"))
+	for _, d := range dirs {
+		fields := strings.SplitN(d.Name(), "_", 3)
+		if len(fields) == 3 {
+			pods[fields[2]] = kubePodMeta{Name: fields[1], Namespace: fields[0]}
+		}
+	}
+
+	files, _ := os.ReadDir(filepath.Join(root, "containers"))
+	for _, f := range files {
+		name := strings.TrimSuffix(f.Name(), ".log")
+		if len(name) < 66 || name[len(name)-65] != '-' {
+			continue
+		}
+		id := name[len(name)-64:]
+		fields := strings.SplitN(name[:len(name)-65], "_", 3)
+		if len(fields) != 3 || !containerIDPattern.MatchString(id) {
+			continue
+		}
+		meta := kubeContainerMeta{Pod: fields[0], Namespace: fields[1], Name: fields[2]}
+		for uid, pod := range pods {
+			if pod.Name == meta.Pod && pod.Namespace == meta.Namespace {
+				meta.PodUID = uid
+				break
+			}
+		}
+		containers[id] = meta
+	}
+	return pods, containers
+}
+
+// kubeletPodList é o subconjunto usado da resposta de GET /pods do kubelet.
+type kubeletPodList struct {
+	Items []struct {
+		Metadata struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+			UID       string `json:"uid"`
+		} `json:"metadata"`
+		Status struct {
+			ContainerStatuses []struct {
+				Name        string `json:"name"`
+				ContainerID string `json:"containerID"` // "containerd://<id>".
+			} `json:"containerStatuses"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+// kubeletClients guarda um cliente HTTP para cada valor de
+// --kubelet-insecure-tls, reaproveitado entre as consultas periódicas.
+var (
+	kubeletClientsMu sync.Mutex
+	kubeletClients   = make(map[bool]*http.Client)
+)
+
+// kubeletClient devolve o cliente do kubelet, criando-o na primeira consulta.
+func kubeletClient(insecure bool) *http.Client {
+	kubeletClientsMu.Lock()
+	defer kubeletClientsMu.Unlock()
+	if client, ok := kubeletClients[insecure]; ok {
+		return client
+	}
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			// O kubelet costuma usar um certificado autoassinado.
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: insecure},
+		},
+	}
+	kubeletClients[insecure] = client
+	return client
+}
+
+// fetchKubeletPods consulta a API do kubelet e devolve os mesmos mapas de readKubeLogs.
+func fetchKubeletPods() (map[string]kubePodMeta, map[string]kubeContainerMeta, error) {
+	req, err := http.NewRequest("GET", strings.TrimSuffix(kubeletURL, "/")+"/pods", nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if kubeletTokenFile != "" {
+		token, err := os.ReadFile(kubeletTokenFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	resp, err := kubeletClient(kubeletInsecureTLS).Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("kubelet respondeu %s", resp.Status)
+	}
+	var list kubeletPodList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, nil, err
+	}
+
+	pods := make(map[string]kubePodMeta)
+	containers := make(map[string]kubeContainerMeta)
+	for _, item := range list.Items {
+		md := item.Metadata
+		pods[md.UID] = kubePodMeta{Name: md.Name, Namespace: md.Namespace}
+		for _, cs := range item.Status.ContainerStatuses {
+			if idx := strings.Index(cs.ContainerID, "://"); idx >= 0 {
+				containers[cs.ContainerID[idx+3:]] = kubeContainerMeta{PodUID: md.UID, Pod: md.Name, Namespace: md.Namespace, Name: cs.Name}
+			}
+		}
+	}
+	return pods, containers, nil
+}
+
+// Pod é o uso de recursos de um pod e de seus contêineres.
+type Pod struct {
+	UID        string
+	Name       string
+	Namespace  string
+	QoS        string
+	CgroupPath string
+	CPU        float64
+	MemCurrent uint64
+	MemMax     uint64
+	PIDs       uint64
+	NetRxRate  float64 // Os contêineres de um pod dividem o namespace de rede.
+	NetTxRate  float64
+	Containers []Container
+}
+
+// Label devolve "namespace/pod" ou, sem os nomes, o UID.
+func (p Pod) Label() string {
+	if p.Name != "" {
+		return p.Namespace + "/" + p.Name
+	}
+	return "pod " + p.UID
+}
+
+// kubeSampler monta a lista de pods a partir dos cgroups e mantém um cache
+// dos nomes vindos dos logs do kubelet e, opcionalmente, da API do kubelet.
+type kubeSampler struct {
+	mu            sync.RWMutex
+	pods          map[string]kubePodMeta
+	containers    map[string]kubeContainerMeta
+	lastMetaCheck time.Time
+}
+
+// refreshMeta atualiza o cache de nomes (leitura de diretórios e, se
+// configurado, chamada HTTP ao kubelet; feita fora do ciclo de coleta).
+func (s *kubeSampler) refreshMeta() {
+	pods, containers := readKubeLogs(kubeLogRoot)
+	if kubeletURL != "" {
+		apiPods, apiContainers, err := fetchKubeletPods()
+		if err != nil {
+			log.Printf("Falha ao consultar o kubelet em %s: %v", kubeletURL, err)
+		}
+		for uid, p := range apiPods {
+			pods[uid] = p
+		}
+		for id, c := range apiContainers {
+			containers[id] = c
+		}
+	}
+	s.mu.Lock()
+	s.pods = pods
+	s.containers = containers
+	s.mu.Unlock()
+}
+
+// sample devolve os pods encontrados entre os cgroups e anota os
+// contêineres com o pod, o namespace e o nome no Kubernetes.
+func (s *kubeSampler) sample(now time.Time, cgroups []CgroupStat, containers []Container) []Pod {
+	var pods []Pod
+	byPath := make(map[string]int)
+	for _, cg := range cgroups {
+		podPath, uid, qos, ok := podFromCgroup(cg.Path)
+		if !ok || podPath != cg.Path {
+			continue
+		}
+		byPath[podPath] = len(pods)
+		pods = append(pods, Pod{
+			UID:        uid,
+			QoS:        qos,
+			CgroupPath: cg.Path,
+			CPU:        cg.CPU,
+			MemCurrent: cg.MemCurrent,
+			MemMax:     cg.MemMax,
+			PIDs:       cg.PIDs,
+		})
+	}
+	if len(pods) == 0 {
+		return nil
+	}
+
+	if now.Sub(s.lastMetaCheck) > 30*time.Second {
+		s.lastMetaCheck = now
+		go s.refreshMeta()
+	}
+	s.mu.RLock()
+	podMeta, containerMeta := s.pods, s.containers
+	s.mu.RUnlock()
+
+	for i := range pods {
+		if m, ok := podMeta[pods[i].UID]; ok {
+			pods[i].Name, pods[i].Namespace = m.Name, m.Namespace
+		}
+	}
+	for i := range containers {
+		c := &containers[i]
+		podPath, uid, _, ok := podFromCgroup(c.CgroupPath)
+		if !ok {
+			continue
+		}
+		c.PodUID = uid
+		if m, ok := containerMeta[c.ID]; ok {
+			c.Name, c.Pod, c.Namespace = m.Name, m.Pod, m.Namespace
+		} else if m, ok := podMeta[uid]; ok {
+			c.Pod, c.Namespace = m.Name, m.Namespace
+		}
+		if idx, ok := byPath[podPath]; ok {
+			p := &pods[idx]
+			p.Containers = append(p.Containers, *c)
+			if c.NetRxRate+c.NetTxRate > p.NetRxRate+p.NetTxRate {
+				p.NetRxRate, p.NetTxRate = c.NetRxRate, c.NetTxRate
+			}
+		}
+	}
+	return pods
+}
+
+// filterAndSortPods aplica o filtro (namespace, pod ou contêiner) e a
+// ordenação, que também vale para os contêineres de cada pod.
+func filterAndSortPods(pods []Pod, filter, sortBy string) []Pod {
+	filter = strings.ToLower(filter)
+	list := make([]Pod, 0, len(pods))
+	for _, p := range pods {
+		text := strings.ToLower(p.Label())
+		for _, c := range p.Containers {
+			text += " " + strings.ToLower(c.Label())
+		}
+		if filter != "" && !strings.Contains(text, filter) {
+			continue
+		}
+		p.Containers = filterAndSortContainers(p.Containers, "", sortBy)
+		list = append(list, p)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		switch sortBy {
+		case "mem":
+			return list[i].MemCurrent > list[j].MemCurrent
+		case "net":
+			return list[i].NetRxRate+list[i].NetTxRate > list[j].NetRxRate+list[j].NetTxRate
+		case "name":
+			return list[i].Label() < list[j].Label()
+		default:
+			return list[i].CPU > list[j].CPU
+		}
+	})
+	return list
+}
+
+// podSortLabels são os nomes exibidos para cada ordenação.
+var podSortLabels = map[string]string{
+	"cpu":  "CPU",
+	"mem":  "Memória",
+	"net":  "Rede",
+	"name": "Nome",
+}
+
+// PodView é a tela de pods: um filtro e uma tabela com cada pod seguido de
+// seus contêineres. Enter mostra os processos do pod ou do contêiner.
+type PodView struct {
+	*tview.Flex
+	filter   *tview.InputField
+	table    *tview.Table
+	mu       sync.RWMutex
+	pods     []Pod
+	cgroups  []CgroupStat
+	procs    []ProcData
+	sortBy   string
+	selected string // Caminho do cgroup aberto; "" mostra a lista.
+}
+
+// NewPodView cria a tela de pods.
+func NewPodView() *PodView {
+	v := &PodView{
+		filter: tview.NewInputField().SetLabel("Filtrar pods (namespace, pod, contêiner): ").SetLabelColor(tcell.ColorYellow),
+		table:  tview.NewTable().SetSelectable(true, false).SetFixed(1, 0),
+		sortBy: "cpu",
+	}
+	v.table.SetBorder(true)
+	v.filter.SetChangedFunc(func(text string) {
+		v.refresh()
+	})
+	v.Flex = tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(v.filter, 1, 0, false).
+		AddItem(v.table, 0, 1, true)
+	v.refresh()
+	return v
+}
+
+// Update atualiza os pods exibidos.
+func (v *PodView) Update(pods []Pod, cgroups []CgroupStat, procs []ProcData) {
+	v.mu.Lock()
+	v.pods = pods
+	v.cgroups = cgroups
+	v.procs = procs
+	v.mu.Unlock()
+	v.refresh()
+}
+
+// Filter devolve o campo de filtro, para que a aplicação possa focá-lo.
+func (v *PodView) Filter() *tview.InputField {
+	return v.filter
+}
+
+// FilterFocused indica se o campo de filtro está recebendo as teclas.
+func (v *PodView) FilterFocused() bool {
+	return v.filter.HasFocus()
+}
+
+// HandleKey trata as teclas da tabela: C/M/R/N ordenam, Enter abre o pod ou
+// contêiner selecionado e Esc volta para a lista. Devolve nil se a tecla
+// foi consumida.
+func (v *PodView) HandleKey(event *tcell.EventKey) *tcell.EventKey {
+	switch event.Key() {
+	case tcell.KeyEnter:
+		row, _ := v.table.GetSelection()
+		if cgroupPath, ok := v.table.GetCell(row, 0).GetReference().(string); ok && row > 0 {
+			v.mu.Lock()
+			v.selected = cgroupPath
+			v.mu.Unlock()
+			v.table.Select(1, 0)
+			v.refresh()
+		}
+		return nil
+	case tcell.KeyEscape:
+		v.mu.Lock()
+		v.selected = ""
+		v.mu.Unlock()
+		v.table.Select(1, 0)
+		v.refresh()
+		return nil
+	}
+	sortBy := ""
+	switch event.Rune() {
+	case 'c', 'C':
+		sortBy = "cpu"
+	case 'm', 'M':
+		sortBy = "mem"
+	case 'r', 'R':
+		sortBy = "net"
+	case 'n', 'N':
+		sortBy = "name"
+	default:
+		return event
+	}
+	v.mu.Lock()
+	v.sortBy = sortBy
+	v.mu.Unlock()
+	v.refresh()
+	return nil
+}
+
+// refresh redesenha a tabela com os dados atuais.
+func (v *PodView) refresh() {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	if v.selected != "" {
+		v.drawMembers()
+		return
+	}
+
+	v.table.SetTitle(tview.Escape(fmt.Sprintf(" Pods do Kubernetes (ordenando por %s) | [/] Filtrar | [C]PU [M]em [R]ede [N]ome | [Enter] Processos | [Q] Voltar ",
+		podSortLabels[v.sortBy])))
+	v.table.Clear()
+	if len(v.pods) == 0 {
+		v.table.SetCell(0, 0, tview.NewTableCell("Nenhum pod encontrado nos cgroups (kubepods). Este nó roda Kubernetes?").SetSelectable(false))
+		return
+	}
+
+	headers := []string{"Pod / Contêiner", "QoS", "CPU%", "Memória", "Limite", "Rede ↓/s", "Rede ↑/s", "PIDs"}
+	for i, header := range headers {
+		v.table.SetCell(0, i, tview.NewTableCell(header).SetTextColor(tcell.ColorYellow).SetSelectable(false))
+	}
+	row := 1
+	for _, p := range filterAndSortPods(v.pods, v.filter.GetText(), v.sortBy) {
+		limit := "-"
+		if p.MemMax > 0 {
+			limit = formatBytesNetBox(p.MemMax)
+		}
+		v.table.SetCell(row, 0, tview.NewTableCell(p.Label()).SetTextColor(tcell.ColorGreen).SetReference(p.CgroupPath).SetExpansion(1))
+		v.table.SetCell(row, 1, tview.NewTableCell(p.QoS).SetTextColor(tcell.ColorBlue))
+		v.table.SetCell(row, 2, tview.NewTableCell(fmt.Sprintf("%.2f", p.CPU)).SetTextColor(tcell.ColorGreen).SetAlign(tview.AlignRight))
+		v.table.SetCell(row, 3, tview.NewTableCell(formatBytesNetBox(p.MemCurrent)).SetTextColor(tcell.ColorGreen).SetAlign(tview.AlignRight))
+		v.table.SetCell(row, 4, tview.NewTableCell(limit).SetTextColor(tcell.ColorBlue).SetAlign(tview.AlignRight))
+		v.table.SetCell(row, 5, tview.NewTableCell(formatBytes(uint64(p.NetRxRate))).SetTextColor(tcell.ColorWhite).SetAlign(tview.AlignRight))
+		v.table.SetCell(row, 6, tview.NewTableCell(formatBytes(uint64(p.NetTxRate))).SetTextColor(tcell.ColorWhite).SetAlign(tview.AlignRight))
+		v.table.SetCell(row, 7, tview.NewTableCell(strconv.FormatUint(p.PIDs, 10)).SetTextColor(tcell.ColorWhite).SetAlign(tview.AlignRight))
+		row++
+
+		for _, c := range p.Containers {
+			limit := "-"
+			if c.MemMax > 0 {
+				limit = formatBytesNetBox(c.MemMax)
+			}
+			v.table.SetCell(row, 0, tview.NewTableCell("  └ "+c.Label()).SetTextColor(tcell.ColorWhite).SetReference(c.CgroupPath))
+			v.table.SetCell(row, 1, tview.NewTableCell(c.Runtime).SetTextColor(tcell.ColorBlue))
+			v.table.SetCell(row, 2, tview.NewTableCell(fmt.Sprintf("%.2f", c.CPU)).SetTextColor(tcell.ColorGreen).SetAlign(tview.AlignRight))
+			v.table.SetCell(row, 3, tview.NewTableCell(formatBytesNetBox(c.MemCurrent)).SetTextColor(tcell.ColorGreen).SetAlign(tview.AlignRight))
+			v.table.SetCell(row, 4, tview.NewTableCell(limit).SetTextColor(tcell.ColorBlue).SetAlign(tview.AlignRight))
+			v.table.SetCell(row, 7, tview.NewTableCell(strconv.FormatUint(c.PIDs, 10)).SetTextColor(tcell.ColorWhite).SetAlign(tview.AlignRight))
+			row++
+		}
+	}
+}
+
+// drawMembers lista os processos do pod ou contêiner aberto.
+func (v *PodView) drawMembers() {
+	v.table.Clear()
+	label := v.selected
+	for _, p := range v.pods {
+		if p.CgroupPath == v.selected {
+			label = p.Label()
+		}
+		for _, c := range p.Containers {
+			if c.CgroupPath == v.selected {
+				label = p.Label() + " / " + c.Label()
+			}
+		}
+	}
+	v.table.SetTitle(tview.Escape(fmt.Sprintf(" Processos de %s | [Esc] Voltar aos pods | [Q] Voltar ", label)))
+
+	sortBy := v.sortBy
+	if sortBy != "mem" && sortBy != "cpu" {
+		sortBy = "pid"
+	}
+	members := filterAndSortProcs(cgroupMembers(v.cgroups, v.procs, CgroupStat{Path: v.selected}), "", sortBy)
+	if len(members) == 0 {
+		v.table.SetCell(0, 0, tview.NewTableCell("Nenhum processo encontrado.").SetSelectable(false))
+		return
+	}
+
+	headers := []string{"PID", "Usuário", "CPU%", "MEM%", "Contêiner", "Comando"}
+	for i, header := range headers {
+		v.table.SetCell(0, i, tview.NewTableCell(header).SetTextColor(tcell.ColorYellow).SetSelectable(false))
+	}
+	for i, p := range members {
+		row := i + 1
+		v.table.SetCell(row, 0, tview.NewTableCell(strconv.Itoa(int(p.PID))).SetTextColor(tcell.ColorWhite))
+		v.table.SetCell(row, 1, tview.NewTableCell(p.User).SetTextColor(tcell.ColorBlue))
+		v.table.SetCell(row, 2, tview.NewTableCell(fmt.Sprintf("%.2f", p.CPU)).SetTextColor(tcell.ColorGreen))
+		v.table.SetCell(row, 3, tview.NewTableCell(fmt.Sprintf("%.2f", p.Mem)).SetTextColor(tcell.ColorGreen))
+		v.table.SetCell(row, 4, tview.NewTableCell(p.Container).SetTextColor(tcell.ColorAqua))
+		v.table.SetCell(row, 5, tview.NewTableCell(p.Command).SetTextColor(tcell.ColorWhite).SetExpansion(1))
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+func TestFetchKubeletPods(t *testing.T) {
+	var conns atomic.Int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/pods" || r.Header.Get("Authorization") != "" {
+			http.Error(w, "inesperado", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"items":[{"metadata":{"name":"web-0","namespace":"prod","uid":"u1"},
+			"status":{"containerStatuses":[{"name":"nginx","containerID":"containerd://abc"},{"name":"init","containerID":""}]}}]}`))
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	oldURL, oldInsecure, oldToken := kubeletURL, kubeletInsecureTLS, kubeletTokenFile
+	kubeletURL, kubeletInsecureTLS, kubeletTokenFile = srv.URL+"/", true, ""
+	defer func() { kubeletURL, kubeletInsecureTLS, kubeletTokenFile = oldURL, oldInsecure, oldToken }()
+
+	for i := 0; i < 3; i++ {
+		pods, containers, err := fetchKubeletPods()
+		if err != nil {
+			t.Fatalf("fetchKubeletPods() erro: %v", err)
+		}
+		if pods["u1"] != (kubePodMeta{Name: "web-0", Namespace: "prod"}) {
+			t.Errorf("pods = %+v", pods)
+		}
+		want := kubeContainerMeta{PodUID: "u1", Pod: "web-0", Namespace: "prod", Name: "nginx"}
+		if len(containers) != 1 || containers["abc"] != want {
+			t.Errorf("containers = %+v, want abc: %+v", containers, want)
+		}
+	}
+	if n := conns.Load(); n != 1 {
+		t.Errorf("%d conexões abertas para 3 consultas, want 1", n)
+	}
+
+	// Sem --kubelet-insecure-tls o certificado autoassinado é recusado.
+	kubeletInsecureTLS = false
+	if _, _, err := fetchKubeletPods(); err == nil {
+		t.Error("certificado autoassinado aceito sem --kubelet-insecure-tls")
+	}
+}
+
+func TestPodFromCgroup(t *testing.T) {
+	const uid = "0f6c3a5e-8d2b-4c1e-9a7f-123456789abc"
+	const uidUnderscore = "0f6c3a5e_8d2b_4c1e_9a7f_123456789abc"
+	const id = "4d5a3c6b2e1f0a9b8c7d6e5f4a3b2c1d0e9f8a7b6c5d4e3f2a1b0c9d8e7f6a5b"
+	tests := []struct {
+		name    string
+		path    string
+		podPath string
+		qos     string
+	}{
+		{"systemd burstable", "/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod" + uidUnderscore + ".slice/cri-containerd-" + id + ".scope",
+			"/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod" + uidUnderscore + ".slice", "Burstable"},
+		{"systemd besteffort", "/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod" + uidUnderscore + ".slice",
+			"/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod" + uidUnderscore + ".slice", "BestEffort"},
+		{"systemd guaranteed", "/kubepods.slice/kubepods-pod" + uidUnderscore + ".slice/crio-" + id + ".scope",
+			"/kubepods.slice/kubepods-pod" + uidUnderscore + ".slice", "Guaranteed"},
+		{"cgroupfs burstable", "/kubepods/burstable/pod" + uid + "/" + id, "/kubepods/burstable/pod" + uid, "Burstable"},
+		{"cgroupfs besteffort", "/kubepods/besteffort/pod" + uid + "/" + id, "/kubepods/besteffort/pod" + uid, "BestEffort"},
+		{"cgroupfs guaranteed", "/kubepods/pod" + uid + "/" + id, "/kubepods/pod" + uid, "Guaranteed"},
+		{"cgroup v1 com controlador", "/kubepods/burstable/pod" + uid, "/kubepods/burstable/pod" + uid, "Burstable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			podPath, gotUID, qos, ok := podFromCgroup(tt.path)
+			if !ok || podPath != tt.podPath || gotUID != uid || qos != tt.qos {
+				t.Errorf("podFromCgroup() = %q, %q, %q, %v; want %q, %q, %q", podPath, gotUID, qos, ok, tt.podPath, uid, tt.qos)
+			}
+		})
+	}
+
+	for _, path := range []string{
+		"",
+		"/system.slice/docker-" + id + ".scope",
+		"/user.slice/pod" + uid, // Fora de kubepods.
+		"/kubepods.slice/kubepods-burstable.slice",
+		"/kubepods/burstable/podnao-e-um-uid",
+	} {
+		if _, _, _, ok := podFromCgroup(path); ok {
+			t.Errorf("podFromCgroup(%q) reconheceu um pod", path)
+		}
+	}
+}
+
+func TestReadKubeLogs(t *testing.T) {
+	const id = "4d5a3c6b2e1f0a9b8c7d6e5f4a3b2c1d0e9f8a7b6c5d4e3f2a1b0c9d8e7f6a5b"
+	const otherID = "a5b4c3d2e1f0a9b8c7d6e5f4a3b2c1d0e9f8a7b6c5d4e3f2a1b0c9d8e7f6a5b4"
+	root := t.TempDir()
+	for _, path := range []string{
+		"pods/prod_web-0_u1/nginx/0.log",
+		"pods/kube-system_coredns-5d78c9869d-abcde_u2/coredns/0.log",
+		"pods/sem-uid/x.log", // Diretório fora do formato.
+		"containers/web-0_prod_nginx-" + id + ".log",
+		"containers/coredns-5d78c9869d-abcde_kube-system_coredns-" + otherID + ".log",
+		"containers/orfao_prod_app-" + otherID[:63] + "0.log", // Pod sem diretório em pods/.
+		"containers/curto_prod_app-abc.log",
+		"containers/sem-namespace-" + id + ".log",
+	} {
+		writeSysFile(t, root, path, "")
+	}
+
+	pods, containers := readKubeLogs(root)
+	wantPods := map[string]kubePodMeta{
+		"u1": {Name: "web-0", Namespace: "prod"},
+		"u2": {Name: "coredns-5d78c9869d-abcde", Namespace: "kube-system"},
+	}
+	if !reflect.DeepEqual(pods, wantPods) {
+		t.Errorf("pods = %+v, want %+v", pods, wantPods)
+	}
+	wantContainers := map[string]kubeContainerMeta{
+		id:                 {PodUID: "u1", Pod: "web-0", Namespace: "prod", Name: "nginx"},
+		otherID:            {PodUID: "u2", Pod: "coredns-5d78c9869d-abcde", Namespace: "kube-system", Name: "coredns"},
+		otherID[:63] + "0": {Pod: "orfao", Namespace: "prod", Name: "app"},
+	}
+	if !reflect.DeepEqual(containers, wantContainers) {
+		t.Errorf("containers = %+v, want %+v", containers, wantContainers)
+	}
+
+	// Sem os diretórios do kubelet, nada é encontrado.
+	pods, containers = readKubeLogs(filepath.Join(root, "ausente"))
+	if len(pods) != 0 || len(containers) != 0 {
+		t.Errorf("raiz ausente = %+v, %+v", pods, containers)
+	}
+}
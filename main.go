@@ -26,39 +26,26 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/gdamore/tcell/v2"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/rivo/tview"
-	"github.com/shirou/gopsutil/v3/cpu"
-	"github.com/shirou/gopsutil/v3/disk"
-	"github.com/shirou/gopsutil/v3/host"
-	"github.com/shirou/gopsutil/v3/mem"
 	gopsNet "github.com/shirou/gopsutil/v3/net"
 	"github.com/shirou/gopsutil/v3/process"
 )
 
 // --- ESTRUTURAS DE DADOS ---
 type AppState struct {
-	processSortBy        string
-	netBytesSentStart    uint64
-	netBytesRecvStart    uint64
-	lastNetBytesSent     uint64
-	lastNetBytesRecv     uint64
-	lastNetCheck         time.Time
-	motherboardInfo      string
-	publicIP             string
-	latency              int64
-	lastGlobalNetCheck   time.Time
-	primaryInterfaceName string
-	primaryInterfaceIP   string
-	cpuUsage             float64
-	memUsage             float64
+	processSortBy string
+	last          *Snapshot // Última coleta, usada pelo log do histórico.
+	source        string    // Agente exibido na tela principal; "" é o host local.
 }
 
 type App struct {
@@ -69,6 +56,16 @@ type App struct {
 	history       *HistoryGraph
 	help          *tview.TextView
 	confirmation  *tview.Modal
+	cpuDetails    *CPUDetailsBox
+	memDetails    *MemDetailsBox
+	psiBox        *PSIBox
+	sensorsBox    *SensorsBox
+	batteryBox    *BatteryBox
+	cgroupView    *CgroupView
+	containerView *ContainerView
+	podView       *PodView
+	fleet         *Fleet
+	fleetView     *FleetView
 	cpuBox        *CPUBox
 	memBox        *Sparkline
 	netBox        *NetBox
@@ -77,20 +74,37 @@ type App struct {
 	processTable  *tview.Table
 	processFilter *tview.InputField
 	sortInfo      *tview.TextView
+	collector     *Collector
+	replay        *Replay // Reprodução de uma gravação (batedor replay); nil ao vivo.
 	state         AppState
+	mu            sync.RWMutex // Protege state.last e state.source entre a coleta, o log e a TUI.
 }
 
 type WebData struct {
-	CPU   CPUData    `json:"CPU"`
-	Mem   MemData    `json:"Mem"`
-	Net   NetDataWeb `json:"Net"`
-	Procs []ProcData `json:"Procs"`
+	CPU        CPUData         `json:"CPU"`
+	Mem        MemData         `json:"Mem"`
+	Net        NetDataWeb      `json:"Net"`
+	Disk       *WebDiskData    `json:"Disk"`
+	Host       *WebHostData    `json:"Host"`
+	Pressure   PressureInfo    `json:"Pressure"`
+	Sensors    SensorInfo      `json:"Sensors"`
+	Power      PowerSupplyInfo `json:"Power"`
+	Containers []WebContainer  `json:"Containers"`
+	Alerts     []string        `json:"Alerts"`
+	Procs      []ProcData      `json:"Procs"`
 }
 type CPUData struct {
 	Cores []float64 `json:"Cores"`
+	Usage float64   `json:"Usage"`
 }
 type MemData struct {
 	UsedPercent float64 `json:"UsedPercent"`
+	Total       uint64  `json:"Total"`
+	Used        uint64  `json:"Used"`
+	Available   uint64  `json:"Available"`
+	Cached      uint64  `json:"Cached"`
+	SwapTotal   uint64  `json:"SwapTotal"`
+	SwapUsed    uint64  `json:"SwapUsed"`
 }
 type NetDataWeb struct {
 	DownloadRate string `json:"DownloadRate"`
@@ -99,22 +113,126 @@ type NetDataWeb struct {
 	Latency      int64  `json:"Latency"`
 }
 type ProcData struct {
-	PID     int32   `json:"PID"`
-	User    string  `json:"User"`
-	CPU     float64 `json:"CPU"`
-	Mem     float32 `json:"Mem"`
-	Command string  `json:"Command"`
+	PID       int32   `json:"PID"`
+	User      string  `json:"User"`
+	CPU       float64 `json:"CPU"`
+	Mem       float32 `json:"Mem"`
+	Command   string  `json:"Command"`
+	Container string  `json:"Container"` // Nome ou ID curto; vazio fora de contêineres.
+	Pod       string  `json:"Pod"`       // "namespace/pod" em nós Kubernetes.
 }
 
 var webHub *Hub
 
+// subcommands são os modos de linha de comando (batedor export ...), cada um
+// com suas próprias opções; devolvem o código de saída do processo.
+var subcommands = map[string]func(args []string) int{
+	"export": runExport,
+	"replay": runReplay,
+	"report": runReport,
+	"check":  runCheck,
+}
+
+// topProcessCount é quantos processos (por CPU e por memória) são gravados
+// no histórico a cada intervalo de log.
+const topProcessCount = 5
+
 // --- FUNÇÃO PRINCIPAL (main) ---
 func main() {
-	webFlag := flag.Bool("web", false, "Ativa o dashboard web na porta 9090")
+	if len(os.Args) > 1 {
+		if run, ok := subcommands[os.Args[1]]; ok {
+			os.Exit(run(os.Args[2:]))
+		}
+	}
+
+	webFlag := flag.Bool("web", false, "Ativa o dashboard web (veja --web-addr)")
+	flag.StringVar(&webRoot, "web-root", "", "Diretório com um frontend próprio para o dashboard web (padrão: o embutido no binário)")
+	flag.StringVar(&webConfig.Addr, "web-addr", webConfig.Addr, "Endereço de escuta do dashboard web (ex.: :9090 para todas as interfaces)")
+	flag.StringVar(&webConfig.CertFile, "web-tls-cert", "", "Certificado TLS (PEM) do dashboard web; exige --web-tls-key")
+	flag.StringVar(&webConfig.KeyFile, "web-tls-key", "", "Chave privada TLS (PEM) do dashboard web")
+	flag.BoolVar(&webConfig.SelfSigned, "web-tls-self-signed", false, "Serve o dashboard web por HTTPS com um certificado autoassinado gerado ao iniciar")
+	flag.Var(&webConfig.Users, "web-user", "Usuário da autenticação básica do dashboard web, no formato usuário:senha[:viewer|operator] (pode repetir; padrão: $BATEDOR_WEB_USER)")
+	flag.StringVar(&webConfig.Token, "web-token", os.Getenv("BATEDOR_WEB_TOKEN"), "Token de leitura do dashboard web (Bearer, cookie ou ?token=) (padrão: $BATEDOR_WEB_TOKEN)")
+	flag.StringVar(&webConfig.OperatorToken, "web-operator-token", os.Getenv("BATEDOR_WEB_OPERATOR_TOKEN"), "Token do dashboard web com papel operator, que pode sinalizar e alterar a prioridade de processos (padrão: $BATEDOR_WEB_OPERATOR_TOKEN)")
+	agentAddr := flag.String("agent", "", "Executa somente o agente (sem TUI), transmitindo as coletas neste endereço (ex.: :9091)")
+	flag.StringVar(&agentTLS.CertFile, "agent-tls-cert", "", "Certificado TLS (PEM) do agente e do servidor de histórico; exige --agent-tls-key")
+	flag.StringVar(&agentTLS.KeyFile, "agent-tls-key", "", "Chave privada TLS (PEM) do agente e do servidor de histórico")
+	flag.BoolVar(&agentTLS.SelfSigned, "agent-tls-self-signed", false, "Serve o agente (wss://) e o servidor de histórico (https://) com um certificado autoassinado gerado ao iniciar")
+	fleetFlag := flag.String("fleet", "", "Agentes remotos exibidos na tela de frota, separados por vírgula (ex.: srv1:9091,srv2:9091)")
+	flag.StringVar(&fleetTLS.CAFile, "fleet-tls-ca", "", "Certificado (PEM) aceito nas conexões com os agentes e com o servidor de histórico (--push, --history-url), além das autoridades do sistema; endereços sem esquema passam a usar wss:// e https://")
+	flag.BoolVar(&fleetTLS.Insecure, "fleet-insecure-tls", false, "Não verificar o certificado dos agentes e do servidor de histórico (necessário com --agent-tls-self-signed); endereços sem esquema passam a usar wss:// e https://")
+	historyServerAddr := flag.String("history-server", "", "Executa somente o servidor de histórico (sem TUI), recebendo amostras dos agentes neste endereço (ex.: :9092)")
+	pushURL := flag.String("push", "", "Envia o histórico, uma amostra por minuto, ao servidor de histórico (ex.: central:9092)")
+	historyURL := flag.String("history-url", "", "Lê o histórico (tecla H e dashboard web) de um servidor de histórico em vez do banco local")
+	flag.StringVar(&dbPath, "db", "", "Arquivo do banco de histórico (padrão: $XDG_DATA_HOME/batedor/history.db, ou /var/lib/batedor/history.db como root)")
+	flag.Var(&storeSpecs, "store", "Armazenamento do histórico: sqlite, memory[:pontos], influx:URL ou prometheus:URL (pode repetir; as consultas usam o primeiro sqlite ou memory; padrão: sqlite)")
+	flag.StringVar(&storeToken, "store-token", os.Getenv("BATEDOR_STORE_TOKEN"), "Token enviado aos armazenamentos influx e prometheus (padrão: $BATEDOR_STORE_TOKEN)")
+	flag.DurationVar(&storeRetention, "retention", 0, "Apaga do histórico os registros mais antigos que isso, verificando a cada hora (ex.: 720h; padrão: guardar tudo)")
+	flag.StringVar(&recordPath, "record", "", "Grava todas as coletas, com a lista de processos, neste arquivo (JSON Lines com gzip; reproduza com batedor replay arquivo)")
+	flag.StringVar(&agentToken, "agent-token", os.Getenv("BATEDOR_AGENT_TOKEN"), "Segredo compartilhado entre agentes e frota (padrão: $BATEDOR_AGENT_TOKEN)")
+	flag.Var(&alertRules, "alert", "Regra de alerta no formato métrica>limite[:duração], ex.: psi_io_full_avg10>10:1m (pode repetir)")
+	flag.StringVar(&procRoot, "proc-root", procRoot, "Raiz do procfs lida diretamente (ex.: /host/proc)")
+	flag.StringVar(&dockerSocket, "docker-socket", "", "Socket da API do Docker/Podman para exibir nomes e imagens dos contêineres (ex.: /var/run/docker.sock)")
+	flag.StringVar(&kubeLogRoot, "kube-log-root", kubeLogRoot, "Diretório com os logs do kubelet (containers/ e pods/), usado para nomear pods e contêineres")
+	flag.StringVar(&kubeletURL, "kubelet-url", "", "URL da API do kubelet para nomear pods e contêineres (ex.: https://127.0.0.1:10250)")
+	flag.StringVar(&kubeletTokenFile, "kubelet-token-file", "", "Arquivo com o token Bearer para a API do kubelet (ex.: o do service account)")
+	flag.BoolVar(&kubeletInsecureTLS, "kubelet-insecure-tls", false, "Não verificar o certificado do kubelet (autoassinado na maioria dos clusters)")
+	flag.StringVar(&sysRoot, "sys-root", sysRoot, "Raiz do sysfs lida diretamente (ex.: /host/sys ou uma árvore falsa para testes)")
 	flag.Parse()
 
+	if v := os.Getenv("BATEDOR_WEB_USER"); v != "" && len(webConfig.Users) == 0 {
+		if err := webConfig.Users.Set(v); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if (webConfig.CertFile == "") != (webConfig.KeyFile == "") {
+		log.Fatal("--web-tls-cert e --web-tls-key devem ser usados juntos")
+	}
+	if webConfig.SelfSigned && webConfig.CertFile != "" {
+		log.Fatal("use --web-tls-self-signed ou --web-tls-cert/--web-tls-key, não ambos")
+	}
+
+	if (agentTLS.CertFile == "") != (agentTLS.KeyFile == "") {
+		log.Fatal("--agent-tls-cert e --agent-tls-key devem ser usados juntos")
+	}
+	if agentTLS.SelfSigned && agentTLS.CertFile != "" {
+		log.Fatal("use --agent-tls-self-signed ou --agent-tls-cert/--agent-tls-key, não ambos")
+	}
+
+	if *historyServerAddr != "" {
+		if err := runHistoryServer(*historyServerAddr); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	// O TLS das conexões com os agentes vale também para o servidor de
+	// histórico, que recebe o mesmo token.
+	clientTLS, err := fleetTLSConfig()
+	if err != nil {
+		log.Fatalf("TLS da frota: %v", err)
+	}
+	if *pushURL != "" {
+		if agentToken == "" {
+			log.Fatal("--push exige --agent-token (ou BATEDOR_AGENT_TOKEN)")
+		}
+		historyPush = newHistoryPusher(*pushURL, clientTLS)
+	}
+	if *historyURL != "" {
+		history = newRemoteHistory(*historyURL, clientTLS)
+	}
+	if recordPath != "" {
+		if recorder, err = NewRecorder(recordPath); err != nil {
+			log.Fatalf("--record: %v", err)
+		}
+	}
+	if *agentAddr != "" {
+		log.Fatal(runAgent(*agentAddr))
+	}
+
+	// Sem banco, o Batedor segue sem histórico; a tecla H mostra o motivo.
+	migrateLegacyDB = true
 	if err := initDatabase(); err != nil {
-		log.Fatalf("Falha ao inicializar banco de dados: %v", err)
+		log.Printf("Histórico desativado: %v", err)
 	}
 
 	if *webFlag {
@@ -125,14 +243,34 @@ func main() {
 	}
 
 	app := NewApp()
-	if err := app.Start(); err != nil {
+	if *fleetFlag != "" {
+		app.fleet = NewFleet(strings.Split(*fleetFlag, ","), clientTLS)
+	}
+	// SIGTERM e SIGHUP encerram a TUI como o Q, para gravar o histórico pendente.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		<-signals
+		app.app.Stop()
+	}()
+	err = app.Start()
+	app.fleet.Close()
+	closeDatabase()
+	if cerr := recorder.Close(); cerr != nil {
+		log.Printf("Falha ao fechar a gravação: %v", cerr)
+	}
+	if err != nil {
 		log.Fatalf("Erro ao iniciar aplicação TUI: %v", err)
 	}
 }
 
 // --- FUNÇÕES AUXILIARES DE COLETA DE DADOS ---
+// publicIPClient consulta o IP público com prazo, para que o relatório, que
+// espera a resposta, não fique parado sem rede.
+var publicIPClient = &http.Client{Timeout: 5 * time.Second}
+
 func getPublicIP() string {
-	resp, err := http.Get("https://api.ipify.org")
+	resp, err := publicIPClient.Get("https://api.ipify.org")
 	if err != nil {
 		return "N/A"
 	}
@@ -145,13 +283,25 @@ func getPublicIP() string {
 }
 
 func getLatency() int64 {
-	start := time.Now()
-	conn, err := net.DialTimeout("tcp", "8.8.8.8:53", 2*time.Second)
+	rtt, err := measureLatency(latencyTarget, 2*time.Second)
 	if err != nil {
 		return -1
 	}
+	return rtt.Milliseconds()
+}
+
+// latencyTarget é o destino da medição de latência exibida na TUI.
+const latencyTarget = "8.8.8.8:53"
+
+// measureLatency mede o tempo para abrir uma conexão TCP com addr.
+func measureLatency(addr string, timeout time.Duration) (time.Duration, error) {
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return 0, err
+	}
 	defer conn.Close()
-	return time.Since(start).Milliseconds()
+	return time.Since(start), nil
 }
 
 func getPrimaryInterfaceInfo() (string, string) {
@@ -212,11 +362,52 @@ func NewApp() *App {
   [white]K[-]:      Encerrar o processo selecionado (pede confirmação).
   [white]H[-]:      Abrir a tela com o Histórico de uso de CPU/Memória.
   [white]F1[-]:     Exibir esta tela de Ajuda.
+  [white]F2[-]:     Detalhes da CPU (carga, iowait/steal, interrupções, frequência).
+  [white]F3[-]:     Detalhes da Memória (cache, swap, huge pages, pressão).
+  [white]F4[-]:     Pressão de recursos (PSI) de CPU, memória e E/S.
+  [white]F5[-]:     Sensores: temperaturas, ventoinhas e consumo de energia.
+  [white]F6[-]:     Bateria: carga, autonomia, saúde e consumo.
+  [white]F7[-]:     Cgroups (slices e serviços do systemd): CPU, memória, E/S e PIDs.
+  [white]F8[-]:     Contêineres (Docker, Podman, containerd, CRI-O): CPU, memória, rede e E/S.
+  [white]F9[-]:     Pods do Kubernetes, agrupando os contêineres de cada pod.
+  [white]F10[-]:    Frota: resumo dos agentes remotos (--fleet) e troca do host exibido.
   [white]Q[-]:      Sair do Batedor.
   (Use as setas para cima/baixo para navegar na lista de processos)
 
 [green]Tela de Histórico:[-]
-  [white]C / M[-]:  Alternar entre o gráfico de CPU e Memória.
+  [white]C / M[-]:  Exibir o gráfico de CPU / Memória.
+  [white]Tab[-]:    Percorrer as demais séries gravadas (swap, cache, pressão...).
+  [white]O[-]:      Alternar entre os hosts do histórico e a média de todos eles.
+  [white]← / →[-]:  Mover o cursor e ver os maiores consumidores naquele momento.
+  [white]E[-]:      Exportar a série exibida para um CSV no diretório atual.
+  [white]Esc[-]:    Remover o cursor.
+  [white]Q[-]:      Voltar para a tela principal.
+
+[green]Telas de Detalhes da CPU e de Sensores:[-]
+  [white]↑ / ↓[-]:  Rolar a lista de núcleos.
+  [white]Q[-]:      Voltar para a tela principal.
+
+[green]Telas de Detalhes da Memória, de Pressão (PSI) e de Bateria:[-]
+  [white]Q[-]:      Voltar para a tela principal.
+
+[green]Telas de Cgroups, Contêineres e Pods:[-]
+  [white]/[-]:      Filtrar pelo caminho do cgroup ou pelo nome/ID/imagem (Enter ou Esc voltam à tabela).
+  [white]C / M / I / N[-]: Ordenar por CPU, Memória, E/S ou Nome.
+  [white]P / R[-]:  Ordenar por PIDs (cgroups) ou por tráfego de Rede (contêineres e pods).
+  [white]Enter[-]:  Ver os processos do item selecionado.
+  [white]Esc[-]:    Voltar da lista de processos.
+  [white]Q[-]:      Voltar para a tela principal.
+
+[green]Reprodução (batedor replay):[-]
+  [white]Espaço[-]: Pausar e continuar (no fim, recomeça).
+  [white]← / →[-]:  Voltar / avançar 10 segundos.
+  [white][ / ][-]:  Voltar / avançar 1 minuto.
+  [white]+ / -[-]:  Dobrar / reduzir à metade a velocidade (0,25x a 16x).
+  (K e a tela de Histórico ficam desativados)
+
+[green]Tela de Frota:[-]
+  [white]↑ / ↓[-]:  Escolher o host.
+  [white]Enter[-]:  Exibir o host escolhido na tela principal (a linha "local" volta ao host local).
   [white]Q[-]:      Voltar para a tela principal.
 
 [green]Tela de Ajuda:[-]
@@ -233,19 +424,21 @@ func NewApp() *App {
 	netWidget := NewNetBox()
 	historyWidget := NewHistoryGraph()
 
-	initialNetCounters, _ := gopsNet.IOCounters(false)
-	var sentStart, recvStart uint64
-	if len(initialNetCounters) > 0 {
-		sentStart, recvStart = initialNetCounters[0].BytesSent, initialNetCounters[0].BytesRecv
-	}
-	ifaceName, ifaceIP := getPrimaryInterfaceInfo()
-
 	a := &App{
 		app:           tview.NewApplication(),
 		pages:         tview.NewPages(),
 		splash:        splashScreen,
 		history:       historyWidget,
 		help:          helpWidget,
+		cpuDetails:    NewCPUDetailsBox(),
+		memDetails:    NewMemDetailsBox(),
+		psiBox:        NewPSIBox(),
+		sensorsBox:    NewSensorsBox(),
+		batteryBox:    NewBatteryBox(),
+		cgroupView:    NewCgroupView(),
+		containerView: NewContainerView(),
+		podView:       NewPodView(),
+		fleetView:     NewFleetView(),
 		cpuBox:        cpuWidget,
 		memBox:        memWidget,
 		netBox:        netWidget,
@@ -254,29 +447,16 @@ func NewApp() *App {
 		processTable:  tview.NewTable().SetSelectable(true, false).SetFixed(1, 0),
 		processFilter: tview.NewInputField().SetLabel("Filtrar Processos (Nome): ").SetLabelColor(tcell.ColorYellow),
 		sortInfo:      tview.NewTextView().SetDynamicColors(true).SetTextAlign(tview.AlignCenter),
+		collector:     NewCollector(),
 		state: AppState{
-			processSortBy:        "cpu",
-			lastNetCheck:         time.Now(),
-			motherboardInfo:      getMotherboardInfo(),
-			netBytesSentStart:    sentStart,
-			netBytesRecvStart:    recvStart,
-			lastNetBytesSent:     sentStart,
-			lastNetBytesRecv:     recvStart,
-			lastGlobalNetCheck:   time.Now(),
-			primaryInterfaceName: ifaceName,
-			primaryInterfaceIP:   ifaceIP,
+			processSortBy: "cpu",
 		},
 	}
 
-	go func() {
-		a.state.publicIP = getPublicIP()
-		a.state.latency = getLatency()
-	}()
-
 	a.diskBox.SetBorder(true).SetTitle("Uso de Disco")
 	a.sysInfoBox.SetBorder(true).SetTitle("Informações do Sistema")
 	a.processTable.SetBorder(true).SetTitle("Processos ([P]ID / [K]ill / [H]istórico / [F1] Ajuda)")
-	a.sortInfo.SetBorder(true).SetTitle("Ordenação")
+	a.sortInfo.SetBorder(true).SetTitle("Ordenação e Alertas")
 
 	a.confirmation = tview.NewModal().
 		AddButtons([]string{"Sim", "Não"}).
@@ -298,6 +478,15 @@ func NewApp() *App {
 	a.pages.AddPage("splash", a.splash, true, true)
 	a.pages.AddPage("main", a.grid, true, false)
 	a.pages.AddPage("history", a.history, true, false)
+	a.pages.AddPage("cpu", a.cpuDetails, true, false)
+	a.pages.AddPage("mem", a.memDetails, true, false)
+	a.pages.AddPage("psi", a.psiBox, true, false)
+	a.pages.AddPage("sensors", a.sensorsBox, true, false)
+	a.pages.AddPage("battery", a.batteryBox, true, false)
+	a.pages.AddPage("cgroups", a.cgroupView, true, false)
+	a.pages.AddPage("containers", a.containerView, true, false)
+	a.pages.AddPage("pods", a.podView, true, false)
+	a.pages.AddPage("fleet", a.fleetView, true, false)
 	a.pages.AddPage("help", a.help, true, false)
 	a.pages.AddPage("confirmation", a.confirmation, true, false)
 
@@ -305,24 +494,11 @@ func NewApp() *App {
 }
 
 func (a *App) Start() error {
-	go func() {
-		logTicker := time.NewTicker(1 * time.Minute)
-		defer logTicker.Stop()
-		for {
-			<-logTicker.C
-			logMetric("cpu_usage", a.state.cpuUsage)
-			logMetric("mem_usage", a.state.memUsage)
-		}
-	}()
-
-	go func() {
-		ticker := time.NewTicker(1 * time.Second)
-		defer ticker.Stop()
-		for {
-			a.collectAndDistributeData()
-			<-ticker.C
-		}
-	}()
+	if a.replay != nil {
+		go a.runReplayLoop()
+	} else {
+		go a.runLive()
+	}
 
 	a.app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		frontPage, _ := a.pages.GetFrontPage()
@@ -334,18 +510,131 @@ func (a *App) Start() error {
 			switch event.Rune() {
 			case 'q', 'Q':
 				a.pages.SwitchToPage("main")
-			case 'c', 'C', 'm', 'M':
-				a.history.ToggleMetric()
+			case 'c', 'C':
+				a.history.SetMetric("cpu_usage")
+			case 'm', 'M':
+				a.history.SetMetric("mem_usage")
+			case 'o', 'O':
+				a.history.NextHost()
+			case 'e', 'E':
+				a.history.Export()
+			}
+			switch event.Key() {
+			case tcell.KeyTab:
+				a.history.NextMetric(1)
+				return nil
+			case tcell.KeyBacktab:
+				a.history.NextMetric(-1)
+				return nil
+			case tcell.KeyLeft:
+				a.history.MoveCursor(-1)
+				return nil
+			case tcell.KeyRight:
+				a.history.MoveCursor(1)
+				return nil
+			case tcell.KeyEscape:
+				a.history.ClearCursor()
+				return nil
+			}
+			return event
+		}
+		if frontPage == "mem" || frontPage == "psi" || frontPage == "battery" {
+			if event.Rune() == 'q' || event.Rune() == 'Q' {
+				a.pages.SwitchToPage("main")
+				return nil
+			}
+			return event
+		}
+		if frontPage == "cpu" || frontPage == "sensors" {
+			scroll := a.cpuDetails.Scroll
+			if frontPage == "sensors" {
+				scroll = a.sensorsBox.Scroll
+			}
+			switch event.Key() {
+			case tcell.KeyUp:
+				scroll(-1)
+				return nil
+			case tcell.KeyDown:
+				scroll(1)
+				return nil
+			}
+			if event.Rune() == 'q' || event.Rune() == 'Q' {
+				a.pages.SwitchToPage("main")
+				return nil
+			}
+			return event
+		}
+		if frontPage == "fleet" {
+			if event.Key() == tcell.KeyEnter {
+				if addr, ok := a.fleetView.Selected(); ok {
+					a.mu.Lock()
+					a.state.source = addr
+					a.mu.Unlock()
+					a.pages.SwitchToPage("main")
+				}
+				return nil
+			}
+			if event.Rune() == 'q' || event.Rune() == 'Q' {
+				a.pages.SwitchToPage("main")
+				return nil
 			}
 			return event
 		}
+		if view := a.tableView(frontPage); view != nil {
+			if view.FilterFocused() {
+				if event.Key() == tcell.KeyEnter || event.Key() == tcell.KeyEscape {
+					a.app.SetFocus(view)
+					return nil
+				}
+				return event
+			}
+			switch event.Rune() {
+			case 'q', 'Q':
+				a.pages.SwitchToPage("main")
+				return nil
+			case '/':
+				a.app.SetFocus(view.Filter())
+				return nil
+			}
+			return view.HandleKey(event)
+		}
 		if frontPage != "main" {
 			return event
 		}
+		if a.replay != nil && a.replayKey(event) == nil {
+			return nil
+		}
 		switch event.Key() {
 		case tcell.KeyF1:
 			a.pages.SwitchToPage("help")
 			return nil
+		case tcell.KeyF2:
+			a.pages.SwitchToPage("cpu")
+			return nil
+		case tcell.KeyF3:
+			a.pages.SwitchToPage("mem")
+			return nil
+		case tcell.KeyF4:
+			a.pages.SwitchToPage("psi")
+			return nil
+		case tcell.KeyF5:
+			a.pages.SwitchToPage("sensors")
+			return nil
+		case tcell.KeyF6:
+			a.pages.SwitchToPage("battery")
+			return nil
+		case tcell.KeyF7:
+			a.pages.SwitchToPage("cgroups")
+			return nil
+		case tcell.KeyF8:
+			a.pages.SwitchToPage("containers")
+			return nil
+		case tcell.KeyF9:
+			a.pages.SwitchToPage("pods")
+			return nil
+		case tcell.KeyF10:
+			a.pages.SwitchToPage("fleet")
+			return nil
 		case tcell.KeyCtrlC:
 			a.app.Stop()
 			return nil
@@ -367,6 +656,10 @@ func (a *App) Start() error {
 		case 'p', 'P':
 			a.state.processSortBy = "pid"
 		}
+		if a.replay != nil {
+			// Pausada, a reprodução só reordena a tabela quando acordada.
+			a.replay.notify()
+		}
 		return event
 	})
 
@@ -380,203 +673,303 @@ func (a *App) Start() error {
 	return a.app.SetRoot(a.pages, true).Run()
 }
 
-func (a *App) collectAndDistributeData() {
-	allCores, _ := cpu.Percent(0, true)
-	memInfo, _ := mem.VirtualMemory()
-	diskInfo, _ := disk.Usage("/")
-	hostInfo, _ := host.Info()
-	netCounters, _ := gopsNet.IOCounters(false)
-	procs, _ := process.Processes()
+// runLive coleta a cada segundo e grava o histórico a cada minuto. Na
+// reprodução, runReplayLoop faz esse papel.
+func (a *App) runLive() {
+	go func() {
+		logTicker := time.NewTicker(1 * time.Minute)
+		defer logTicker.Stop()
+		for {
+			<-logTicker.C
+			a.mu.RLock()
+			snap := a.state.last
+			a.mu.RUnlock()
+			if snap == nil {
+				continue
+			}
 
-	now := time.Now()
-	duration := now.Sub(a.state.lastNetCheck).Seconds()
-	var recvRate, sentRate uint64
-	var currentNet gopsNet.IOCountersStat
-	if duration > 0.1 && len(netCounters) > 0 {
-		currentNet = netCounters[0]
-		recvRate = uint64(float64(currentNet.BytesRecv-a.state.lastNetBytesRecv) / duration)
-		sentRate = uint64(float64(currentNet.BytesSent-a.state.lastNetBytesSent) / duration)
-		a.state.lastNetBytesRecv = currentNet.BytesRecv
-		a.state.lastNetBytesSent = currentNet.BytesSent
-	}
-	a.state.lastNetCheck = now
+			// A mesma amostra vai para o banco local (host "") e para o
+			// servidor central (com o hostname).
+			batch := newHistoryBatch(snapshotHostname(snap), time.Now(), snap)
+			if dbWriter != nil {
+				local := batch
+				local.Host = ""
+				if err := dbWriter.Enqueue(local); err != nil {
+					log.Printf("Falha ao gravar histórico: %v", err)
+				}
+			}
+			historyPush.Push(batch)
+		}
+	}()
 
-	if time.Since(a.state.lastGlobalNetCheck) > 30*time.Second {
-		go func() {
-			a.state.publicIP = getPublicIP()
-			a.state.latency = getLatency()
-		}()
-		a.state.lastGlobalNetCheck = time.Now()
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+	for {
+		a.collectAndDistributeData()
+		<-ticker.C
 	}
+}
 
-	var totalCPU float64
-	for _, c := range allCores {
-		totalCPU += c
-	}
-	if len(allCores) > 0 {
-		a.state.cpuUsage = totalCPU / float64(len(allCores))
-	}
-	if memInfo != nil {
-		a.state.memUsage = memInfo.UsedPercent
+// tableView é uma tela com filtro e tabela navegável (cgroups, contêineres, pods).
+type tableView interface {
+	tview.Primitive
+	Filter() *tview.InputField
+	FilterFocused() bool
+	HandleKey(event *tcell.EventKey) *tcell.EventKey
+}
+
+// tableView devolve a tela com filtro e tabela da página, ou nil.
+func (a *App) tableView(page string) tableView {
+	switch page {
+	case "cgroups":
+		return a.cgroupView
+	case "containers":
+		return a.containerView
+	case "pods":
+		return a.podView
+	}
+	return nil
+}
+
+func (a *App) collectAndDistributeData() {
+	snap := a.collector.Collect()
+	if err := recorder.Write(snap); err != nil {
+		log.Printf("Falha ao gravar a sessão: %v", err)
+	}
+
+	a.mu.Lock()
+	a.state.last = snap
+	source := a.state.source
+	a.mu.Unlock()
+
+	// A tela principal pode estar exibindo um agente da frota.
+	view := snap
+	if source != "" {
+		view = &Snapshot{}
+		if remote, _ := a.fleet.Latest(source); remote != nil {
+			view = remote
+		}
 	}
 
 	a.app.QueueUpdateDraw(func() {
-		a.updateAllTUIWidgets(allCores, memInfo, diskInfo, hostInfo, &currentNet, recvRate, sentRate, procs)
+		a.fleetView.Update(snap, a.fleet.Status(), source)
+		a.updateAllTUIWidgets(view)
 	})
 
 	if webHub != nil {
-		webData := a.prepareWebData(allCores, memInfo, recvRate, sentRate, procs)
+		webData := a.prepareWebData(snap)
 		jsonData, err := json.Marshal(webData)
 		if err == nil {
-			webHub.broadcast <- jsonData
+			webHub.publish <- hubPublish{legacy: jsonData, snap: snap}
 		}
 	}
 }
 
-func (a *App) updateAllTUIWidgets(allCores []float64, memInfo *mem.VirtualMemoryStat, diskInfo *disk.UsageStat, hostInfo *host.InfoStat, currentNet *gopsNet.IOCountersStat, recvRate, sentRate uint64, procs []*process.Process) {
-	if len(allCores) > 0 {
-		a.cpuBox.Update(allCores)
+func (a *App) updateAllTUIWidgets(snap *Snapshot) {
+	if len(snap.Cores) > 0 {
+		a.cpuBox.Update(snap.Cores)
 	}
-	if memInfo != nil {
-		a.memBox.AddData(memInfo.UsedPercent)
+	if snap.Mem != nil {
+		a.memBox.AddData(snap.Mem.UsedPercent)
 	}
-
-	if diskInfo != nil {
+	a.cpuDetails.Update(snap.CPU)
+	a.memDetails.Update(MemDetails{
+		Virtual:     snap.Mem,
+		Swap:        snap.Swap,
+		SwapInRate:  snap.SwapInRate,
+		SwapOutRate: snap.SwapOutRate,
+		Pressure:    snap.Pressure.Memory,
+	})
+	a.psiBox.Update(snap.Pressure, a.collector.AlertRules(), snap.Alerts)
+	a.sensorsBox.Update(snap.Sensors)
+	a.batteryBox.Update(snap.PowerSupply)
+	a.cgroupView.Update(snap.Cgroups, snap.Procs)
+	a.containerView.Update(snap.Containers, snap.Cgroups, snap.Procs)
+	a.podView.Update(snap.Pods, snap.Cgroups, snap.Procs)
+
+	if diskInfo := snap.Disk; diskInfo != nil {
 		a.diskBox.SetText(fmt.Sprintf("[yellow]Total: [white]%.2f GB\n[green]Usado: [white]%.2f GB (%.2f%%)\n[blue]Livre: [white]%.2f GB",
 			float64(diskInfo.Total)/1e9, float64(diskInfo.Used)/1e9, diskInfo.UsedPercent, float64(diskInfo.Free)/1e9))
 	}
-	if hostInfo != nil {
+	if hostInfo := snap.Host; hostInfo != nil {
 		uptimeString := (time.Duration(hostInfo.Uptime) * time.Second).String()
 		a.sysInfoBox.SetText(fmt.Sprintf("[yellow]Hostname: [white]%s\n[yellow]SO: [white]%s\n[yellow]Placa-Mãe: [white]%s\n[yellow]Atividade: [white]%s",
-			hostInfo.Hostname, hostInfo.Platform, a.state.motherboardInfo, uptimeString))
-	}
-
-	if currentNet != nil {
-		netInfoData := NetInfo{
-			DownloadRate:    recvRate,
-			UploadRate:      sentRate,
-			DownloadSession: currentNet.BytesRecv - a.state.netBytesRecvStart,
-			UploadSession:   currentNet.BytesSent - a.state.netBytesSentStart,
-			PublicIP:        a.state.publicIP,
-			Latency:         a.state.latency,
-			InterfaceName:   a.state.primaryInterfaceName,
-			LocalIP:         a.state.primaryInterfaceIP,
-		}
-		a.netBox.Update(netInfoData)
+			hostInfo.Hostname, hostInfo.Platform, snap.Motherboard, uptimeString))
 	}
 
-	a.updateProcessTable(procs)
-	a.sortInfo.SetText(fmt.Sprintf("Ordenando por: [yellow]%s", strings.ToUpper(a.state.processSortBy)))
-}
-
-func (a *App) prepareWebData(cores []float64, memInfo *mem.VirtualMemoryStat, recvRate, sentRate uint64, procs []*process.Process) WebData {
-	procDataList := []ProcData{}
-	filter := strings.ToLower(a.processFilter.GetText())
+	a.netBox.Update(snap.Net)
 
-	for _, p := range procs {
-		cmd, _ := p.Name()
-		if filter != "" && !strings.Contains(strings.ToLower(cmd), filter) {
-			continue
-		}
-		cpuPercent, _ := p.CPUPercent()
-		memPercent, _ := p.MemoryPercent()
-		user, _ := p.Username()
+	a.updateProcessTable(snap.Procs)
+	a.sortInfo.SetText(a.statusText(snap))
+}
 
-		if cpuPercent > 0.01 || memPercent > 0.1 {
-			procDataList = append(procDataList, ProcData{
-				PID:     p.Pid,
-				User:    user,
-				CPU:     cpuPercent,
-				Mem:     memPercent,
-				Command: cmd,
-			})
-		}
+// statusText monta o quadro de ordenação e alertas: a origem dos dados, a
+// ordenação e os alertas ativos da coleta.
+func (a *App) statusText(snap *Snapshot) string {
+	source := a.sourceText()
+	if a.replay != nil {
+		source = a.replay.StatusText()
 	}
+	return source + fmt.Sprintf("Ordenando por: [yellow]%s", strings.ToUpper(a.state.processSortBy)) + alertsText(snap.Alerts)
+}
 
-	sort.Slice(procDataList, func(i, j int) bool {
-		switch a.state.processSortBy {
-		case "mem":
-			return procDataList[i].Mem > procDataList[j].Mem
-		case "pid":
-			return procDataList[i].PID < procDataList[j].PID
-		default:
-			return procDataList[i].CPU > procDataList[j].CPU
-		}
-	})
-
-	if len(procDataList) > 50 {
-		procDataList = procDataList[:50]
+// sourceText indica qual agente da frota está na tela principal (vazio
+// para o host local).
+func (a *App) sourceText() string {
+	a.mu.RLock()
+	source := a.state.source
+	a.mu.RUnlock()
+	if source == "" {
+		return ""
 	}
-
-	return WebData{
-		CPU: CPUData{Cores: cores},
-		Mem: MemData{UsedPercent: memInfo.UsedPercent},
-		Net: NetDataWeb{
-			DownloadRate: formatBytes(recvRate),
-			UploadRate:   formatBytes(sentRate),
-			PublicIP:     a.state.publicIP,
-			Latency:      a.state.latency,
-		},
-		Procs: procDataList,
+	status := "[green]online"
+	if _, online := a.fleet.Latest(source); !online {
+		status = "[red]offline"
 	}
+	return fmt.Sprintf("[white]Host remoto: [yellow]%s %s[white] (F10 troca; K desativado)\n", tview.Escape(source), status)
 }
 
-func (a *App) updateProcessTable(procs []*process.Process) {
-	filter := strings.ToLower(a.processFilter.GetText())
-	type ProcInfo struct {
-		pid     int32
-		user    string
-		command string
-		cpu     float64
-		mem     float32
+// alertsText monta a lista de alertas ativos exibida abaixo da ordenação.
+func alertsText(alerts []Alert) string {
+	if len(alerts) == 0 {
+		return ""
 	}
-	var procList []ProcInfo
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("\n\n[red]Alertas ativos (%d):", len(alerts)))
+	for _, alert := range alerts {
+		sb.WriteString("\n[white]" + tview.Escape(alert.String()))
+	}
+	return sb.String()
+}
+
+func (a *App) prepareWebData(snap *Snapshot) WebData {
+	return newWebData(snap, a.processFilter.GetText(), a.state.processSortBy, 50)
+}
+
+// collectProcData lê CPU, memória, usuário e nome de cada processo uma única
+// vez por ciclo, descartando os que estão praticamente ociosos.
+func collectProcData(procs []*process.Process) []ProcData {
+	var list []ProcData
 	for _, p := range procs {
-		cmd, _ := p.Name()
-		if filter != "" && !strings.Contains(strings.ToLower(cmd), filter) {
-			continue
-		}
 		cpuPercent, _ := p.CPUPercent()
 		memPercent, _ := p.MemoryPercent()
 		if cpuPercent < 0.01 && memPercent < 0.01 {
 			continue
 		}
+		cmd, _ := p.Name()
 		user, _ := p.Username()
-		procList = append(procList, ProcInfo{p.Pid, user, cmd, cpuPercent, memPercent})
+		list = append(list, ProcData{
+			PID:     p.Pid,
+			User:    user,
+			CPU:     cpuPercent,
+			Mem:     memPercent,
+			Command: cmd,
+		})
+	}
+	return list
+}
+
+// webVisibleProcs aplica o corte do dashboard web, mais rigoroso que o da
+// TUI: só processos com CPU acima de 0,01% ou memória acima de 0,1%.
+func webVisibleProcs(procs []ProcData) []ProcData {
+	var list []ProcData
+	for _, p := range procs {
+		if p.CPU > 0.01 || p.Mem > 0.1 {
+			list = append(list, p)
+		}
 	}
-	sort.Slice(procList, func(i, j int) bool {
-		switch a.state.processSortBy {
+	return list
+}
+
+// filterAndSortProcs aplica o filtro por nome e a ordenação escolhida,
+// devolvendo uma nova lista.
+func filterAndSortProcs(procs []ProcData, filter, sortBy string) []ProcData {
+	filter = strings.ToLower(filter)
+	list := make([]ProcData, 0, len(procs))
+	for _, p := range procs {
+		if filter != "" && !strings.Contains(strings.ToLower(p.Command), filter) {
+			continue
+		}
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		switch sortBy {
 		case "mem":
-			return procList[i].mem > procList[j].mem
+			return list[i].Mem > list[j].Mem
 		case "pid":
-			return procList[i].pid < procList[j].pid
+			return list[i].PID < list[j].PID
 		default:
-			return procList[i].cpu > procList[j].cpu
+			return list[i].CPU > list[j].CPU
 		}
 	})
+	return list
+}
+
+// topProcesses devolve a união dos n processos que mais usam CPU com os n
+// que mais usam memória.
+func topProcesses(procs []ProcData, n int) []ProcData {
+	seen := make(map[int32]bool)
+	var top []ProcData
+	for _, sortBy := range []string{"cpu", "mem"} {
+		sorted := filterAndSortProcs(procs, "", sortBy)
+		for i := 0; i < len(sorted) && i < n; i++ {
+			if !seen[sorted[i].PID] {
+				seen[sorted[i].PID] = true
+				top = append(top, sorted[i])
+			}
+		}
+	}
+	return top
+}
+
+func (a *App) updateProcessTable(procs []ProcData) {
+	procList := filterAndSortProcs(procs, a.processFilter.GetText(), a.state.processSortBy)
+
+	// A coluna de pod só aparece em nós Kubernetes.
+	showPods := false
+	for _, p := range procList {
+		if p.Pod != "" {
+			showPods = true
+			break
+		}
+	}
 
 	a.processTable.Clear()
-	headers := []string{"PID", "Usuário", "CPU%", "MEM%", "Comando"}
+	headers := []string{"PID", "Usuário", "CPU%", "MEM%", "Contêiner", "Comando"}
+	if showPods {
+		headers = []string{"PID", "Usuário", "CPU%", "MEM%", "Contêiner", "Pod", "Comando"}
+	}
 	for i, header := range headers {
 		a.processTable.SetCell(0, i, tview.NewTableCell(header).SetTextColor(tcell.ColorYellow).SetSelectable(false))
 	}
 	for i, p := range procList {
 		row := i + 1
-		a.processTable.SetCell(row, 0, tview.NewTableCell(strconv.Itoa(int(p.pid))).SetTextColor(tcell.ColorWhite))
-		a.processTable.SetCell(row, 1, tview.NewTableCell(p.user).SetTextColor(tcell.ColorBlue))
-		a.processTable.SetCell(row, 2, tview.NewTableCell(fmt.Sprintf("%.2f", p.cpu)).SetTextColor(tcell.ColorGreen))
-		a.processTable.SetCell(row, 3, tview.NewTableCell(fmt.Sprintf("%.2f", p.mem)).SetTextColor(tcell.ColorGreen))
-		a.processTable.SetCell(row, 4, tview.NewTableCell(p.command).SetTextColor(tcell.ColorWhite))
+		a.processTable.SetCell(row, 0, tview.NewTableCell(strconv.Itoa(int(p.PID))).SetTextColor(tcell.ColorWhite))
+		a.processTable.SetCell(row, 1, tview.NewTableCell(p.User).SetTextColor(tcell.ColorBlue))
+		a.processTable.SetCell(row, 2, tview.NewTableCell(fmt.Sprintf("%.2f", p.CPU)).SetTextColor(tcell.ColorGreen))
+		a.processTable.SetCell(row, 3, tview.NewTableCell(fmt.Sprintf("%.2f", p.Mem)).SetTextColor(tcell.ColorGreen))
+		a.processTable.SetCell(row, 4, tview.NewTableCell(p.Container).SetTextColor(tcell.ColorAqua).SetMaxWidth(20))
+		if showPods {
+			a.processTable.SetCell(row, 5, tview.NewTableCell(p.Pod).SetTextColor(tcell.ColorGreen).SetMaxWidth(40))
+		}
+		a.processTable.SetCell(row, len(headers)-1, tview.NewTableCell(p.Command).SetTextColor(tcell.ColorWhite))
 	}
 }
 
 func (a *App) showKillConfirmation() {
+	a.mu.RLock()
+	remote := a.state.source != ""
+	a.mu.RUnlock()
+	if remote || a.replay != nil {
+		// Os PIDs exibidos são de outra máquina ou de outro momento.
+		return
+	}
 	row, _ := a.processTable.GetSelection()
 	if row <= 0 {
 		return
 	}
 	pidCell := a.processTable.GetCell(row, 0)
-	cmdCell := a.processTable.GetCell(row, 4)
+	cmdCell := a.processTable.GetCell(row, a.processTable.GetColumnCount()-1)
 	pid, err := strconv.Atoi(pidCell.Text)
 	if err != nil {
 		return
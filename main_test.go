@@ -0,0 +1,48 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func procPIDs(procs []ProcData) []int32 {
+	pids := make([]int32, len(procs))
+	for i, p := range procs {
+		pids[i] = p.PID
+	}
+	return pids
+}
+
+func TestTopProcesses(t *testing.T) {
+	procs := []ProcData{
+		{PID: 1, CPU: 50, Mem: 1},
+		{PID: 2, CPU: 40, Mem: 30},
+		{PID: 3, CPU: 1, Mem: 20},
+		{PID: 4, CPU: 30, Mem: 2},
+		{PID: 5, CPU: 0, Mem: 0.5},
+	}
+	// Os 2 maiores em CPU, depois os 2 maiores em memória que ainda não
+	// entraram.
+	if got, want := procPIDs(topProcesses(procs, 2)), []int32{1, 2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("topProcesses(2) = %v, want %v", got, want)
+	}
+	if got := topProcesses(procs, 10); len(got) != len(procs) {
+		t.Errorf("topProcesses(10) = %v, want os %d processos", procPIDs(got), len(procs))
+	}
+	if got := topProcesses(nil, 5); len(got) != 0 {
+		t.Errorf("topProcesses(nil) = %v", got)
+	}
+}
+
+func TestWebVisibleProcs(t *testing.T) {
+	procs := []ProcData{
+		{PID: 1, CPU: 0.02},            // Acima do corte de CPU.
+		{PID: 2, Mem: 0.05},            // Visível na TUI, mas não no dashboard.
+		{PID: 3, CPU: 0.01, Mem: 0.1},  // Os cortes são exclusivos.
+		{PID: 4, Mem: 0.2},             // Acima do corte de memória.
+		{PID: 5, CPU: 0.005, Mem: 0.0}, // Ocioso.
+	}
+	if got, want := procPIDs(webVisibleProcs(procs)), []int32{1, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("webVisibleProcs() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,137 @@
+// /*********************************************************************************
+// * Projeto:     Batedor
+// * Componente:  MemDetailsBox - Detalhamento da memória, swap, huge pages e pressão
+// *********************************************************************************/
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/shirou/gopsutil/v3/mem"
+)
+
+// MemDetails armazena os dados exibidos na tela de memória.
+type MemDetails struct {
+	Virtual     *mem.VirtualMemoryStat
+	Swap        *mem.SwapMemoryStat
+	SwapInRate  float64 // Bytes/s trazidos do swap.
+	SwapOutRate float64 // Bytes/s enviados ao swap.
+	Pressure    PSIStat
+}
+
+// MemDetailsBox é o widget da tela de detalhes da memória.
+type MemDetailsBox struct {
+	*tview.Box
+	mu      sync.RWMutex
+	details MemDetails
+}
+
+// NewMemDetailsBox cria um novo widget MemDetailsBox.
+func NewMemDetailsBox() *MemDetailsBox {
+	return &MemDetailsBox{
+		Box: tview.NewBox().SetBorder(true).SetTitle(tview.Escape(" Detalhes da Memória | [Q] Voltar ")),
+	}
+}
+
+// Update atualiza os dados exibidos.
+func (m *MemDetailsBox) Update(details MemDetails) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.details = details
+}
+
+// memLine formata uma linha "rótulo: valor (x%) [barra]".
+func memLine(label string, value, total uint64, color string, barWidth int) string {
+	var pct float64
+	if total > 0 {
+		pct = float64(value) / float64(total) * 100
+	}
+	return fmt.Sprintf("[yellow]%-14s[white] %10s (%5.1f%%) [%s]%s", label+":", formatBytesNetBox(value), pct, color, usageBar(pct, barWidth))
+}
+
+// psiColor destaca valores de pressão preocupantes.
+func psiColor(v float64) string {
+	if v > 20 {
+		return "red"
+	} else if v > 5 {
+		return "yellow"
+	}
+	return "green"
+}
+
+// psiLine formata uma linha some/full com as três médias.
+func psiLine(label string, l PSILine) string {
+	return fmt.Sprintf("[yellow]%-6s[white] avg10: [%s]%6.2f%%[white]  avg60: [%s]%6.2f%%[white]  avg300: [%s]%6.2f%%",
+		label, psiColor(l.Avg10), l.Avg10, psiColor(l.Avg60), l.Avg60, psiColor(l.Avg300), l.Avg300)
+}
+
+// Draw desenha o widget na tela.
+func (m *MemDetailsBox) Draw(screen tcell.Screen) {
+	m.Box.Draw(screen)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	x, y, width, height := m.GetInnerRect()
+	if width <= 0 || height <= 0 {
+		return
+	}
+
+	barWidth := width - 42
+	var lines []string
+	if v := m.details.Virtual; v != nil {
+		lines = append(lines,
+			fmt.Sprintf("[green]Memória física: [white]%s", formatBytesNetBox(v.Total)),
+			memLine("Usada", v.Used, v.Total, "aqua", barWidth),
+			memLine("Disponível", v.Available, v.Total, "green", barWidth),
+			memLine("Livre", v.Free, v.Total, "green", barWidth),
+			memLine("Buffers", v.Buffers, v.Total, "blue", barWidth),
+			memLine("Cache", v.Cached, v.Total, "blue", barWidth),
+			memLine("Compartilhada", v.Shared, v.Total, "blue", barWidth),
+			memLine("Slab", v.Slab, v.Total, "blue", barWidth),
+			memLine("Suja (dirty)", v.Dirty, v.Total, "yellow", barWidth),
+			"",
+		)
+	}
+
+	if s := m.details.Swap; s != nil {
+		lines = append(lines, fmt.Sprintf("[green]Swap: [white]%s", formatBytesNetBox(s.Total)))
+		if s.Total > 0 {
+			lines = append(lines, memLine("Usado", s.Used, s.Total, "red", barWidth))
+		} else {
+			lines = append(lines, "[white]Nenhuma área de swap configurada.")
+		}
+		lines = append(lines,
+			fmt.Sprintf("[yellow]%-14s[white] %s   [yellow]Saída:[white] %s", "Entrada:", formatBytes(uint64(m.details.SwapInRate)), formatBytes(uint64(m.details.SwapOutRate))),
+			"")
+	}
+
+	if v := m.details.Virtual; v != nil {
+		lines = append(lines, "[green]Huge pages:")
+		if v.HugePagesTotal > 0 {
+			used := v.HugePagesTotal - v.HugePagesFree
+			lines = append(lines,
+				fmt.Sprintf("[yellow]%-14s[white] %d de %d em uso (%s cada)   [yellow]Reservadas:[white] %d   [yellow]Excedentes:[white] %d",
+					"Estáticas:", used, v.HugePagesTotal, formatBytesNetBox(v.HugePageSize), v.HugePagesRsvd, v.HugePagesSurp))
+		} else {
+			lines = append(lines, fmt.Sprintf("[yellow]%-14s[white] nenhuma reservada", "Estáticas:"))
+		}
+		lines = append(lines, fmt.Sprintf("[yellow]%-14s[white] %s", "Transparentes:", formatBytesNetBox(v.AnonHugePages)), "")
+	}
+
+	lines = append(lines, "[green]Pressão de memória (PSI):")
+	if p := m.details.Pressure; p.Available {
+		lines = append(lines, psiLine("some", p.Some), psiLine("full", p.Full))
+	} else {
+		lines = append(lines, "[white]Indisponível neste kernel (/proc/pressure/memory).")
+	}
+
+	for i, line := range lines {
+		if i >= height {
+			break
+		}
+		tview.Print(screen, line, x+1, y+i, width-2, tview.AlignLeft, tcell.ColorWhite)
+	}
+}
@@ -0,0 +1,192 @@
+// /*********************************************************************************
+// * Projeto:     Batedor
+// * Componente:  Migrations - Versões do esquema do banco de histórico
+// *********************************************************************************/
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// migration leva o banco de uma versão do esquema para a seguinte.
+type migration struct {
+	name string
+	up   func(tx *sql.Tx) error
+}
+
+// migrations são as mudanças do esquema, em ordem; a versão do banco é
+// quantas delas já foram aplicadas. Bancos anteriores à tabela
+// schema_version começam da versão 0, por isso cada passo também precisa
+// funcionar sobre um banco que já tenha parte das tabelas. Nunca altere um
+// passo publicado: acrescente outro no fim.
+var migrations = []migration{
+	{"séries de métricas", func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS metrics (
+			timestamp DATETIME NOT NULL,
+			metric_name TEXT NOT NULL,
+			value REAL NOT NULL,
+			PRIMARY KEY (timestamp, metric_name)
+		)`)
+		return err
+	}},
+	{"amostras de processos", func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS process_samples (
+			timestamp DATETIME NOT NULL,
+			pid INTEGER NOT NULL,
+			user TEXT NOT NULL,
+			command TEXT NOT NULL,
+			cpu REAL NOT NULL,
+			mem REAL NOT NULL,
+			PRIMARY KEY (timestamp, pid)
+		);
+		CREATE INDEX IF NOT EXISTS idx_process_samples_timestamp ON process_samples (timestamp);`)
+		return err
+	}},
+	{"coluna host", func(tx *sql.Tx) error {
+		if err := addHostColumn(tx, "metrics", metricsSchema, "timestamp, metric_name, value"); err != nil {
+			return fmt.Errorf("tabela metrics: %v", err)
+		}
+		if err := addHostColumn(tx, "process_samples", processSamplesSchema, "timestamp, pid, user, command, cpu, mem"); err != nil {
+			return fmt.Errorf("tabela process_samples: %v", err)
+		}
+		_, err := tx.Exec(`
+		DROP INDEX IF EXISTS idx_process_samples_timestamp;
+		CREATE INDEX IF NOT EXISTS idx_process_samples_host_timestamp ON process_samples (host, timestamp);
+		CREATE INDEX IF NOT EXISTS idx_metrics_name_host_timestamp ON metrics (metric_name, host, timestamp);`)
+		return err
+	}},
+	{"trilha de auditoria", func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS audit_log (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			timestamp DATETIME NOT NULL,
+			user TEXT NOT NULL,
+			role TEXT NOT NULL,
+			remote_addr TEXT NOT NULL,
+			action TEXT NOT NULL,
+			pid INTEGER NOT NULL,
+			command TEXT NOT NULL,
+			detail TEXT NOT NULL,
+			outcome TEXT NOT NULL
+		)`)
+		return err
+	}},
+	{"instantes em UTC", func(tx *sql.Tx) error {
+		for _, table := range []string{"metrics", "process_samples"} {
+			if err := timestampsToUTC(tx, table); err != nil {
+				return fmt.Errorf("tabela %s: %v", table, err)
+			}
+		}
+		return nil
+	}},
+}
+
+// schemaVersion devolve quantas migrações o banco já recebeu.
+func schemaVersion(conn *sql.DB) (int, error) {
+	if _, err := conn.Exec("CREATE TABLE IF NOT EXISTS schema_version (version INTEGER NOT NULL)"); err != nil {
+		return 0, err
+	}
+	var version int
+	err := conn.QueryRow("SELECT version FROM schema_version").Scan(&version)
+	if err == sql.ErrNoRows {
+		_, err = conn.Exec("INSERT INTO schema_version (version) VALUES (0)")
+		return 0, err
+	}
+	return version, err
+}
+
+// migrate aplica as migrações pendentes, cada uma em sua transação junto
+// com a nova versão, de modo que uma falha não deixa o banco pela metade.
+func migrate(conn *sql.DB) error {
+	version, err := schemaVersion(conn)
+	if err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("o banco está na versão %d do esquema, mais nova que a suportada (%d); atualize o Batedor", version, len(migrations))
+	}
+
+	for i := version; i < len(migrations); i++ {
+		m := migrations[i]
+		tx, err := conn.Begin()
+		if err != nil {
+			return err
+		}
+		if err := m.up(tx); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migração %d (%s): %v", i+1, m.name, err)
+		}
+		if _, err := tx.Exec("UPDATE schema_version SET version = ?", i+1); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("migração %d (%s): %v", i+1, m.name, err)
+		}
+	}
+	return nil
+}
+
+// hasColumn indica se a tabela já tem a coluna.
+func hasColumn(tx *sql.Tx, table, column string) (bool, error) {
+	rows, err := tx.Query("PRAGMA table_info(" + table + ")")
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			cid        int
+			name, kind string
+			notNull    int
+			dflt       sql.NullString
+			pk         int
+		)
+		if err := rows.Scan(&cid, &name, &kind, &notNull, &dflt, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+// addHostColumn migra tabelas criadas antes da coluna host. Como o SQLite
+// não altera chaves primárias, a tabela é recriada com o esquema atual e os
+// registros antigos são copiados como pertencentes ao host local.
+func addHostColumn(tx *sql.Tx, table, schema, columns string) error {
+	ok, err := hasColumn(tx, table, "host")
+	if err != nil || ok {
+		return err
+	}
+
+	stmts := []string{
+		"ALTER TABLE " + table + " RENAME TO " + table + "_old",
+		"CREATE TABLE " + schema,
+		"INSERT INTO " + table + " (" + columns + ") SELECT " + columns + " FROM " + table + "_old",
+		"DROP TABLE " + table + "_old",
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// timestampsToUTC regrava em UTC os instantes gravados com o fuso de quem
+// coletou. O SQLite compara as datas como texto, então um instante de outro
+// fuso ficava fora das consultas por intervalo. strftime guarda só os
+// milissegundos, precisão de sobra para o histórico; os zeros à direita
+// saem, como no formato gravado pelo driver.
+func timestampsToUTC(tx *sql.Tx, table string) error {
+	_, err := tx.Exec(`
+		UPDATE OR REPLACE ` + table + `
+		SET timestamp = rtrim(rtrim(strftime('%Y-%m-%d %H:%M:%f', timestamp), '0'), '.') || '+00:00'
+		WHERE timestamp NOT LIKE '%+00:00' AND strftime('%Y-%m-%d %H:%M:%f', timestamp) IS NOT NULL`)
+	return err
+}
@@ -0,0 +1,237 @@
+// /*********************************************************************************
+// * Projeto:     Batedor
+// * Componente:  PSI - Leitura do Pressure Stall Information do kernel
+// *********************************************************************************/
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// PSILine é uma linha ("some" ou "full") de /proc/pressure/<recurso>: o
+// percentual do tempo em que tarefas ficaram paradas esperando o recurso.
+type PSILine struct {
+	Avg10  float64
+	Avg60  float64
+	Avg300 float64
+	Total  uint64 // Tempo total parado, em microssegundos.
+}
+
+// PSIStat guarda as duas linhas de pressão de um recurso.
+type PSIStat struct {
+	Available bool // Falso em kernels sem PSI (ou com psi=0).
+	Some      PSILine
+	Full      PSILine
+}
+
+// PressureInfo agrupa a pressão dos recursos monitorados.
+type PressureInfo struct {
+	CPU    PSIStat
+	Memory PSIStat
+	IO     PSIStat
+}
+
+// psiResources lista os recursos de /proc/pressure, com o rótulo exibido.
+var psiResources = []struct {
+	Name  string
+	Label string
+}{
+	{"cpu", "CPU"},
+	{"memory", "Memória"},
+	{"io", "E/S"},
+}
+
+// Get devolve a pressão de um recurso pelo nome usado em /proc/pressure.
+func (p PressureInfo) Get(resource string) PSIStat {
+	switch resource {
+	case "cpu":
+		return p.CPU
+	case "memory":
+		return p.Memory
+	case "io":
+		return p.IO
+	}
+	return PSIStat{}
+}
+
+// readPressure lê a pressão de todos os recursos. Em kernels sem PSI os
+// recursos simplesmente ficam com Available = false.
+func readPressure() PressureInfo {
+	var p PressureInfo
+	p.CPU, _ = readPSI("cpu")
+	p.Memory, _ = readPSI("memory")
+	p.IO, _ = readPSI("io")
+	return p
+}
+
+// psiMetrics acrescenta as séries de pressão (psi_<recurso>_<some|full>_avg<N>).
+func (p PressureInfo) psiMetrics(m map[string]float64) {
+	for _, res := range psiResources {
+		st := p.Get(res.Name)
+		if !st.Available {
+			continue
+		}
+		for _, kind := range []struct {
+			name string
+			line PSILine
+		}{{"some", st.Some}, {"full", st.Full}} {
+			m[fmt.Sprintf("psi_%s_%s_avg10", res.Name, kind.name)] = kind.line.Avg10
+			m[fmt.Sprintf("psi_%s_%s_avg60", res.Name, kind.name)] = kind.line.Avg60
+			m[fmt.Sprintf("psi_%s_%s_avg300", res.Name, kind.name)] = kind.line.Avg300
+		}
+	}
+}
+
+func init() {
+	// Registra rótulos para todas as séries de pressão.
+	for _, res := range psiResources {
+		for _, kind := range []string{"some", "full"} {
+			for _, avg := range []string{"10", "60", "300"} {
+				metricInfos[fmt.Sprintf("psi_%s_%s_avg%s", res.Name, kind, avg)] = MetricInfo{
+					Label: fmt.Sprintf("Pressão de %s (%s, %ss)", res.Label, kind, avg),
+					Unit:  "%",
+				}
+			}
+		}
+	}
+}
+
+// readPSI lê /proc/pressure/<resource> ("cpu", "memory" ou "io").
+func readPSI(resource string) (PSIStat, error) {
+	var st PSIStat
+	f, err := os.Open(procPath("pressure", resource))
+	if err != nil {
+		return st, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Formato: "some avg10=0.00 avg60=0.00 avg300=0.00 total=0"
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		var line PSILine
+		for _, field := range fields[1:] {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			switch kv[0] {
+			case "avg10":
+				line.Avg10, _ = strconv.ParseFloat(kv[1], 64)
+			case "avg60":
+				line.Avg60, _ = strconv.ParseFloat(kv[1], 64)
+			case "avg300":
+				line.Avg300, _ = strconv.ParseFloat(kv[1], 64)
+			case "total":
+				line.Total, _ = strconv.ParseUint(kv[1], 10, 64)
+			}
+		}
+		switch fields[0] {
+		case "some":
+			st.Some = line
+		case "full":
+			st.Full = line
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return st, err
+	}
+	st.Available = true
+	return st, nil
+}
+
+// PSIBox é o widget da tela de pressão (PSI) de CPU, memória e E/S.
+type PSIBox struct {
+	*tview.Box
+	mu       sync.RWMutex
+	pressure PressureInfo
+	rules    []AlertRule
+	alerts   []Alert
+}
+
+// NewPSIBox cria um novo widget PSIBox.
+func NewPSIBox() *PSIBox {
+	return &PSIBox{
+		Box: tview.NewBox().SetBorder(true).SetTitle(tview.Escape(" Pressão de Recursos (PSI) | [Q] Voltar ")),
+	}
+}
+
+// Update atualiza a pressão exibida e os alertas relacionados.
+func (p *PSIBox) Update(pressure PressureInfo, rules []AlertRule, alerts []Alert) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pressure = pressure
+	p.rules = rules
+	p.alerts = alerts
+}
+
+// Draw desenha o widget na tela.
+func (p *PSIBox) Draw(screen tcell.Screen) {
+	p.Box.Draw(screen)
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	x, y, width, height := p.GetInnerRect()
+	if width <= 0 || height <= 0 {
+		return
+	}
+
+	lines := []string{
+		"[white]Percentual do tempo em que tarefas ficaram paradas esperando o recurso.",
+		"[white]\"some\": ao menos uma tarefa parada; \"full\": todas as tarefas paradas ao mesmo tempo.",
+		"",
+	}
+	for _, res := range psiResources {
+		st := p.pressure.Get(res.Name)
+		lines = append(lines, fmt.Sprintf("[green]%s:", res.Label))
+		if !st.Available {
+			lines = append(lines, fmt.Sprintf("[white]Indisponível (/proc/pressure/%s).", res.Name), "")
+			continue
+		}
+		barWidth := width - 70
+		lines = append(lines,
+			psiLine("some", st.Some)+fmt.Sprintf("  [%s]%s", psiColor(st.Some.Avg10), usageBar(st.Some.Avg10, barWidth)),
+			psiLine("full", st.Full)+fmt.Sprintf("  [%s]%s", psiColor(st.Full.Avg10), usageBar(st.Full.Avg10, barWidth)),
+			"")
+	}
+
+	// Regras de alerta que usam séries de pressão.
+	active := make(map[string]Alert)
+	for _, a := range p.alerts {
+		active[a.Rule] = a
+	}
+	lines = append(lines, "[green]Regras de alerta de pressão (--alert):")
+	found := false
+	for _, rule := range p.rules {
+		if !strings.HasPrefix(rule.Metric, "psi_") {
+			continue
+		}
+		found = true
+		if a, ok := active[rule.Expr]; ok {
+			lines = append(lines, "[red]  DISPARADO: "+tview.Escape(a.String()))
+		} else {
+			lines = append(lines, "[green]  ok: [white]"+tview.Escape(rule.Expr))
+		}
+	}
+	if !found {
+		lines = append(lines, "[white]  Nenhuma. Exemplo: --alert 'psi_io_full_avg10>10:1m'")
+	}
+
+	for i, line := range lines {
+		if i >= height {
+			break
+		}
+		tview.Print(screen, line, x+1, y+i, width-2, tview.AlignLeft, tcell.ColorWhite)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestReadPSI(t *testing.T) {
+	fakeProc(t, map[string]string{
+		"pressure/memory": "some avg10=1.50 avg60=0.75 avg300=0.25 total=123456\nfull avg10=0.50 avg60=0.10 avg300=0.00 total=4567",
+		// Kernels anteriores ao 5.13 não têm a linha "full" para a CPU.
+		"pressure/cpu": "some avg10=12.00 avg60=8.00 avg300=4.00 total=999",
+		"pressure/io":  "some avg10=x avg60=2.00 total\n\nfull avg10=3.00",
+	})
+
+	tests := []struct {
+		resource string
+		want     PSIStat
+	}{
+		{"memory", PSIStat{Available: true,
+			Some: PSILine{Avg10: 1.5, Avg60: 0.75, Avg300: 0.25, Total: 123456},
+			Full: PSILine{Avg10: 0.5, Avg60: 0.1, Total: 4567}}},
+		{"cpu", PSIStat{Available: true, Some: PSILine{Avg10: 12, Avg60: 8, Avg300: 4, Total: 999}}},
+		// Campos ilegíveis ficam zerados sem descartar o resto.
+		{"io", PSIStat{Available: true, Some: PSILine{Avg60: 2}, Full: PSILine{Avg10: 3}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.resource, func(t *testing.T) {
+			got, err := readPSI(tt.resource)
+			if err != nil || got != tt.want {
+				t.Errorf("readPSI(%q) = %+v, %v; want %+v", tt.resource, got, err, tt.want)
+			}
+		})
+	}
+
+	// Sem PSI no kernel, o recurso fica indisponível.
+	if st, err := readPSI("irq"); err == nil || st.Available {
+		t.Errorf("readPSI sem o arquivo = %+v, %v", st, err)
+	}
+}
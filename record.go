@@ -0,0 +1,542 @@
+// /*********************************************************************************
+// * Projeto:     Batedor
+// * Componente:  Record - Gravação das coletas e reprodução na TUI
+// *********************************************************************************/
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// Parâmetros da gravação e da reprodução.
+const (
+	recordFlushInterval = 5 * time.Second // Perda máxima se o processo morrer sem fechar o arquivo.
+	replayMaxGap        = 5 * time.Second // Intervalos maiores na gravação (pausas, suspensão) são encurtados.
+	replayWarmup        = 120             // Coletas anteriores repassadas aos gráficos depois de um salto.
+	replayMinSpeed      = 0.25
+	replayMaxSpeed      = 16
+)
+
+// recordPath é o arquivo de --record; vazio desativa a gravação.
+var recordPath string
+
+// recordMagic identifica a linha de cabeçalho de cada sessão gravada.
+const recordMagic = "batedor-record"
+
+// RecordHeader abre cada sessão no arquivo. Gravações feitas em sessões
+// diferentes no mesmo arquivo são concatenadas, cada uma com seu cabeçalho.
+type RecordHeader struct {
+	Format  string
+	Version int
+	Started time.Time
+	Host    string
+}
+
+// Recorder grava cada coleta como uma linha JSON em um arquivo gzip. O
+// arquivo é aberto para acréscimo: membros gzip concatenados continuam
+// sendo um gzip válido, e zcat ou jq leem a gravação inteira.
+type Recorder struct {
+	mu        sync.Mutex
+	file      *os.File
+	gz        *gzip.Writer
+	enc       *json.Encoder
+	lastFlush time.Time
+	err       error
+}
+
+// NewRecorder abre (ou continua) a gravação em path e escreve o cabeçalho da
+// sessão. Um arquivo existente é conferido antes: acrescentar depois de um
+// membro gzip cortado (o Batedor foi morto no meio da gravação) faria a
+// leitura parar nele e perder as sessões seguintes, então o final cortado é
+// reparado; um arquivo que não é uma gravação é recusado.
+func NewRecorder(path string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	end, err := scanRecording(f)
+	switch {
+	case err == nil:
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		kept, err := repairRecording(f, end)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("falha ao reparar o final cortado de %s: %v", path, err)
+		}
+		log.Printf("Gravação %s: final cortado reparado (%d linhas recuperadas)", path, kept)
+	default:
+		f.Close()
+		return nil, fmt.Errorf("%s não é uma gravação do Batedor válida (%v); use outro arquivo", path, err)
+	}
+
+	gz := gzip.NewWriter(f)
+	r := &Recorder{file: f, gz: gz, enc: json.NewEncoder(gz), lastFlush: time.Now()}
+	host, _ := os.Hostname()
+	header := struct{ Recording RecordHeader }{RecordHeader{Format: recordMagic, Version: 1, Started: time.Now(), Host: host}}
+	if err := r.enc.Encode(header); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// countingReader conta os bytes consumidos pelo leitor gzip. Como implementa
+// io.ByteReader, o gzip não acrescenta um buffer próprio e a contagem
+// marca exatamente o fim de cada membro.
+type countingReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+// scanRecording percorre os membros gzip de f e devolve onde termina o
+// último membro íntegro, que é onde começa o membro com problema, se houver.
+// io.ErrUnexpectedEOF indica um membro cortado no fim do arquivo.
+func scanRecording(f *os.File) (int64, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	cr := &countingReader{r: bufio.NewReader(f)}
+	gz, err := gzip.NewReader(cr)
+	if err == io.EOF {
+		return 0, nil // Arquivo novo ou vazio.
+	}
+	if err != nil {
+		return 0, err
+	}
+	// O primeiro membro tem que começar com o cabeçalho de uma sessão.
+	gz.Multistream(false)
+	prefix := make([]byte, len(`{"Recording":`))
+	if _, err := io.ReadFull(gz, prefix); err != nil || string(prefix) != `{"Recording":` {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return 0, err
+		}
+		return 0, errors.New("cabeçalho ausente")
+	}
+	var start int64
+	for {
+		if _, err := io.Copy(io.Discard, gz); err != nil {
+			return start, err
+		}
+		start = cr.n
+		err := gz.Reset(cr)
+		if err == io.EOF {
+			return start, nil
+		}
+		if err != nil {
+			return start, err
+		}
+		gz.Multistream(false)
+	}
+}
+
+// repairRecording descarta o membro cortado que começa em end. As linhas
+// completas que ainda dão para ler dele (o que foi enviado ao disco até o
+// último Flush) são regravadas em um membro fechado. Devolve quantas linhas
+// foram mantidas.
+func repairRecording(f *os.File, end int64) (int, error) {
+	if _, err := f.Seek(end, io.SeekStart); err != nil {
+		return 0, err
+	}
+	var lines []byte
+	if gz, err := gzip.NewReader(bufio.NewReader(f)); err == nil {
+		gz.Multistream(false)
+		lines, _ = io.ReadAll(gz)
+	}
+	lines = lines[:bytes.LastIndexByte(lines, '\n')+1]
+
+	if err := f.Truncate(end); err != nil {
+		return 0, err
+	}
+	if len(lines) > 0 {
+		gz := gzip.NewWriter(f)
+		if _, err := gz.Write(lines); err != nil {
+			return 0, err
+		}
+		if err := gz.Close(); err != nil {
+			return 0, err
+		}
+	}
+	return bytes.Count(lines, []byte("\n")), nil
+}
+
+// Write acrescenta uma coleta à gravação. Depois da primeira falha (disco
+// cheio, por exemplo), as coletas seguintes são ignoradas e a falha é
+// devolvida uma única vez.
+func (r *Recorder) Write(snap *Snapshot) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return nil
+	}
+	r.err = r.enc.Encode(snap)
+	if r.err == nil && time.Since(r.lastFlush) >= recordFlushInterval {
+		r.lastFlush = time.Now()
+		r.err = r.gz.Flush()
+	}
+	if r.err != nil {
+		r.err = fmt.Errorf("gravação %s interrompida: %w", r.file.Name(), r.err)
+		return r.err
+	}
+	return nil
+}
+
+// Close termina o membro gzip e fecha o arquivo.
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.err = os.ErrClosed // Coletas ainda em andamento são descartadas.
+	err := r.gz.Close()
+	if cerr := r.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// recorder é a gravação em andamento; nil sem --record.
+var recorder *Recorder
+
+// LoadRecording lê uma gravação inteira. Um final truncado (o Batedor foi
+// morto antes de fechar o arquivo) não é erro: valem as coletas lidas até ali.
+func LoadRecording(path string) ([]*Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return nil, fmt.Errorf("%s não é uma gravação do Batedor: %v", path, err)
+	}
+	defer gz.Close()
+
+	var snaps []*Snapshot
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 0, 1<<20), 64<<20)
+	line := 0
+	headers := 0
+	for scanner.Scan() {
+		line++
+		data := scanner.Bytes()
+		if bytes.HasPrefix(data, []byte(`{"Recording":`)) {
+			var header struct{ Recording RecordHeader }
+			if err := json.Unmarshal(data, &header); err != nil || header.Recording.Format != recordMagic {
+				return nil, fmt.Errorf("%s:%d: cabeçalho inválido", path, line)
+			}
+			if header.Recording.Version > 1 {
+				return nil, fmt.Errorf("%s: gravação na versão %d; este Batedor lê até a versão 1", path, header.Recording.Version)
+			}
+			headers++
+			continue
+		}
+		if headers == 0 {
+			return nil, fmt.Errorf("%s não é uma gravação do Batedor", path)
+		}
+		snap := &Snapshot{}
+		if err := json.Unmarshal(data, snap); err != nil {
+			if !scanner.Scan() && scanner.Err() == io.ErrUnexpectedEOF {
+				break // Linha cortada no fim de uma gravação truncada.
+			}
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		snaps = append(snaps, snap)
+	}
+	if err := scanner.Err(); err != nil && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+	}
+	if len(snaps) == 0 {
+		return nil, fmt.Errorf("%s não tem coletas", path)
+	}
+	// Sessões acrescentadas fora de ordem (relógio ajustado) são reordenadas.
+	sort.SliceStable(snaps, func(i, j int) bool { return snaps[i].Timestamp.Before(snaps[j].Timestamp) })
+	return snaps, nil
+}
+
+// Replay controla a reprodução de uma gravação: posição, pausa e velocidade.
+type Replay struct {
+	mu     sync.Mutex
+	snaps  []*Snapshot
+	pos    int
+	paused bool
+	speed  float64
+	moved  bool          // Avançou uma coleta desde o último quadro.
+	jumped bool          // Saltou desde o último quadro; os gráficos são refeitos.
+	wake   chan struct{} // Acorda o laço de reprodução após uma tecla.
+}
+
+// NewReplay prepara a reprodução a partir da primeira coleta.
+func NewReplay(snaps []*Snapshot, speed float64) *Replay {
+	return &Replay{snaps: snaps, speed: clampSpeed(speed), jumped: true, wake: make(chan struct{}, 1)}
+}
+
+func clampSpeed(speed float64) float64 {
+	if speed < replayMinSpeed {
+		return replayMinSpeed
+	}
+	if speed > replayMaxSpeed {
+		return replayMaxSpeed
+	}
+	return speed
+}
+
+func (r *Replay) notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// TogglePause pausa ou continua. No fim da gravação, continuar volta ao início.
+func (r *Replay) TogglePause() {
+	r.mu.Lock()
+	r.paused = !r.paused
+	if !r.paused && r.pos == len(r.snaps)-1 {
+		r.pos = 0
+		r.jumped = true
+	}
+	r.mu.Unlock()
+	r.notify()
+}
+
+// Seek avança (ou volta, com d negativo) d no tempo da gravação.
+func (r *Replay) Seek(d time.Duration) {
+	r.mu.Lock()
+	target := r.snaps[r.pos].Timestamp.Add(d)
+	pos := sort.Search(len(r.snaps), func(i int) bool { return !r.snaps[i].Timestamp.Before(target) })
+	if d < 0 && pos > 0 && pos < len(r.snaps) && r.snaps[pos].Timestamp.After(target) {
+		pos--
+	}
+	if pos >= len(r.snaps) {
+		pos = len(r.snaps) - 1
+	}
+	if pos != r.pos {
+		r.pos = pos
+		r.jumped = true
+	}
+	r.mu.Unlock()
+	r.notify()
+}
+
+// ChangeSpeed multiplica a velocidade por factor, entre 0,25x e 16x.
+func (r *Replay) ChangeSpeed(factor float64) {
+	r.mu.Lock()
+	r.speed = clampSpeed(r.speed * factor)
+	r.mu.Unlock()
+	r.notify()
+}
+
+// frame devolve a coleta atual e as que devem ser repassadas aos widgets:
+// nenhuma se a posição não mudou, a atual depois de um avanço normal e, depois
+// de um salto (jumped), também as anteriores, para os gráficos mostrarem o que
+// havia naquele momento.
+func (r *Replay) frame() (snaps []*Snapshot, cur *Snapshot, jumped bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cur = r.snaps[r.pos]
+	switch {
+	case r.jumped:
+		r.jumped, r.moved = false, false
+		start := r.pos - replayWarmup
+		if start < 0 {
+			start = 0
+		}
+		return r.snaps[start : r.pos+1], cur, true
+	case r.moved:
+		r.moved = false
+		return r.snaps[r.pos : r.pos+1], cur, false
+	}
+	return nil, cur, false
+}
+
+// next é quanto esperar até a próxima coleta; zero com a reprodução parada.
+func (r *Replay) next() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.paused || r.pos >= len(r.snaps)-1 {
+		return 0
+	}
+	gap := r.snaps[r.pos+1].Timestamp.Sub(r.snaps[r.pos].Timestamp)
+	if gap > replayMaxGap {
+		gap = replayMaxGap
+	}
+	return time.Duration(float64(gap) / r.speed)
+}
+
+// advance passa para a próxima coleta, pausando no fim da gravação.
+func (r *Replay) advance() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pos < len(r.snaps)-1 {
+		r.pos++
+		r.moved = true
+	}
+	if r.pos == len(r.snaps)-1 {
+		r.paused = true
+	}
+}
+
+// StatusText descreve a reprodução na linha de ordenação da tela principal.
+func (r *Replay) StatusText() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cur := r.snaps[r.pos].Timestamp
+	elapsed := cur.Sub(r.snaps[0].Timestamp).Truncate(time.Second)
+	total := r.snaps[len(r.snaps)-1].Timestamp.Sub(r.snaps[0].Timestamp).Truncate(time.Second)
+	state := fmt.Sprintf("[green]%gx", r.speed)
+	switch {
+	case r.pos == len(r.snaps)-1:
+		state = "[red]fim (Espaço recomeça)"
+	case r.paused:
+		state = "[red]pausado"
+	}
+	return fmt.Sprintf("[white]Reprodução: [yellow]%s[white] %s / %s %s[white]\n",
+		cur.Local().Format("2006-01-02 15:04:05"), elapsed, total, state)
+}
+
+// runReplayLoop exibe as coletas no ritmo em que foram gravadas, dividido
+// pela velocidade. As teclas acordam o laço para que saltos e pausas
+// apareçam na hora.
+func (a *App) runReplayLoop() {
+	r := a.replay
+	for {
+		frame, snap, jumped := r.frame()
+		a.mu.Lock()
+		a.state.last = snap
+		a.mu.Unlock()
+		a.app.QueueUpdateDraw(func() {
+			if jumped {
+				a.memBox.Clear()
+			}
+			for _, s := range frame {
+				a.updateAllTUIWidgets(s)
+			}
+			if len(frame) == 0 {
+				// Pausa, velocidade ou ordenação: a coleta é a mesma, então os
+				// gráficos ficam como estão.
+				a.updateProcessTable(snap.Procs)
+				a.sortInfo.SetText(a.statusText(snap))
+			}
+		})
+
+		wait := r.next()
+		if wait == 0 {
+			<-r.wake
+			continue
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+			r.advance()
+		case <-r.wake:
+			timer.Stop()
+		}
+	}
+}
+
+// runReplay implementa "batedor replay arquivo".
+func runReplay(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Uso: batedor replay [--speed 1] [--start 0s] arquivo")
+		fmt.Fprintln(fs.Output(), "Reproduz na TUI uma gravação feita com --record. Espaço pausa, ←/→ saltam 10s, [/] saltam 1min, +/- mudam a velocidade.")
+		fs.PrintDefaults()
+	}
+	speed := fs.Float64("speed", 1, "Velocidade inicial (0.25 a 16)")
+	start := fs.Duration("start", 0, "Começa esta duração depois do início da gravação")
+	paused := fs.Bool("paused", false, "Começa pausado")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	path := fs.Arg(0)
+	snaps, err := LoadRecording(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "batedor replay: %v\n", err)
+		return 1
+	}
+	r := NewReplay(snaps, *speed)
+	if *start > 0 {
+		r.Seek(*start)
+	}
+	r.paused = *paused
+
+	// O histórico e o encerramento de processos dizem respeito a esta
+	// máquina, não à gravada.
+	dbErr = fmt.Errorf("o histórico não está disponível na reprodução de %s", path)
+	app := NewApp()
+	app.replay = r
+	// A divisão dos núcleos em grupos vem do sysfs desta máquina; a gravada
+	// pode ter outra topologia.
+	app.cpuBox.groups = nil
+	if err := app.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "batedor replay: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// replayKey trata as teclas de reprodução na tela principal. Devolve nil
+// quando a tecla foi consumida.
+func (a *App) replayKey(event *tcell.EventKey) *tcell.EventKey {
+	r := a.replay
+	switch event.Key() {
+	case tcell.KeyLeft:
+		r.Seek(-10 * time.Second)
+		return nil
+	case tcell.KeyRight:
+		r.Seek(10 * time.Second)
+		return nil
+	}
+	switch event.Rune() {
+	case ' ':
+		r.TogglePause()
+	case '[':
+		r.Seek(-time.Minute)
+	case ']':
+		r.Seek(time.Minute)
+	case '+', '=':
+		r.ChangeSpeed(2)
+	case '-':
+		r.ChangeSpeed(0.5)
+	default:
+		return event
+	}
+	return nil
+}
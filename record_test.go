@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// recordSession grava uma sessão com as coletas de first até first+n-1
+// segundos. Com killed, o processo "morre" depois de um Flush: o membro gzip
+// fica sem o final e a última coleta, não enviada ao disco, se perde.
+func recordSession(t *testing.T, path string, first, n int, killed bool) {
+	t.Helper()
+	r, err := NewRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC)
+	for i := first; i < first+n; i++ {
+		if err := r.Write(&Snapshot{Timestamp: base.Add(time.Duration(i) * time.Second)}); err != nil {
+			t.Fatal(err)
+		}
+		if killed && i == first+n-2 {
+			if err := r.gz.Flush(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if killed {
+		r.file.Close()
+		return
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// recordedSeconds devolve os segundos das coletas lidas de path.
+func recordedSeconds(t *testing.T, path string) []int {
+	t.Helper()
+	snaps, err := LoadRecording(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC)
+	out := make([]int, len(snaps))
+	for i, s := range snaps {
+		out[i] = int(s.Timestamp.Sub(base) / time.Second)
+	}
+	return out
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRecorderRepairsKilledSession(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rec.jsonl.gz")
+	recordSession(t, path, 0, 3, false)
+	recordSession(t, path, 10, 3, true) // A coleta 12 não chegou ao disco.
+	recordSession(t, path, 20, 2, false)
+
+	// Sem o reparo, a leitura pararia no membro cortado e perderia 20 e 21.
+	if got, want := recordedSeconds(t, path), []int{0, 1, 2, 10, 11, 20, 21}; !equalInts(got, want) {
+		t.Errorf("coletas = %v, want %v", got, want)
+	}
+}
+
+func TestRecorderRepairsTruncatedFile(t *testing.T) {
+	for _, cut := range []int{1, 4, 9, 40} {
+		path := filepath.Join(t.TempDir(), "rec.jsonl.gz")
+		recordSession(t, path, 0, 2, false)
+		first, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recordSession(t, path, 10, 50, false)
+		// Corta o final do segundo membro, como um disco cheio ou uma cópia
+		// interrompida.
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data[:len(data)-cut], 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		recordSession(t, path, 100, 2, false)
+		got := recordedSeconds(t, path)
+		if len(got) < 4 || !equalInts(got[:2], []int{0, 1}) || !equalInts(got[len(got)-2:], []int{100, 101}) {
+			t.Errorf("corte de %d bytes: coletas = %v, want 0, 1, ... 100, 101", cut, got)
+		}
+		if st, err := os.Stat(path); err != nil || st.Size() <= first.Size() {
+			t.Errorf("corte de %d bytes: o primeiro membro não pode ser descartado (%v)", cut, err)
+		}
+	}
+}
+
+func TestRecorderRefusesOtherFiles(t *testing.T) {
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write([]byte("outro conteúdo\n"))
+	w.Close()
+	var corrupt bytes.Buffer
+	w = gzip.NewWriter(&corrupt)
+	w.Write([]byte(`{"Recording":{"Format":"batedor-record","Version":1}}` + "\n"))
+	w.Close()
+	corruptData := corrupt.Bytes()
+	corruptData[len(corruptData)-5] ^= 0xff // CRC errado.
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"texto", []byte("notas do incidente\n")},
+		{"gzip de outro arquivo", gz.Bytes()},
+		{"membro corrompido", corruptData},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "rec.jsonl.gz")
+			if err := os.WriteFile(path, tt.data, 0600); err != nil {
+				t.Fatal(err)
+			}
+			if r, err := NewRecorder(path); err == nil {
+				r.Close()
+				t.Fatal("NewRecorder() deveria recusar o arquivo")
+			}
+			if data, _ := os.ReadFile(path); !bytes.Equal(data, tt.data) {
+				t.Error("o arquivo recusado foi alterado")
+			}
+		})
+	}
+
+	// Um arquivo vazio é uma gravação nova.
+	path := filepath.Join(t.TempDir(), "vazio.jsonl.gz")
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	recordSession(t, path, 0, 1, false)
+	if got := recordedSeconds(t, path); !equalInts(got, []int{0}) {
+		t.Errorf("coletas = %v", got)
+	}
+}
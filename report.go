@@ -0,0 +1,407 @@
+// /*********************************************************************************
+// * Projeto:     Batedor
+// * Componente:  Report - Resumo não interativo do sistema (texto, Markdown, JSON)
+// *********************************************************************************/
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// checkStatus é o estado de uma verificação, com os códigos de saída dos
+// plugins do Nagios/Icinga.
+type checkStatus int
+
+const (
+	statusOK checkStatus = iota
+	statusWarning
+	statusCritical
+	statusUnknown
+)
+
+func (s checkStatus) String() string {
+	switch s {
+	case statusOK:
+		return "OK"
+	case statusWarning:
+		return "WARNING"
+	case statusCritical:
+		return "CRITICAL"
+	}
+	return "UNKNOWN"
+}
+
+func (s checkStatus) MarshalText() ([]byte, error) { return []byte(s.String()), nil }
+
+// worse devolve o estado mais grave, na ordem do Nagios: CRITICAL, WARNING,
+// UNKNOWN e OK.
+func worse(a, b checkStatus) checkStatus {
+	rank := map[checkStatus]int{statusOK: 0, statusUnknown: 1, statusWarning: 2, statusCritical: 3}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
+
+// reportFormats são os formatos aceitos por batedor report --format.
+var reportFormats = []string{"text", "markdown", "json"}
+
+// ReportUsage é o uso de memória, swap ou disco na última amostra.
+type ReportUsage struct {
+	Total   uint64
+	Used    uint64
+	Percent float64
+}
+
+// ReportCheck é um limite de --warn ou --crit conferido contra a média das
+// amostras. Sem a métrica na coleta, o estado é UNKNOWN.
+type ReportCheck struct {
+	Rule   string
+	Status checkStatus
+	Value  *float64 `json:",omitempty"`
+}
+
+// Report resume uma ou mais coletas.
+type Report struct {
+	Host        string
+	Platform    string
+	Kernel      string
+	Uptime      uint64 // Segundos.
+	Motherboard string
+	Start       time.Time
+	End         time.Time
+	Samples     int
+	Cores       int
+	Memory      *ReportUsage `json:",omitempty"`
+	Swap        *ReportUsage `json:",omitempty"`
+	Disk        *ReportUsage `json:",omitempty"` // Partição raiz.
+	Interface   string
+	LocalIP     string
+	PublicIP    string             `json:",omitempty"` // Vazio se a consulta não terminou a tempo.
+	Metrics     map[string]float64 // Média das amostras, com os nomes do histórico.
+	Peaks       map[string]float64 // Maior valor de cada série nas amostras.
+	Processes   []ProcData         // Maiores consumidores de CPU na última amostra.
+	Checks      []ReportCheck      `json:",omitempty"`
+	Status      checkStatus
+}
+
+// reportNet são o IP público e a latência do relatório. O comando os mede
+// uma vez, esperando o resultado: nas coletas, eles dependem de a consulta
+// em segundo plano do coletor ter terminado a tempo.
+type reportNet struct {
+	PublicIP string // Vazio se a consulta falhou.
+	Latency  int64  // Milissegundos; negativo sem conexão.
+}
+
+// measureReportNet consulta o IP público e a latência em paralelo.
+func measureReportNet() reportNet {
+	ipc := make(chan string, 1)
+	go func() { ipc <- getPublicIP() }()
+	n := reportNet{Latency: getLatency()}
+	if ip := <-ipc; ip != "N/A" {
+		n.PublicIP = ip
+	}
+	return n
+}
+
+// newReport monta o relatório a partir das coletas, na ordem em que foram
+// feitas, e do IP público e da latência medidos pelo comando, e confere os
+// limites.
+func newReport(snaps []*Snapshot, netInfo reportNet, top int, warn, crit []AlertRule) *Report {
+	last := snaps[len(snaps)-1]
+	r := &Report{
+		Start:       snaps[0].Timestamp,
+		End:         last.Timestamp,
+		Samples:     len(snaps),
+		Cores:       len(last.Cores),
+		Motherboard: last.Motherboard,
+		Interface:   last.Net.InterfaceName,
+		LocalIP:     last.Net.LocalIP,
+		PublicIP:    netInfo.PublicIP,
+		Metrics:     make(map[string]float64),
+		Peaks:       make(map[string]float64),
+	}
+	if h := last.Host; h != nil {
+		r.Host = h.Hostname
+		r.Platform = strings.TrimSpace(h.Platform + " " + h.PlatformVersion)
+		r.Kernel = h.KernelVersion
+		r.Uptime = h.Uptime
+	}
+	if m := last.Mem; m != nil {
+		r.Memory = &ReportUsage{Total: m.Total, Used: m.Used, Percent: m.UsedPercent}
+	}
+	if s := last.Swap; s != nil {
+		r.Swap = &ReportUsage{Total: s.Total, Used: s.Used, Percent: s.UsedPercent}
+	}
+	if d := last.Disk; d != nil {
+		r.Disk = &ReportUsage{Total: d.Total, Used: d.Used, Percent: d.UsedPercent}
+	}
+
+	counts := make(map[string]int)
+	for _, snap := range snaps {
+		for name, v := range snap.Metrics() {
+			if name == "net_latency" {
+				continue // Vem de netInfo.
+			}
+			r.Metrics[name] += v
+			counts[name]++
+			if peak, ok := r.Peaks[name]; !ok || v > peak {
+				r.Peaks[name] = v
+			}
+		}
+	}
+	for name, n := range counts {
+		r.Metrics[name] /= float64(n)
+	}
+	if netInfo.Latency >= 0 {
+		r.Metrics["net_latency"] = float64(netInfo.Latency)
+		r.Peaks["net_latency"] = float64(netInfo.Latency)
+	}
+
+	procs := filterAndSortProcs(last.Procs, "", "cpu")
+	if len(procs) > top {
+		procs = procs[:top]
+	}
+	r.Processes = procs
+
+	for _, level := range []struct {
+		rules  []AlertRule
+		status checkStatus
+	}{{crit, statusCritical}, {warn, statusWarning}} {
+		for _, rule := range level.rules {
+			check := ReportCheck{Rule: rule.Expr, Status: statusUnknown}
+			if v, ok := r.Metrics[rule.Metric]; ok {
+				check.Value = &v
+				check.Status = statusOK
+				if rule.Violated(v) {
+					check.Status = level.status
+				}
+			}
+			r.Checks = append(r.Checks, check)
+			r.Status = worse(r.Status, check.Status)
+		}
+	}
+	return r
+}
+
+// reportSection é um bloco "rótulo: valor" do relatório em texto e Markdown.
+type reportSection struct {
+	title string
+	rows  [][2]string
+}
+
+func (r *Report) sections() []reportSection {
+	metric := func(name string) string {
+		v, ok := r.Metrics[name]
+		if !ok {
+			return "N/A"
+		}
+		return formatMetricValue(v, metricInfo(name).Unit)
+	}
+	usage := func(u *ReportUsage) string {
+		if u == nil {
+			return "N/A"
+		}
+		return fmt.Sprintf("%.1f%% (%s de %s)", u.Percent, formatBytesNetBox(u.Used), formatBytesNetBox(u.Total))
+	}
+
+	cpuUsage := metric("cpu_usage")
+	if r.Samples > 1 {
+		cpuUsage += fmt.Sprintf(" (média de %d amostras; pico %.1f%%)", r.Samples, r.Peaks["cpu_usage"])
+	}
+	network := [][2]string{
+		{"Interface", fmt.Sprintf("%s (%s)", r.Interface, r.LocalIP)},
+		{"Download", metric("net_down_rate")},
+		{"Upload", metric("net_up_rate")},
+	}
+	if r.PublicIP != "" {
+		network = append(network, [2]string{"IP público", r.PublicIP})
+	}
+	if _, ok := r.Metrics["net_latency"]; ok {
+		network = append(network, [2]string{"Latência", metric("net_latency") + " ms"})
+	}
+
+	return []reportSection{
+		{"Sistema", [][2]string{
+			{"Hostname", r.Host},
+			{"SO", r.Platform},
+			{"Kernel", r.Kernel},
+			{"Placa-mãe", r.Motherboard},
+			{"Atividade", (time.Duration(r.Uptime) * time.Second).String()},
+		}},
+		{"CPU", [][2]string{
+			{"Uso", cpuUsage},
+			{"Núcleos", fmt.Sprint(r.Cores)},
+			{"Carga média", fmt.Sprintf("%s %s %s", metric("load1"), metric("load5"), metric("load15"))},
+			{"iowait / steal", metric("cpu_iowait") + " / " + metric("cpu_steal")},
+		}},
+		{"Memória", [][2]string{
+			{"RAM", usage(r.Memory)},
+			{"Disponível", metric("mem_available")},
+			{"Swap", usage(r.Swap)},
+		}},
+		{"Disco", [][2]string{
+			{"Raiz (/)", usage(r.Disk)},
+		}},
+		{"Rede", network},
+	}
+}
+
+// writeReport escreve o relatório no formato pedido.
+func writeReport(w io.Writer, format string, r *Report) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	case "markdown":
+		return writeReportMarkdown(w, r)
+	case "text":
+		return writeReportText(w, r)
+	}
+	return fmt.Errorf("formato desconhecido: %q (use %s)", format, strings.Join(reportFormats, ", "))
+}
+
+func writeReportText(w io.Writer, r *Report) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Batedor - relatório de %s em %s\n", r.Host, r.End.Format("2006-01-02 15:04:05"))
+	for _, s := range r.sections() {
+		fmt.Fprintf(&sb, "\n%s\n", s.title)
+		for _, row := range s.rows {
+			fmt.Fprintf(&sb, "  %-15s %s\n", row[0]+":", row[1])
+		}
+	}
+	fmt.Fprintf(&sb, "\nProcessos (maiores consumidores de CPU)\n")
+	fmt.Fprintf(&sb, "  %7s  %-12s %6s %6s  %s\n", "PID", "USUÁRIO", "CPU%", "MEM%", "COMANDO")
+	for _, p := range r.Processes {
+		fmt.Fprintf(&sb, "  %7d  %-12s %6.1f %6.1f  %s\n", p.PID, p.User, p.CPU, p.Mem, p.Command)
+	}
+	if len(r.Checks) > 0 {
+		fmt.Fprintf(&sb, "\nLimites\n")
+		for _, c := range r.Checks {
+			fmt.Fprintf(&sb, "  %-8s  %s\n", c.Status, c.describe())
+		}
+	}
+	fmt.Fprintf(&sb, "\nEstado: %s\n", r.Status)
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func writeReportMarkdown(w io.Writer, r *Report) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# Batedor - relatório de %s\n\n", markdownEscape(r.Host))
+	fmt.Fprintf(&sb, "%s, %d amostra(s). Estado: **%s**\n", r.End.Format("2006-01-02 15:04:05"), r.Samples, r.Status)
+	for _, s := range r.sections() {
+		fmt.Fprintf(&sb, "\n## %s\n\n", s.title)
+		for _, row := range s.rows {
+			fmt.Fprintf(&sb, "- **%s:** %s\n", row[0], markdownEscape(row[1]))
+		}
+	}
+	fmt.Fprintf(&sb, "\n## Processos\n\n| PID | Usuário | CPU%% | Mem%% | Comando |\n|---:|---|---:|---:|---|\n")
+	for _, p := range r.Processes {
+		fmt.Fprintf(&sb, "| %d | %s | %.1f | %.1f | %s |\n", p.PID, markdownEscape(p.User), p.CPU, p.Mem, markdownEscape(p.Command))
+	}
+	if len(r.Checks) > 0 {
+		fmt.Fprintf(&sb, "\n## Limites\n\n| Estado | Regra |\n|---|---|\n")
+		for _, c := range r.Checks {
+			fmt.Fprintf(&sb, "| %s | %s |\n", c.Status, markdownEscape(c.describe()))
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// describe mostra a regra e a média comparada.
+func (c ReportCheck) describe() string {
+	if c.Value == nil {
+		return c.Rule + " (métrica ausente na coleta)"
+	}
+	return fmt.Sprintf("%s (média: %.2f)", c.Rule, *c.Value)
+}
+
+// markdownEscape evita que nomes de processos e hosts quebrem as tabelas.
+var markdownEscape = strings.NewReplacer("|", `\|`, "*", `\*`, "_", `\_`, "`", "\\`").Replace
+
+// collectSamples coleta como a TUI: uma coleta inicial descartada (o uso de
+// CPU é medido entre duas coletas), seguida de n coletas a cada interval.
+func collectSamples(n int, interval time.Duration) []*Snapshot {
+	collector := NewCollector()
+	collector.Collect()
+	snaps := make([]*Snapshot, 0, n)
+	for i := 0; i < n; i++ {
+		time.Sleep(interval)
+		snaps = append(snaps, collector.Collect())
+	}
+	return snaps
+}
+
+// runReport implementa "batedor report". O código de saída segue os plugins
+// do Nagios: 0 sem limites excedidos, 1 com algum --warn, 2 com algum --crit
+// e 3 para erros de uso ou regras sobre métricas que não existem.
+func runReport(args []string) int {
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Uso: batedor report [--samples 1] [--interval 1s] [--format text|markdown|json] [--warn cpu_usage>80] [--crit cpu_usage>95]")
+		fs.PrintDefaults()
+	}
+	samples := fs.Int("samples", 1, "Número de coletas resumidas (a média vai para o relatório e para os limites)")
+	interval := fs.Duration("interval", time.Second, "Intervalo entre as coletas")
+	format := fs.String("format", "text", "Formato de saída: text, markdown ou json")
+	top := fs.Int("top", 10, "Quantos processos listar")
+	var warn, crit alertRulesFlag
+	fs.Var(&warn, "warn", "Limite de aviso no formato das regras de --alert, ex.: mem_usage>80 (pode repetir; sai com 1)")
+	fs.Var(&crit, "crit", "Limite crítico no formato das regras de --alert, ex.: disk_usage>=95 (pode repetir; sai com 2)")
+	fs.StringVar(&procRoot, "proc-root", procRoot, "Raiz do procfs lida diretamente (ex.: /host/proc)")
+	fs.StringVar(&sysRoot, "sys-root", sysRoot, "Raiz do sysfs lida diretamente (ex.: /host/sys)")
+	if err := fs.Parse(args); err != nil {
+		return int(statusUnknown)
+	}
+
+	err := func() error {
+		if fs.NArg() > 0 {
+			return fmt.Errorf("argumento inesperado: %q", fs.Arg(0))
+		}
+		if *samples < 1 || *interval <= 0 {
+			return fmt.Errorf("--samples deve ser ao menos 1 e --interval maior que zero")
+		}
+		if !validReportFormat(*format) {
+			return fmt.Errorf("formato desconhecido: %q (use %s)", *format, strings.Join(reportFormats, ", "))
+		}
+		for _, rule := range append(append([]AlertRule{}, warn...), crit...) {
+			if rule.For > 0 {
+				return fmt.Errorf("%s: o relatório compara a média das amostras; em vez da duração, use --samples e --interval", rule.Expr)
+			}
+		}
+		return nil
+	}()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "batedor report: %v\n", err)
+		return int(statusUnknown)
+	}
+
+	// O IP e a latência são medidos enquanto as coletas acontecem.
+	netc := make(chan reportNet, 1)
+	go func() { netc <- measureReportNet() }()
+	snaps := collectSamples(*samples, *interval)
+	report := newReport(snaps, <-netc, *top, warn, crit)
+	if err := writeReport(os.Stdout, *format, report); err != nil {
+		fmt.Fprintf(os.Stderr, "batedor report: %v\n", err)
+		return int(statusUnknown)
+	}
+	return int(report.Status)
+}
+
+func validReportFormat(format string) bool {
+	for _, f := range reportFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
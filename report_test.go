@@ -0,0 +1,175 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// networkRows devolve as linhas da seção de rede do relatório.
+func networkRows(r *Report) map[string]string {
+	rows := make(map[string]string)
+	for _, section := range r.sections() {
+		if section.title != "Rede" {
+			continue
+		}
+		for _, row := range section.rows {
+			rows[row[0]] = row[1]
+		}
+	}
+	return rows
+}
+
+func TestReportNetFromCommand(t *testing.T) {
+	base := time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC)
+	// A consulta em segundo plano do coletor termina em momentos diferentes:
+	// a primeira coleta ainda não tem nada, a segunda já tem IP e latência.
+	snaps := []*Snapshot{
+		{Timestamp: base, Net: NetInfo{}},
+		{Timestamp: base.Add(time.Second), Net: NetInfo{PublicIP: "198.51.100.1", Latency: 300}},
+	}
+	rule, err := parseAlertRule("net_latency>100")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		net     reportNet
+		ip      string
+		latency string
+		status  checkStatus
+	}{
+		{"medidos", reportNet{PublicIP: "203.0.113.7", Latency: 42}, "203.0.113.7", "42", statusOK},
+		{"sem rede", reportNet{Latency: -1}, "", "", statusUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newReport(snaps, tt.net, 10, []AlertRule{rule}, nil)
+			if r.PublicIP != tt.ip {
+				t.Errorf("PublicIP = %q, want %q", r.PublicIP, tt.ip)
+			}
+			if r.Status != tt.status {
+				t.Errorf("Status = %v, want %v (%+v)", r.Status, tt.status, r.Checks)
+			}
+			rows := networkRows(r)
+			if rows["IP público"] != tt.ip {
+				t.Errorf("linha do IP = %q, want %q", rows["IP público"], tt.ip)
+			}
+			if got := rows["Latência"]; !strings.HasPrefix(got, tt.latency) || (tt.latency == "") != (got == "") {
+				t.Errorf("linha da latência = %q, want %q", got, tt.latency)
+			}
+			if _, ok := r.Metrics["net_latency"]; ok != (tt.net.Latency >= 0) {
+				t.Errorf("Metrics[net_latency] presente = %v", ok)
+			}
+		})
+	}
+}
+
+func TestReportChecks(t *testing.T) {
+	base := time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC)
+	// CPU média de 50% com pico de 90%, disco em 85%, sem swap.
+	snaps := []*Snapshot{
+		{Timestamp: base, CPUUsage: 10, Disk: &disk.UsageStat{UsedPercent: 85}},
+		{Timestamp: base.Add(time.Second), CPUUsage: 90, Disk: &disk.UsageStat{UsedPercent: 85}},
+	}
+	rules := func(exprs ...string) []AlertRule {
+		var list []AlertRule
+		for _, expr := range exprs {
+			rule, err := parseAlertRule(expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			list = append(list, rule)
+		}
+		return list
+	}
+
+	tests := []struct {
+		name       string
+		warn, crit []string
+		want       checkStatus
+		checks     []checkStatus
+	}{
+		{"sem limites", nil, nil, statusOK, nil},
+		// A média (50%), não o pico, é comparada.
+		{"média abaixo do aviso", []string{"cpu_usage>60"}, nil, statusOK, []checkStatus{statusOK}},
+		{"aviso", []string{"cpu_usage>40"}, []string{"cpu_usage>80"}, statusWarning, []checkStatus{statusOK, statusWarning}},
+		{"crítico vence o aviso", []string{"cpu_usage>40"}, []string{"disk_usage>=85"}, statusCritical, []checkStatus{statusCritical, statusWarning}},
+		{"métrica ausente", []string{"swap_usage>10"}, nil, statusUnknown, []checkStatus{statusUnknown}},
+		{"aviso vence métrica ausente", []string{"swap_usage>10", "cpu_usage>40"}, nil, statusWarning, []checkStatus{statusUnknown, statusWarning}},
+		{"crítico com métrica ausente", nil, []string{"swap_usage>10", "disk_usage>80"}, statusCritical, []checkStatus{statusUnknown, statusCritical}},
+		{"limite inferior", []string{"disk_usage<90"}, nil, statusWarning, []checkStatus{statusWarning}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newReport(snaps, reportNet{Latency: -1}, 10, rules(tt.warn...), rules(tt.crit...))
+			if r.Status != tt.want {
+				t.Errorf("Status = %v, want %v (%+v)", r.Status, tt.want, r.Checks)
+			}
+			if len(r.Checks) != len(tt.checks) {
+				t.Fatalf("Checks = %+v, want %d", r.Checks, len(tt.checks))
+			}
+			for i, check := range r.Checks {
+				if check.Status != tt.checks[i] || (check.Value == nil) != (check.Status == statusUnknown) {
+					t.Errorf("Checks[%d] = %s %v (valor %v), want %v", i, check.Rule, check.Status, check.Value, tt.checks[i])
+				}
+			}
+		})
+	}
+	if r := newReport(snaps, reportNet{Latency: -1}, 10, nil, nil); r.Metrics["cpu_usage"] != 50 || r.Peaks["cpu_usage"] != 90 {
+		t.Errorf("média %v e pico %v, want 50 e 90", r.Metrics["cpu_usage"], r.Peaks["cpu_usage"])
+	}
+}
+
+func TestReportExitCodes(t *testing.T) {
+	// Os códigos de saída são os dos plugins do Nagios.
+	for status, code := range map[checkStatus]int{statusOK: 0, statusWarning: 1, statusCritical: 2, statusUnknown: 3} {
+		if int(status) != code {
+			t.Errorf("%v sai com %d, want %d", status, int(status), code)
+		}
+	}
+
+	tests := []struct {
+		a, b, want checkStatus
+	}{
+		{statusOK, statusOK, statusOK},
+		{statusOK, statusUnknown, statusUnknown},
+		{statusUnknown, statusWarning, statusWarning},
+		{statusWarning, statusUnknown, statusWarning},
+		{statusCritical, statusWarning, statusCritical},
+		{statusUnknown, statusCritical, statusCritical},
+	}
+	for _, tt := range tests {
+		if got := worse(tt.a, tt.b); got != tt.want {
+			t.Errorf("worse(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+
+	// Opções inválidas saem com UNKNOWN antes de qualquer coleta.
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldStderr := os.Stderr
+	os.Stderr = devNull
+	t.Cleanup(func() {
+		os.Stderr = oldStderr
+		devNull.Close()
+	})
+	for _, args := range [][]string{
+		{"--samples", "0"},
+		{"--interval", "0s"},
+		{"--format", "xml"},
+		{"--warn", "cpu_usage"},
+		{"--crit", "cpu_usage>90:1m"},
+		{"extra"},
+	} {
+		if code := runReport(args); code != int(statusUnknown) {
+			t.Errorf("runReport(%v) = %d, want %d", args, code, statusUnknown)
+		}
+	}
+}
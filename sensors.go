@@ -0,0 +1,339 @@
+// /*********************************************************************************
+// * Projeto:     Batedor
+// * Componente:  SensorsBox - Temperaturas, ventoinhas e consumo de energia
+// *********************************************************************************/
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/shirou/gopsutil/v3/common"
+	"github.com/shirou/gopsutil/v3/host"
+)
+
+// Limites usados quando o sensor não informa os próprios (temp*_max/_crit).
+const (
+	defaultTempHigh     = 70.0
+	defaultTempCritical = 85.0
+)
+
+// TempSensor é a leitura de um sensor de temperatura, em °C.
+type TempSensor struct {
+	Name     string
+	Temp     float64
+	High     float64 // 0 quando o sensor não informa.
+	Critical float64 // 0 quando o sensor não informa.
+}
+
+// Thresholds devolve os limites de alerta e crítico do sensor, usando os
+// padrões quando o hardware não os informa.
+func (t TempSensor) Thresholds() (high, critical float64) {
+	high, critical = t.High, t.Critical
+	if critical <= 0 {
+		critical = defaultTempCritical
+	}
+	if high <= 0 || high > critical {
+		high = defaultTempHigh
+		if high > critical {
+			high = critical
+		}
+	}
+	return high, critical
+}
+
+// FanSensor é a rotação de uma ventoinha.
+type FanSensor struct {
+	Name string
+	RPM  float64
+}
+
+// PowerSensor é o consumo instantâneo de um componente.
+type PowerSensor struct {
+	Name   string
+	Watts  float64
+	Source string // "hwmon" ou "rapl".
+}
+
+// SensorInfo agrupa todas as leituras de sensores de um ciclo.
+type SensorInfo struct {
+	Temps []TempSensor
+	Fans  []FanSensor
+	Power []PowerSensor
+}
+
+// MaxTemp devolve a maior temperatura lida (0 se não houver sensores).
+func (s SensorInfo) MaxTemp() float64 {
+	var max float64
+	for _, t := range s.Temps {
+		if t.Temp > max {
+			max = t.Temp
+		}
+	}
+	return max
+}
+
+// sensorMetricName normaliza o nome de um sensor para uso como série.
+func sensorMetricName(prefix, name string) string {
+	var sb strings.Builder
+	sb.WriteString(prefix)
+	lastUnderscore := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			sb.WriteRune(r)
+			lastUnderscore = false
+		} else if !lastUnderscore {
+			sb.WriteRune('_')
+			lastUnderscore = true
+		}
+	}
+	return strings.TrimRight(sb.String(), "_")
+}
+
+// sensorMetrics acrescenta as séries dos sensores (temp_*, fan_*, power_*).
+func (s SensorInfo) sensorMetrics(m map[string]float64) {
+	for _, t := range s.Temps {
+		m[sensorMetricName("temp_", t.Name)] = t.Temp
+	}
+	if len(s.Temps) > 0 {
+		m["temp_max"] = s.MaxTemp()
+	}
+	for _, f := range s.Fans {
+		m[sensorMetricName("fan_", f.Name)] = f.RPM
+	}
+	for _, p := range s.Power {
+		m[sensorMetricName("power_", p.Source+"_"+p.Name)] = p.Watts
+	}
+}
+
+// hwmonLabel devolve o rótulo de um canal hwmon (ex.: fan1), ou o nome do
+// chip seguido do canal quando não há *_label.
+func hwmonLabel(dir, channel string) string {
+	chip := "hwmon"
+	if data, err := os.ReadFile(filepath.Join(dir, "name")); err == nil {
+		chip = strings.TrimSpace(string(data))
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, channel+"_label")); err == nil {
+		return chip + " " + strings.TrimSpace(string(data))
+	}
+	return chip + " " + channel
+}
+
+// readHwmon lê ventoinhas (fan*_input, em RPM) e consumo (power*_input ou
+// power*_average, em µW) de todos os chips em /sys/class/hwmon.
+func readHwmon() ([]FanSensor, []PowerSensor) {
+	var fans []FanSensor
+	var power []PowerSensor
+
+	dirs, _ := filepath.Glob(sysPath("class", "hwmon", "hwmon*"))
+	for _, dir := range dirs {
+		inputs, _ := filepath.Glob(filepath.Join(dir, "fan*_input"))
+		for _, input := range inputs {
+			rpm, err := readUintFile(input)
+			if err != nil {
+				continue
+			}
+			channel := strings.TrimSuffix(filepath.Base(input), "_input")
+			fans = append(fans, FanSensor{Name: hwmonLabel(dir, channel), RPM: float64(rpm)})
+		}
+
+		channels := make(map[string]string)
+		for _, suffix := range []string{"_average", "_input"} {
+			files, _ := filepath.Glob(filepath.Join(dir, "power*"+suffix))
+			for _, f := range files {
+				channels[strings.TrimSuffix(filepath.Base(f), suffix)] = f
+			}
+		}
+		for channel, file := range channels {
+			uw, err := readUintFile(file)
+			if err != nil {
+				continue
+			}
+			power = append(power, PowerSensor{Name: hwmonLabel(dir, channel), Watts: float64(uw) / 1e6, Source: "hwmon"})
+		}
+	}
+
+	sort.Slice(fans, func(i, j int) bool { return fans[i].Name < fans[j].Name })
+	sort.Slice(power, func(i, j int) bool { return power[i].Name < power[j].Name })
+	return fans, power
+}
+
+// readTemperatures usa o gopsutil, apontado para sysRoot, para ler os sensores de temperatura.
+func readTemperatures() []TempSensor {
+	ctx := context.WithValue(context.Background(), common.EnvKey, common.EnvMap{common.HostSysEnvKey: sysRoot})
+	stats, _ := host.SensorsTemperaturesWithContext(ctx)
+
+	temps := make([]TempSensor, 0, len(stats))
+	for _, st := range stats {
+		if st.Temperature <= 0 {
+			continue
+		}
+		temps = append(temps, TempSensor{Name: st.SensorKey, Temp: st.Temperature, High: st.High, Critical: st.Critical})
+	}
+	sort.Slice(temps, func(i, j int) bool { return temps[i].Name < temps[j].Name })
+	return temps
+}
+
+// sensorSampler lê os sensores e guarda os contadores de energia do RAPL
+// (µJ acumulados) para convertê-los em potência média entre duas leituras.
+type sensorSampler struct {
+	lastEnergy map[string]uint64
+	lastCheck  time.Time
+}
+
+// sample lê todos os sensores do sistema.
+func (r *sensorSampler) sample(now time.Time) SensorInfo {
+	fans, power := readHwmon()
+	return SensorInfo{
+		Temps: readTemperatures(),
+		Fans:  fans,
+		Power: append(power, r.sampleRAPL(now)...),
+	}
+}
+
+func (r *sensorSampler) sampleRAPL(now time.Time) []PowerSensor {
+	zones, _ := filepath.Glob(sysPath("class", "powercap", "intel-rapl:*"))
+	current := make(map[string]uint64)
+	var power []PowerSensor
+
+	elapsed := now.Sub(r.lastCheck).Seconds()
+	for _, zone := range zones {
+		energy, err := readUintFile(filepath.Join(zone, "energy_uj"))
+		if err != nil {
+			continue
+		}
+		name := filepath.Base(zone)
+		if data, err := os.ReadFile(filepath.Join(zone, "name")); err == nil {
+			name = strings.TrimSpace(string(data)) + " (" + strings.TrimPrefix(filepath.Base(zone), "intel-rapl:") + ")"
+		}
+		current[zone] = energy
+
+		prev, ok := r.lastEnergy[zone]
+		if !ok || r.lastCheck.IsZero() || elapsed <= 0 {
+			continue
+		}
+		var delta uint64
+		if energy >= prev {
+			delta = energy - prev
+		} else {
+			// O contador deu a volta; o limite vem de max_energy_range_uj.
+			maxRange, err := readUintFile(filepath.Join(zone, "max_energy_range_uj"))
+			if err != nil {
+				continue
+			}
+			delta = maxRange - prev + energy
+		}
+		power = append(power, PowerSensor{Name: name, Watts: float64(delta) / 1e6 / elapsed, Source: "rapl"})
+	}
+
+	r.lastEnergy = current
+	r.lastCheck = now
+	sort.Slice(power, func(i, j int) bool { return power[i].Name < power[j].Name })
+	return power
+}
+
+// tempColor escolhe a cor da temperatura conforme os limites do sensor.
+func tempColor(t TempSensor) string {
+	high, critical := t.Thresholds()
+	if t.Temp >= critical {
+		return "red"
+	} else if t.Temp >= high {
+		return "yellow"
+	}
+	return "green"
+}
+
+// SensorsBox é o widget da tela de sensores.
+type SensorsBox struct {
+	*tview.Box
+	mu      sync.RWMutex
+	sensors SensorInfo
+	offset  int
+}
+
+// NewSensorsBox cria um novo widget SensorsBox.
+func NewSensorsBox() *SensorsBox {
+	return &SensorsBox{
+		Box: tview.NewBox().SetBorder(true).SetTitle(tview.Escape(" Sensores | [↑]/[↓] Rolar | [Q] Voltar ")),
+	}
+}
+
+// Update atualiza as leituras exibidas.
+func (s *SensorsBox) Update(sensors SensorInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sensors = sensors
+}
+
+// Scroll rola a lista de sensores.
+func (s *SensorsBox) Scroll(delta int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.offset += delta
+	if s.offset < 0 {
+		s.offset = 0
+	}
+}
+
+// Draw desenha o widget na tela.
+func (s *SensorsBox) Draw(screen tcell.Screen) {
+	s.Box.Draw(screen)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	x, y, width, height := s.GetInnerRect()
+	if width <= 0 || height <= 0 {
+		return
+	}
+
+	var lines []string
+	lines = append(lines, "[green]Temperaturas:")
+	if len(s.sensors.Temps) == 0 {
+		lines = append(lines, "[white]  Nenhum sensor de temperatura encontrado.")
+	}
+	barWidth := width - 60
+	for _, t := range s.sensors.Temps {
+		high, critical := t.Thresholds()
+		color := tempColor(t)
+		lines = append(lines, fmt.Sprintf("[yellow]  %-28.28s [%s]%6.1f °C[white]  (alerta %.0f, crítico %.0f) [%s]%s",
+			tview.Escape(t.Name), color, t.Temp, high, critical, color, usageBar(t.Temp/critical*100, barWidth)))
+	}
+
+	lines = append(lines, "", "[green]Ventoinhas:")
+	if len(s.sensors.Fans) == 0 {
+		lines = append(lines, "[white]  Nenhuma ventoinha encontrada.")
+	}
+	for _, f := range s.sensors.Fans {
+		color := "white"
+		if f.RPM == 0 {
+			color = "red" // Ventoinha parada.
+		}
+		lines = append(lines, fmt.Sprintf("[yellow]  %-28.28s [%s]%6.0f RPM", tview.Escape(f.Name), color, f.RPM))
+	}
+
+	lines = append(lines, "", "[green]Consumo de energia:")
+	if len(s.sensors.Power) == 0 {
+		lines = append(lines, "[white]  Nenhum medidor de energia (hwmon/RAPL) encontrado.")
+	}
+	for _, p := range s.sensors.Power {
+		lines = append(lines, fmt.Sprintf("[yellow]  %-28.28s [white]%7.2f W  [blue](%s)", tview.Escape(p.Name), p.Watts, p.Source))
+	}
+
+	if s.offset > len(lines)-1 {
+		s.offset = len(lines) - 1
+	}
+	for i, line := range lines[s.offset:] {
+		if i >= height {
+			break
+		}
+		tview.Print(screen, line, x+1, y+i, width-2, tview.AlignLeft, tcell.ColorWhite)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeSys monta uma árvore do sysfs em um diretório temporário, aponta
+// sysRoot para ela e devolve a raiz. Os caminhos de files são relativos à
+// raiz.
+func fakeSys(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for path, content := range files {
+		writeSysFile(t, root, path, content)
+	}
+	old := sysRoot
+	sysRoot = root
+	t.Cleanup(func() { sysRoot = old })
+	return root
+}
+
+func TestReadHwmon(t *testing.T) {
+	fakeSys(t, map[string]string{
+		"class/hwmon/hwmon0/name":           "thinkpad",
+		"class/hwmon/hwmon0/fan1_input":     "2400",
+		"class/hwmon/hwmon0/fan1_label":     "CPU",
+		"class/hwmon/hwmon0/fan2_input":     "0",
+		"class/hwmon/hwmon1/name":           "amdgpu",
+		"class/hwmon/hwmon1/power1_average": "35500000",
+		"class/hwmon/hwmon2/fan1_input":     "invalid",
+		"class/hwmon/hwmon2/power1_input":   "1000000",
+	})
+
+	fans, power := readHwmon()
+	wantFans := []FanSensor{{Name: "thinkpad CPU", RPM: 2400}, {Name: "thinkpad fan2", RPM: 0}}
+	if !reflect.DeepEqual(fans, wantFans) {
+		t.Errorf("fans = %+v, want %+v", fans, wantFans)
+	}
+	wantPower := []PowerSensor{{Name: "amdgpu power1", Watts: 35.5, Source: "hwmon"}, {Name: "hwmon power1", Watts: 1, Source: "hwmon"}}
+	if !reflect.DeepEqual(power, wantPower) {
+		t.Errorf("power = %+v, want %+v", power, wantPower)
+	}
+}
+
+func TestReadHwmonWithoutSensors(t *testing.T) {
+	fakeSys(t, nil)
+	fans, power := readHwmon()
+	if len(fans) != 0 || len(power) != 0 {
+		t.Fatalf("readHwmon() em árvore vazia = %v, %v", fans, power)
+	}
+}
+
+func TestSampleRAPL(t *testing.T) {
+	const pkg = "class/powercap/intel-rapl:0"
+	const dram = "class/powercap/intel-rapl:0:0"
+	root := fakeSys(t, map[string]string{
+		pkg + "/name":                 "package-0",
+		pkg + "/energy_uj":            "1000000",
+		pkg + "/max_energy_range_uj":  "262143328850",
+		dram + "/name":                "dram",
+		dram + "/energy_uj":           "500000",
+		"class/powercap/intel-rapl:1": "", // Zona sem energy_uj (arquivo no lugar do diretório).
+	})
+
+	var s sensorSampler
+	start := time.Unix(1000, 0)
+	if got := s.sampleRAPL(start); len(got) != 0 {
+		t.Fatalf("primeira leitura não deve ter potência: %+v", got)
+	}
+
+	tests := []struct {
+		name       string
+		pkgEnergy  string
+		dramEnergy string
+		want       []PowerSensor
+	}{
+		{
+			name:       "contadores crescendo",
+			pkgEnergy:  "21000000", // 20 J em 2 s
+			dramEnergy: "2500000",  // 2 J em 2 s
+			want: []PowerSensor{
+				{Name: "dram (0:0)", Watts: 1, Source: "rapl"},
+				{Name: "package-0 (0)", Watts: 10, Source: "rapl"},
+			},
+		},
+		{
+			// package-0 volta pelo max_energy_range_uj; a dram não tem o
+			// arquivo e a leitura é descartada.
+			name:       "contador deu a volta",
+			pkgEnergy:  "3000000",
+			dramEnergy: "100",
+			want: []PowerSensor{
+				{Name: "package-0 (0)", Watts: float64(262143328850-21000000+3000000) / 1e6 / 2, Source: "rapl"},
+			},
+		},
+	}
+	now := start
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeSysFile(t, root, pkg+"/energy_uj", tt.pkgEnergy)
+			writeSysFile(t, root, dram+"/energy_uj", tt.dramEnergy)
+			now = now.Add(2 * time.Second)
+			got := s.sampleRAPL(now)
+			if len(got) != len(tt.want) {
+				t.Fatalf("sampleRAPL() = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i].Name != tt.want[i].Name || got[i].Source != "rapl" || math.Abs(got[i].Watts-tt.want[i].Watts) > 1e-9 {
+					t.Errorf("sampleRAPL()[%d] = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSampleRAPLSameInstant(t *testing.T) {
+	fakeSys(t, map[string]string{"class/powercap/intel-rapl:0/energy_uj": "1000"})
+	var s sensorSampler
+	now := time.Unix(1000, 0)
+	s.sampleRAPL(now)
+	if got := s.sampleRAPL(now); len(got) != 0 {
+		t.Fatalf("leituras no mesmo instante não devem gerar potência: %+v", got)
+	}
+}
@@ -49,6 +49,13 @@ func (s *Sparkline) AddData(value float64) {
 	s.SetTitle(fmt.Sprintf(" %s: %.2f%% ", s.label, value))
 }
 
+// Clear apaga o histórico do gráfico (usado ao saltar na reprodução).
+func (s *Sparkline) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data = s.data[:0]
+}
+
 // SetLabelColor define a cor do texto do valor percentual.
 func (s *Sparkline) SetLabelColor(color tcell.Color) *Sparkline {
 	s.labelColor = color
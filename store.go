@@ -0,0 +1,249 @@
+// /*********************************************************************************
+// * Projeto:     Batedor
+// * Componente:  Store - Interface dos armazenamentos de histórico
+// *********************************************************************************/
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Store é onde o histórico é guardado. O SQLite local é o padrão; outros
+// armazenamentos podem ser usados no lugar dele ou junto com ele (--store).
+type Store interface {
+	// Write grava os lotes de uma vez (é chamado pela fila de gravação).
+	Write(batches []HistoryBatch) error
+	// Query devolve os pontos de uma série no intervalo, agregados por Step.
+	Query(q RangeQuery) ([]MetricRecord, error)
+	// Series lista as séries gravadas.
+	Series() ([]Series, error)
+	// Retain apaga os registros anteriores a before.
+	Retain(before time.Time) error
+	Close() error
+	// String identifica o armazenamento no log e em /api/db.
+	String() string
+}
+
+// processStore é um Store que também guarda as amostras de processos.
+type processStore interface {
+	TopProcessesAt(host string, ts time.Time, window time.Duration) ([]ProcessRecord, error)
+}
+
+// Series identifica uma série: uma métrica de um host.
+type Series struct {
+	Host   string
+	Metric string
+}
+
+// RangeQuery é uma consulta a uma série. Host igual a fleetHostKey junta
+// todos os hosts. Com Step, os pontos de cada intervalo são agregados com Agg.
+type RangeQuery struct {
+	Host   string
+	Metric string
+	From   time.Time
+	To     time.Time
+	Step   time.Duration
+	Agg    string // avg (padrão), min, max, sum ou last.
+}
+
+// errStoreUnsupported é devolvido pelos armazenamentos que só recebem dados.
+type errStoreUnsupported struct{ store fmt.Stringer }
+
+func (e errStoreUnsupported) Error() string {
+	return fmt.Sprintf("%s não permite consultas", e.store)
+}
+
+// validAggregation confere o nome da agregação.
+func validAggregation(agg string) error {
+	switch agg {
+	case "", "avg", "min", "max", "sum", "last":
+		return nil
+	}
+	return fmt.Errorf("agregação desconhecida: %q (use avg, min, max, sum ou last)", agg)
+}
+
+// aggregate agrupa registros já ordenados em intervalos de step e reduz cada
+// grupo com agg. Com step zero, os registros são devolvidos como estão.
+func aggregate(records []MetricRecord, step time.Duration, agg string) []MetricRecord {
+	if step <= 0 || len(records) == 0 {
+		return records
+	}
+	var out []MetricRecord
+	var group []float64
+	for i, rec := range records {
+		bucket := rec.Timestamp.Truncate(step)
+		group = append(group, rec.Value)
+		if i < len(records)-1 && records[i+1].Timestamp.Truncate(step).Equal(bucket) {
+			continue
+		}
+		out = append(out, MetricRecord{Timestamp: bucket, Value: reduce(group, agg)})
+		group = group[:0]
+	}
+	return out
+}
+
+func reduce(values []float64, agg string) float64 {
+	result := values[0]
+	switch agg {
+	case "min":
+		for _, v := range values {
+			if v < result {
+				result = v
+			}
+		}
+	case "max":
+		for _, v := range values {
+			if v > result {
+				result = v
+			}
+		}
+	case "last":
+		result = values[len(values)-1]
+	default: // avg e sum
+		result = 0
+		for _, v := range values {
+			result += v
+		}
+		if agg != "sum" {
+			result /= float64(len(values))
+		}
+	}
+	return result
+}
+
+// storesFlag permite repetir --store na linha de comando.
+type storesFlag []string
+
+func (f *storesFlag) String() string { return strings.Join(*f, ", ") }
+
+func (f *storesFlag) Set(value string) error {
+	if _, _, err := parseStoreSpec(value); err != nil {
+		return err
+	}
+	*f = append(*f, value)
+	return nil
+}
+
+// Opções dos armazenamentos (--store, --store-token, --retention).
+var (
+	storeSpecs     storesFlag
+	storeToken     string
+	storeRetention time.Duration
+)
+
+// parseStoreSpec separa o tipo e o argumento de um --store:
+//
+//	sqlite                   banco local (veja --db)
+//	memory[:pontos]          memória, com um anel de pontos por série
+//	influx:URL               protocolo de linha do InfluxDB (/write ou /api/v2/write)
+//	prometheus:URL           remote write do Prometheus
+func parseStoreSpec(spec string) (kind, arg string, err error) {
+	kind, arg, _ = strings.Cut(spec, ":")
+	switch kind {
+	case "sqlite":
+		if arg != "" {
+			return "", "", fmt.Errorf("--store sqlite não recebe argumento (use --db)")
+		}
+	case "memory":
+		if arg != "" {
+			if n, err := strconv.Atoi(arg); err != nil || n <= 0 {
+				return "", "", fmt.Errorf("--store memory:%s: número de pontos inválido", arg)
+			}
+		}
+	case "influx", "prometheus":
+		if !strings.HasPrefix(arg, "http://") && !strings.HasPrefix(arg, "https://") {
+			return "", "", fmt.Errorf("--store %s exige uma URL http(s)", kind)
+		}
+	default:
+		return "", "", fmt.Errorf("armazenamento desconhecido: %q (use sqlite, memory, influx ou prometheus)", kind)
+	}
+	return kind, arg, nil
+}
+
+// openStore abre o armazenamento descrito por spec.
+func openStore(spec string) (Store, error) {
+	kind, arg, err := parseStoreSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case "memory":
+		capacity := memoryStoreDefaultPoints
+		if arg != "" {
+			capacity, _ = strconv.Atoi(arg)
+		}
+		return newMemoryStore(capacity), nil
+	case "influx":
+		return newInfluxStore(arg, storeToken), nil
+	case "prometheus":
+		return newPromStore(arg, storeToken), nil
+	}
+	return openSQLiteStore()
+}
+
+// store é o armazenamento consultado pela TUI e pela API: o primeiro de
+// --store que permite consultas. nil quando o histórico está desativado.
+var store Store
+
+// stores são todos os armazenamentos abertos; cada um tem sua fila de gravação.
+var stores []Store
+
+// localHostname substitui o host local ("") nos armazenamentos remotos, que
+// juntam dados de várias máquinas.
+func localHostname(host string) string {
+	if host != "" {
+		return host
+	}
+	if name, err := os.Hostname(); err == nil {
+		return name
+	}
+	return "localhost"
+}
+
+// runRetention apaga periodicamente o histórico mais antigo que
+// storeRetention em todos os armazenamentos.
+func runRetention() {
+	for {
+		before := time.Now().Add(-storeRetention)
+		for _, s := range stores {
+			if err := s.Retain(before); err != nil {
+				log.Printf("Histórico: falha ao apagar registros antigos de %s: %v", s, err)
+			}
+		}
+		time.Sleep(time.Hour)
+	}
+}
+
+// seriesHosts e seriesMetrics extraem, ordenados e sem repetição, os hosts e
+// as métricas de uma lista de séries.
+func seriesHosts(series []Series) []string {
+	seen := make(map[string]bool)
+	var hosts []string
+	for _, s := range series {
+		if !seen[s.Host] {
+			seen[s.Host] = true
+			hosts = append(hosts, s.Host)
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+func seriesMetrics(series []Series) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, s := range series {
+		if !seen[s.Metric] {
+			seen[s.Metric] = true
+			names = append(names, s.Metric)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,202 @@
+// /*********************************************************************************
+// * Projeto:     Batedor
+// * Componente:  Store em memória - Histórico efêmero em anéis de tamanho fixo
+// *********************************************************************************/
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryStoreDefaultPoints são 24 horas de pontos gravados a cada minuto.
+const memoryStoreDefaultPoints = 1440
+
+// memoryStore guarda o histórico só na memória, para uso efêmero (contêineres,
+// máquinas sem disco gravável): cada série e os processos de cada host ficam
+// em um anel com os últimos capacity registros, e nada sobrevive ao processo.
+type memoryStore struct {
+	mu       sync.RWMutex
+	capacity int
+	series   map[Series]*metricRing
+	procs    map[string]*procRing
+}
+
+// metricRing é um buffer circular de pontos em ordem de gravação.
+type metricRing struct {
+	points []MetricRecord
+	next   int // Próxima posição a sobrescrever quando cheio.
+}
+
+func (r *metricRing) add(rec MetricRecord, capacity int) {
+	if len(r.points) < capacity {
+		r.points = append(r.points, rec)
+		return
+	}
+	r.points[r.next] = rec
+	r.next = (r.next + 1) % capacity
+}
+
+// ordered devolve os pontos do mais antigo ao mais novo.
+func (r *metricRing) ordered() []MetricRecord {
+	out := make([]MetricRecord, 0, len(r.points))
+	out = append(out, r.points[r.next:]...)
+	return append(out, r.points[:r.next]...)
+}
+
+// procRing guarda as últimas amostras de processos de um host.
+type procRing struct {
+	samples []HistoryBatch
+	next    int
+}
+
+func (r *procRing) add(b HistoryBatch, capacity int) {
+	if len(r.samples) < capacity {
+		r.samples = append(r.samples, b)
+		return
+	}
+	r.samples[r.next] = b
+	r.next = (r.next + 1) % capacity
+}
+
+func (r *procRing) ordered() []HistoryBatch {
+	out := make([]HistoryBatch, 0, len(r.samples))
+	out = append(out, r.samples[r.next:]...)
+	return append(out, r.samples[:r.next]...)
+}
+
+func newMemoryStore(capacity int) *memoryStore {
+	return &memoryStore{
+		capacity: capacity,
+		series:   make(map[Series]*metricRing),
+		procs:    make(map[string]*procRing),
+	}
+}
+
+func (m *memoryStore) String() string {
+	return fmt.Sprintf("memória (%d pontos por série)", m.capacity)
+}
+
+func (m *memoryStore) Close() error { return nil }
+
+func (m *memoryStore) Write(batches []HistoryBatch) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, b := range batches {
+		for name, value := range b.Metrics {
+			key := Series{Host: b.Host, Metric: name}
+			ring := m.series[key]
+			if ring == nil {
+				ring = &metricRing{}
+				m.series[key] = ring
+			}
+			ring.add(MetricRecord{Timestamp: b.Timestamp, Value: value}, m.capacity)
+		}
+		if len(b.Procs) > 0 {
+			ring := m.procs[b.Host]
+			if ring == nil {
+				ring = &procRing{}
+				m.procs[b.Host] = ring
+			}
+			ring.add(HistoryBatch{Host: b.Host, Timestamp: b.Timestamp, Procs: b.Procs}, m.capacity)
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) Query(q RangeQuery) ([]MetricRecord, error) {
+	m.mu.RLock()
+	var records []MetricRecord
+	for key, ring := range m.series {
+		if key.Metric != q.Metric || (q.Host != fleetHostKey && key.Host != q.Host) {
+			continue
+		}
+		for _, rec := range ring.ordered() {
+			if !rec.Timestamp.Before(q.From) && !rec.Timestamp.After(q.To) {
+				records = append(records, rec)
+			}
+		}
+	}
+	m.mu.RUnlock()
+
+	// Os anéis estão em ordem de gravação; amostras atrasadas e vários hosts
+	// exigem ordenar pelo instante.
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Timestamp.Before(records[j].Timestamp) })
+	return aggregate(records, q.Step, q.Agg), nil
+}
+
+func (m *memoryStore) Series() ([]Series, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	series := make([]Series, 0, len(m.series))
+	for key := range m.series {
+		series = append(series, key)
+	}
+	sort.Slice(series, func(i, j int) bool {
+		if series[i].Host != series[j].Host {
+			return series[i].Host < series[j].Host
+		}
+		return series[i].Metric < series[j].Metric
+	})
+	return series, nil
+}
+
+// Retain descarta os registros anteriores a before; séries que ficam vazias
+// deixam de ser listadas.
+func (m *memoryStore) Retain(before time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, ring := range m.series {
+		var kept []MetricRecord
+		for _, rec := range ring.ordered() {
+			if !rec.Timestamp.Before(before) {
+				kept = append(kept, rec)
+			}
+		}
+		if len(kept) == 0 {
+			delete(m.series, key)
+			continue
+		}
+		m.series[key] = &metricRing{points: kept}
+	}
+	for host, ring := range m.procs {
+		var kept []HistoryBatch
+		for _, b := range ring.ordered() {
+			if !b.Timestamp.Before(before) {
+				kept = append(kept, b)
+			}
+		}
+		if len(kept) == 0 {
+			delete(m.procs, host)
+			continue
+		}
+		m.procs[host] = &procRing{samples: kept}
+	}
+	return nil
+}
+
+func (m *memoryStore) TopProcessesAt(host string, ts time.Time, window time.Duration) ([]ProcessRecord, error) {
+	m.mu.RLock()
+	var all []ProcessRecord
+	if ring := m.procs[host]; ring != nil {
+		for _, b := range ring.samples {
+			if absDuration(b.Timestamp.Sub(ts)) > window {
+				continue
+			}
+			for _, p := range b.Procs {
+				all = append(all, ProcessRecord{Timestamp: b.Timestamp, PID: p.PID, User: p.User, Command: p.Command, CPU: p.CPU, Mem: float64(p.Mem)})
+			}
+		}
+	}
+	m.mu.RUnlock()
+
+	sort.SliceStable(all, func(i, j int) bool {
+		if !all[i].Timestamp.Equal(all[j].Timestamp) {
+			return all[i].Timestamp.Before(all[j].Timestamp)
+		}
+		return all[i].CPU > all[j].CPU
+	})
+	return nearestSample(all, ts), nil
+}
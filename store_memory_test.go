@@ -0,0 +1,122 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// memoryValues devolve os valores de uma consulta sem agregação.
+func memoryValues(t *testing.T, m *memoryStore, host string, from, to time.Time) []float64 {
+	t.Helper()
+	records, err := m.Query(RangeQuery{Host: host, Metric: "cpu_usage", From: from, To: to})
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make([]float64, len(records))
+	for i, rec := range records {
+		values[i] = rec.Value
+	}
+	return values
+}
+
+func equalValues(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMemoryStoreRing(t *testing.T) {
+	m := newMemoryStore(3)
+	base := time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		b := HistoryBatch{Timestamp: base.Add(time.Duration(i) * time.Minute), Metrics: map[string]float64{"cpu_usage": float64(i)}}
+		if err := m.Write([]HistoryBatch{b}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	all := base.Add(time.Hour)
+	if got := memoryValues(t, m, "", base, all); !equalValues(got, []float64{2, 3, 4}) {
+		t.Errorf("depois de dar a volta no anel = %v, want [2 3 4]", got)
+	}
+
+	// Uma amostra atrasada sobrescreve a mais antiga e a consulta reordena.
+	m.Write([]HistoryBatch{{Timestamp: base.Add(90 * time.Second), Metrics: map[string]float64{"cpu_usage": 1.5}}})
+	if got := memoryValues(t, m, "", base, all); !equalValues(got, []float64{1.5, 3, 4}) {
+		t.Errorf("com amostra atrasada = %v, want [1.5 3 4]", got)
+	}
+
+	// Cada série tem seu anel; a frota junta os hosts em ordem cronológica.
+	m.Write([]HistoryBatch{
+		{Host: "srv1", Timestamp: base.Add(150 * time.Second), Metrics: map[string]float64{"cpu_usage": 10}},
+		{Host: "srv1", Timestamp: base.Add(5 * time.Minute), Metrics: map[string]float64{"mem_usage": 50}},
+	})
+	if got := memoryValues(t, m, fleetHostKey, base, all); !equalValues(got, []float64{1.5, 10, 3, 4}) {
+		t.Errorf("frota = %v, want [1.5 10 3 4]", got)
+	}
+	series, _ := m.Series()
+	want := []Series{{Host: "", Metric: "cpu_usage"}, {Host: "srv1", Metric: "cpu_usage"}, {Host: "srv1", Metric: "mem_usage"}}
+	if len(series) != len(want) {
+		t.Fatalf("Series() = %v, want %v", series, want)
+	}
+	for i := range want {
+		if series[i] != want[i] {
+			t.Errorf("Series()[%d] = %v, want %v", i, series[i], want[i])
+		}
+	}
+
+	// Os processos também ficam em um anel por host.
+	for i := 0; i < 4; i++ {
+		m.Write([]HistoryBatch{{Timestamp: base.Add(time.Duration(i) * time.Minute), Procs: []ProcData{{PID: int32(100 + i), Command: "job", CPU: 1}}}})
+	}
+	if procs, _ := m.TopProcessesAt("", base, 30*time.Second); len(procs) != 0 {
+		t.Errorf("amostra sobrescrita ainda aparece: %+v", procs)
+	}
+	if procs, _ := m.TopProcessesAt("", base.Add(3*time.Minute), 30*time.Second); len(procs) != 1 || procs[0].PID != 103 {
+		t.Errorf("TopProcessesAt() = %+v, want o PID 103", procs)
+	}
+}
+
+func TestMemoryStoreRetain(t *testing.T) {
+	m := newMemoryStore(4)
+	base := time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC)
+	// Seis pontos em um anel de quatro: o anel já deu a volta antes do Retain.
+	for i := 0; i < 6; i++ {
+		ts := base.Add(time.Duration(i) * time.Minute)
+		m.Write([]HistoryBatch{{Timestamp: ts, Metrics: map[string]float64{"cpu_usage": float64(i)},
+			Procs: []ProcData{{PID: int32(i), Command: "job"}}}})
+	}
+	m.Write([]HistoryBatch{{Host: "velho", Timestamp: base, Metrics: map[string]float64{"cpu_usage": 99},
+		Procs: []ProcData{{PID: 1, Command: "init"}}}})
+
+	if err := m.Retain(base.Add(4 * time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	all := base.Add(time.Hour)
+	if got := memoryValues(t, m, "", base, all); !equalValues(got, []float64{4, 5}) {
+		t.Errorf("depois de Retain() = %v, want [4 5]", got)
+	}
+	series, _ := m.Series()
+	if len(series) != 1 || series[0].Host != "" {
+		t.Errorf("Series() = %v, want só a série local", series)
+	}
+	if _, ok := m.procs["velho"]; ok {
+		t.Error("os processos do host sem amostras recentes deveriam ser descartados")
+	}
+	if procs, _ := m.TopProcessesAt("", base.Add(3*time.Minute), 30*time.Second); len(procs) != 0 {
+		t.Errorf("processo anterior ao corte ainda aparece: %+v", procs)
+	}
+
+	// O anel refeito continua respeitando a capacidade e a ordem.
+	for i := 6; i < 10; i++ {
+		m.Write([]HistoryBatch{{Timestamp: base.Add(time.Duration(i) * time.Minute), Metrics: map[string]float64{"cpu_usage": float64(i)}}})
+	}
+	if got := memoryValues(t, m, "", base, all); !equalValues(got, []float64{6, 7, 8, 9}) {
+		t.Errorf("depois de encher de novo = %v, want [6 7 8 9]", got)
+	}
+}
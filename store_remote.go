@@ -0,0 +1,246 @@
+// /*********************************************************************************
+// * Projeto:     Batedor
+// * Componente:  Store remoto - Envio do histórico ao InfluxDB e ao Prometheus
+// *********************************************************************************/
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// writeOnlyStore marca os armazenamentos que só recebem dados: o histórico
+// continua sendo lido do SQLite ou da memória.
+type writeOnlyStore interface {
+	writeOnly()
+}
+
+// remoteStore tem o que os envios por HTTP compartilham. As amostras de
+// processos não são enviadas: PID e linha de comando como rótulos criariam
+// uma série nova a cada processo no servidor.
+type remoteStore struct {
+	kind   string
+	url    string
+	token  string
+	client *http.Client
+}
+
+func (r *remoteStore) writeOnly() {}
+
+func (r *remoteStore) String() string { return r.kind + " " + r.url }
+
+func (r *remoteStore) Close() error { return nil }
+
+func (r *remoteStore) Query(RangeQuery) ([]MetricRecord, error) { return nil, errStoreUnsupported{r} }
+
+func (r *remoteStore) Series() ([]Series, error) { return nil, errStoreUnsupported{r} }
+
+// Retain não faz nada: a retenção é configurada no próprio servidor.
+func (r *remoteStore) Retain(time.Time) error { return nil }
+
+// post envia o corpo com os cabeçalhos do protocolo.
+func (r *remoteStore) post(body []byte, headers map[string]string) error {
+	req, err := http.NewRequest(http.MethodPost, r.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s respondeu %s: %s", r.url, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// influxStore envia as métricas no protocolo de linha do InfluxDB, aceito
+// também pelo VictoriaMetrics e pelo Telegraf. A URL é a rota de escrita
+// completa, por exemplo http://influx:8086/api/v2/write?org=o&bucket=b ou
+// http://influx:8086/write?db=batedor. Cada métrica vira uma medição com a
+// tag host e o campo value:
+//
+//	cpu_usage,host=srv1 value=12.5 1760000000000000000
+type influxStore struct {
+	remoteStore
+}
+
+func newInfluxStore(url, token string) *influxStore {
+	return &influxStore{remoteStore{kind: "influx", url: url, token: token, client: &http.Client{Timeout: 10 * time.Second}}}
+}
+
+// influxEscaper escapa medições e valores de tag do protocolo de linha.
+var influxEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`)
+
+func (s *influxStore) Write(batches []HistoryBatch) error {
+	var buf bytes.Buffer
+	for _, b := range batches {
+		host := influxEscaper.Replace(localHostname(b.Host))
+		names := make([]string, 0, len(b.Metrics))
+		for name := range b.Metrics {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			value := b.Metrics[name]
+			if math.IsNaN(value) || math.IsInf(value, 0) {
+				continue // O protocolo de linha não aceita NaN nem infinito.
+			}
+			fmt.Fprintf(&buf, "%s,host=%s value=%s %d\n", influxEscaper.Replace(name), host, strconv.FormatFloat(value, 'g', -1, 64), b.Timestamp.UnixNano())
+		}
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+
+	headers := map[string]string{"Content-Type": "text/plain; charset=utf-8"}
+	if s.token != "" {
+		headers["Authorization"] = "Token " + s.token
+	}
+	return s.post(buf.Bytes(), headers)
+}
+
+// promStore envia as métricas pelo protocolo remote write do Prometheus
+// (aceito por Prometheus com --web.enable-remote-write-receiver, Mimir,
+// Thanos, VictoriaMetrics e outros). Cada métrica vira a série
+// batedor_<nome>{host="..."}.
+type promStore struct {
+	remoteStore
+}
+
+func newPromStore(url, token string) *promStore {
+	return &promStore{remoteStore{kind: "prometheus", url: url, token: token, client: &http.Client{Timeout: 10 * time.Second}}}
+}
+
+// promInvalidChars são os caracteres que não podem aparecer em nomes de
+// métricas do Prometheus.
+var promInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+
+// promMetricName converte o nome de uma série em um nome válido.
+func promMetricName(name string) string {
+	return "batedor_" + promInvalidChars.ReplaceAllString(name, "_")
+}
+
+// promSample é um ponto de uma série do remote write.
+type promSample struct {
+	value float64
+	ms    int64
+}
+
+func (s *promStore) Write(batches []HistoryBatch) error {
+	// Agrupa os pontos por série; o protocolo exige que os pontos de cada
+	// série venham em ordem cronológica.
+	series := make(map[Series][]promSample)
+	for _, b := range batches {
+		for name, value := range b.Metrics {
+			key := Series{Host: localHostname(b.Host), Metric: promMetricName(name)}
+			series[key] = append(series[key], promSample{value: value, ms: b.Timestamp.UnixMilli()})
+		}
+	}
+	if len(series) == 0 {
+		return nil
+	}
+	keys := make([]Series, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Metric != keys[j].Metric {
+			return keys[i].Metric < keys[j].Metric
+		}
+		return keys[i].Host < keys[j].Host
+	})
+
+	// WriteRequest { repeated TimeSeries timeseries = 1; }
+	// TimeSeries   { repeated Label labels = 1; repeated Sample samples = 2; }
+	// Label        { string name = 1; string value = 2; }
+	// Sample       { double value = 1; int64 timestamp = 2; }
+	var req []byte
+	for _, key := range keys {
+		samples := series[key]
+		sort.SliceStable(samples, func(i, j int) bool { return samples[i].ms < samples[j].ms })
+
+		var ts []byte
+		// Os rótulos vão em ordem alfabética: __name__ antes de host.
+		for _, label := range [][2]string{{"__name__", key.Metric}, {"host", key.Host}} {
+			var l []byte
+			l = protoString(l, 1, label[0])
+			l = protoString(l, 2, label[1])
+			ts = protoBytes(ts, 1, l)
+		}
+		for _, sample := range samples {
+			var smp []byte
+			smp = protoTag(smp, 1, 1)
+			smp = binary.LittleEndian.AppendUint64(smp, math.Float64bits(sample.value))
+			smp = protoTag(smp, 2, 0)
+			smp = binary.AppendUvarint(smp, uint64(sample.ms))
+			ts = protoBytes(ts, 2, smp)
+		}
+		req = protoBytes(req, 1, ts)
+	}
+
+	headers := map[string]string{
+		"Content-Type":                      "application/x-protobuf",
+		"Content-Encoding":                  "snappy",
+		"X-Prometheus-Remote-Write-Version": "0.1.0",
+	}
+	if s.token != "" {
+		headers["Authorization"] = "Bearer " + s.token
+	}
+	return s.post(snappyLiteral(req), headers)
+}
+
+// Codificação mínima de protobuf, suficiente para o WriteRequest.
+
+func protoTag(b []byte, field, wireType int) []byte {
+	return binary.AppendUvarint(b, uint64(field<<3|wireType))
+}
+
+func protoBytes(b []byte, field int, data []byte) []byte {
+	b = protoTag(b, field, 2)
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+func protoString(b []byte, field int, s string) []byte {
+	return protoBytes(b, field, []byte(s))
+}
+
+// snappyLiteral codifica data no formato de bloco do Snappy usando apenas
+// literais, sem compressão. O resultado é Snappy válido para qualquer
+// decodificador e evita uma dependência só para isso; o tamanho de cada
+// envio (um lote da fila) é pequeno.
+func snappyLiteral(data []byte) []byte {
+	out := binary.AppendUvarint(nil, uint64(len(data)))
+	for len(data) > 0 {
+		n := len(data)
+		if n > 65536 {
+			n = 65536
+		}
+		switch {
+		case n <= 60:
+			out = append(out, byte(n-1)<<2)
+		case n <= 256:
+			out = append(out, 60<<2, byte(n-1))
+		default:
+			out = append(out, 61<<2, byte(n-1), byte((n-1)>>8))
+		}
+		out = append(out, data[:n]...)
+		data = data[n:]
+	}
+	return out
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// remoteRequest é o que o servidor de teste recebeu.
+type remoteRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// startRemoteServer sobe um servidor que guarda as requisições e responde
+// com status.
+func startRemoteServer(t *testing.T, status int) (*httptest.Server, chan remoteRequest) {
+	t.Helper()
+	reqs := make(chan remoteRequest, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		reqs <- remoteRequest{header: r.Header.Clone(), body: body}
+		if status >= 300 {
+			http.Error(w, "bucket inexistente", status)
+			return
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, reqs
+}
+
+// snappyDecode decodifica um bloco Snappy que só tem literais, como os
+// produzidos por snappyLiteral.
+func snappyDecode(data []byte) ([]byte, error) {
+	size, n := binary.Uvarint(data)
+	if n <= 0 {
+		return nil, fmt.Errorf("tamanho inválido")
+	}
+	data = data[n:]
+	var out []byte
+	for len(data) > 0 {
+		tag := data[0]
+		if tag&3 != 0 {
+			return nil, fmt.Errorf("elemento %d não é literal", tag&3)
+		}
+		length := int(tag>>2) + 1
+		data = data[1:]
+		if extra := int(tag>>2) - 59; extra > 0 {
+			if len(data) < extra {
+				return nil, fmt.Errorf("literal truncado")
+			}
+			length = 1
+			for i := 0; i < extra; i++ {
+				length += int(data[i]) << (8 * i)
+			}
+			data = data[extra:]
+		}
+		if len(data) < length {
+			return nil, fmt.Errorf("literal de %d bytes com %d restantes", length, len(data))
+		}
+		out = append(out, data[:length]...)
+		data = data[length:]
+	}
+	if uint64(len(out)) != size {
+		return nil, fmt.Errorf("%d bytes decodificados, cabeçalho diz %d", len(out), size)
+	}
+	return out, nil
+}
+
+// protoField é um campo de uma mensagem protobuf.
+type protoField struct {
+	num    int
+	varint uint64
+	fixed  uint64
+	data   []byte
+}
+
+// decodeProto separa os campos de uma mensagem, aceitando apenas os tipos
+// usados no WriteRequest.
+func decodeProto(b []byte) ([]protoField, error) {
+	var fields []protoField
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, fmt.Errorf("chave inválida")
+		}
+		b = b[n:]
+		f := protoField{num: int(key >> 3)}
+		switch key & 7 {
+		case 0:
+			f.varint, n = binary.Uvarint(b)
+			if n <= 0 {
+				return nil, fmt.Errorf("varint inválido")
+			}
+			b = b[n:]
+		case 1:
+			if len(b) < 8 {
+				return nil, fmt.Errorf("fixed64 truncado")
+			}
+			f.fixed = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		case 2:
+			size, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < size {
+				return nil, fmt.Errorf("campo %d truncado", f.num)
+			}
+			f.data = b[n : n+int(size)]
+			b = b[n+int(size):]
+		default:
+			return nil, fmt.Errorf("tipo %d inesperado", key&7)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// promSeries é uma TimeSeries decodificada.
+type promSeries struct {
+	labels  [][2]string
+	samples []promSample
+}
+
+// decodeWriteRequest lê o corpo de um remote write.
+func decodeWriteRequest(body []byte) ([]promSeries, error) {
+	raw, err := snappyDecode(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := decodeProto(raw)
+	if err != nil {
+		return nil, err
+	}
+	var out []promSeries
+	for _, f := range req {
+		if f.num != 1 {
+			return nil, fmt.Errorf("campo %d no WriteRequest", f.num)
+		}
+		fields, err := decodeProto(f.data)
+		if err != nil {
+			return nil, err
+		}
+		var ts promSeries
+		for _, tf := range fields {
+			sub, err := decodeProto(tf.data)
+			if err != nil {
+				return nil, err
+			}
+			switch tf.num {
+			case 1:
+				var label [2]string
+				for _, lf := range sub {
+					label[lf.num-1] = string(lf.data)
+				}
+				ts.labels = append(ts.labels, label)
+			case 2:
+				var s promSample
+				for _, sf := range sub {
+					if sf.num == 1 {
+						s.value = math.Float64frombits(sf.fixed)
+					} else {
+						s.ms = int64(sf.varint)
+					}
+				}
+				ts.samples = append(ts.samples, s)
+			}
+		}
+		out = append(out, ts)
+	}
+	return out, nil
+}
+
+func TestSnappyLiteral(t *testing.T) {
+	for _, size := range []int{0, 1, 60, 61, 256, 257, 65536, 65537, 200000} {
+		t.Run(fmt.Sprint(size), func(t *testing.T) {
+			data := make([]byte, size)
+			for i := range data {
+				data[i] = byte(i * 7)
+			}
+			got, err := snappyDecode(snappyLiteral(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(data) {
+				t.Errorf("conteúdo decodificado difere do original")
+			}
+		})
+	}
+}
+
+func TestInfluxStoreWrite(t *testing.T) {
+	srv, reqs := startRemoteServer(t, http.StatusNoContent)
+	s := newInfluxStore(srv.URL+"/api/v2/write?org=o&bucket=b", "segredo")
+
+	ts := time.Unix(1760000000, 5)
+	err := s.Write([]HistoryBatch{
+		{Host: "srv 1,dc=sp", Timestamp: ts, Metrics: map[string]float64{
+			"cpu_usage":       12.5,
+			"disk used,/home": 80,
+			"temp=core":       math.NaN(),
+			"load":            math.Inf(1),
+		}},
+		{Host: "srv2", Timestamp: ts.Add(time.Second), Metrics: map[string]float64{"mem": 1e-3}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := <-reqs
+	want := "cpu_usage,host=srv\\ 1\\,dc\\=sp value=12.5 1760000000000000005\n" +
+		"disk\\ used\\,/home,host=srv\\ 1\\,dc\\=sp value=80 1760000000000000005\n" +
+		"mem,host=srv2 value=0.001 1760000001000000005\n"
+	if string(req.body) != want {
+		t.Errorf("corpo =\n%s\nwant\n%s", req.body, want)
+	}
+	if got := req.header.Get("Authorization"); got != "Token segredo" {
+		t.Errorf("Authorization = %q", got)
+	}
+	if got := req.header.Get("Content-Type"); !strings.HasPrefix(got, "text/plain") {
+		t.Errorf("Content-Type = %q", got)
+	}
+
+	// Só NaN e infinito: nada a enviar.
+	if err := s.Write([]HistoryBatch{{Timestamp: ts, Metrics: map[string]float64{"x": math.NaN(), "y": math.Inf(-1)}}}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case req := <-reqs:
+		t.Errorf("lote sem valores válidos foi enviado: %q", req.body)
+	default:
+	}
+}
+
+func TestRemoteStoreErrorStatus(t *testing.T) {
+	srv, _ := startRemoteServer(t, http.StatusNotFound)
+	err := newInfluxStore(srv.URL, "").Write([]HistoryBatch{{Host: "a", Timestamp: time.Unix(1, 0), Metrics: map[string]float64{"cpu_usage": 1}}})
+	if err == nil || !strings.Contains(err.Error(), "404") || !strings.Contains(err.Error(), "bucket inexistente") {
+		t.Errorf("Write() = %v, want o status e a mensagem do servidor", err)
+	}
+}
+
+func TestPromStoreWrite(t *testing.T) {
+	srv, reqs := startRemoteServer(t, http.StatusNoContent)
+	s := newPromStore(srv.URL+"/api/v1/write", "segredo")
+
+	base := time.UnixMilli(1760000000123)
+	// O lote mais novo chega primeiro: o envio reordena os pontos.
+	err := s.Write([]HistoryBatch{
+		{Host: "srv1", Timestamp: base.Add(time.Minute), Metrics: map[string]float64{"cpu_usage": 20, "net.rx-bytes": 300}},
+		{Host: "srv1", Timestamp: base, Metrics: map[string]float64{"cpu_usage": 10}},
+		{Host: "srv0", Timestamp: base, Metrics: map[string]float64{"cpu_usage": 5}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := <-reqs
+	for header, want := range map[string]string{
+		"Content-Type":                      "application/x-protobuf",
+		"Content-Encoding":                  "snappy",
+		"X-Prometheus-Remote-Write-Version": "0.1.0",
+		"Authorization":                     "Bearer segredo",
+	} {
+		if got := req.header.Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+
+	series, err := decodeWriteRequest(req.body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms := base.UnixMilli()
+	want := []promSeries{
+		{[][2]string{{"__name__", "batedor_cpu_usage"}, {"host", "srv0"}}, []promSample{{5, ms}}},
+		{[][2]string{{"__name__", "batedor_cpu_usage"}, {"host", "srv1"}}, []promSample{{10, ms}, {20, ms + 60000}}},
+		{[][2]string{{"__name__", "batedor_net_rx_bytes"}, {"host", "srv1"}}, []promSample{{300, ms + 60000}}},
+	}
+	if fmt.Sprint(series) != fmt.Sprint(want) {
+		t.Errorf("séries =\n%v\nwant\n%v", series, want)
+	}
+}
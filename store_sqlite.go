@@ -0,0 +1,206 @@
+// /*********************************************************************************
+// * Projeto:     Batedor
+// * Componente:  Store SQLite - Histórico no banco local (armazenamento padrão)
+// *********************************************************************************/
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// sqliteStore guarda o histórico no banco SQLite local (--db).
+type sqliteStore struct {
+	db   *sql.DB
+	path string
+}
+
+// openSQLiteStore abre o banco local e o publica em db para a auditoria.
+func openSQLiteStore() (*sqliteStore, error) {
+	path, err := resolveDBPath()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("falha ao criar o diretório de dados: %v", err)
+	}
+	conn, err := openDatabase(path)
+	if err != nil {
+		return nil, err
+	}
+	db = conn
+	return &sqliteStore{db: conn, path: path}, nil
+}
+
+func (s *sqliteStore) String() string { return "sqlite " + s.path }
+
+func (s *sqliteStore) Close() error { return s.db.Close() }
+
+// Write grava os lotes em uma única transação. Os instantes vão em UTC: o
+// SQLite compara as datas como texto, e instantes com fusos diferentes
+// ficariam fora de ordem nas consultas por intervalo.
+func (s *sqliteStore) Write(batches []HistoryBatch) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	metricStmt, err := tx.Prepare("INSERT OR REPLACE INTO metrics(host, timestamp, metric_name, value) values(?,?,?,?)")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer metricStmt.Close()
+	procStmt, err := tx.Prepare("INSERT OR REPLACE INTO process_samples(host, timestamp, pid, user, command, cpu, mem) values(?,?,?,?,?,?,?)")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer procStmt.Close()
+
+	for _, b := range batches {
+		for name, value := range b.Metrics {
+			if _, err := metricStmt.Exec(b.Host, b.Timestamp.UTC(), name, value); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		for _, p := range b.Procs {
+			if _, err := procStmt.Exec(b.Host, b.Timestamp.UTC(), p.PID, p.User, p.Command, p.CPU, float64(p.Mem)); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// Query busca os pontos da série no banco; a agregação é feita depois, a
+// mesma de todos os armazenamentos.
+func (s *sqliteStore) Query(q RangeQuery) ([]MetricRecord, error) {
+	query := `
+		SELECT timestamp, value FROM metrics
+		WHERE metric_name = ? AND timestamp >= ? AND timestamp <= ? AND host = ?
+		ORDER BY timestamp ASC`
+	args := []interface{}{q.Metric, q.From.UTC(), q.To.UTC(), q.Host}
+	if q.Host == fleetHostKey {
+		query = `
+		SELECT timestamp, value FROM metrics
+		WHERE metric_name = ? AND timestamp >= ? AND timestamp <= ?
+		ORDER BY timestamp ASC`
+		args = args[:3]
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []MetricRecord
+	for rows.Next() {
+		var rec MetricRecord
+		if err := rows.Scan(&rec.Timestamp, &rec.Value); err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return aggregate(records, q.Step, q.Agg), nil
+}
+
+// Series lista as séries gravadas. O host local aparece como "".
+func (s *sqliteStore) Series() ([]Series, error) {
+	rows, err := s.db.Query("SELECT DISTINCT host, metric_name FROM metrics ORDER BY host, metric_name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var series []Series
+	for rows.Next() {
+		var sr Series
+		if err := rows.Scan(&sr.Host, &sr.Metric); err != nil {
+			return nil, err
+		}
+		series = append(series, sr)
+	}
+	return series, rows.Err()
+}
+
+// Retain apaga as métricas e as amostras de processos anteriores a before.
+// A trilha de auditoria não é apagada.
+func (s *sqliteStore) Retain(before time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, table := range []string{"metrics", "process_samples"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE timestamp < ?", before.UTC()); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// TopProcessesAt busca a amostra de processos de um host mais próxima de ts
+// (dentro da janela informada). Os registros são devolvidos ordenados por CPU.
+func (s *sqliteStore) TopProcessesAt(host string, ts time.Time, window time.Duration) ([]ProcessRecord, error) {
+	rows, err := s.db.Query(`
+		SELECT timestamp, pid, user, command, cpu, mem FROM process_samples
+		WHERE host = ? AND timestamp >= ? AND timestamp <= ?
+		ORDER BY timestamp ASC, cpu DESC`,
+		host, ts.Add(-window).UTC(), ts.Add(window).UTC(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var all []ProcessRecord
+	for rows.Next() {
+		var rec ProcessRecord
+		if err := rows.Scan(&rec.Timestamp, &rec.PID, &rec.User, &rec.Command, &rec.CPU, &rec.Mem); err != nil {
+			return nil, err
+		}
+		all = append(all, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return nearestSample(all, ts), nil
+}
+
+// nearestSample devolve, de registros ordenados por instante, os do instante
+// gravado mais próximo de ts.
+func nearestSample(all []ProcessRecord, ts time.Time) []ProcessRecord {
+	if len(all) == 0 {
+		return nil
+	}
+	nearest := all[0].Timestamp
+	for _, rec := range all {
+		if absDuration(rec.Timestamp.Sub(ts)) < absDuration(nearest.Sub(ts)) {
+			nearest = rec.Timestamp
+		}
+	}
+
+	var records []ProcessRecord
+	for _, rec := range all {
+		if rec.Timestamp.Equal(nearest) {
+			records = append(records, rec)
+		}
+	}
+	return records
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
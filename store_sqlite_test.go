@@ -0,0 +1,186 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// openTestSQLiteStore abre um banco novo em um diretório temporário.
+func openTestSQLiteStore(t *testing.T) *sqliteStore {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "history.db")
+	conn, err := openDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &sqliteStore{db: conn, path: path}
+}
+
+func TestSQLiteStoreMixedOffsets(t *testing.T) {
+	s := openTestSQLiteStore(t)
+	base := time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC)
+	saoPaulo := time.FixedZone("UTC-3", -3*3600)
+	kolkata := time.FixedZone("UTC+5:30", 5*3600+1800)
+
+	// O mesmo host envia amostras com fusos diferentes (agente em UTC-3,
+	// servidor em UTC, outra máquina em UTC+5:30).
+	batches := []HistoryBatch{
+		{Host: "srv1", Timestamp: base.Add(-2 * time.Minute).In(kolkata), Metrics: map[string]float64{"cpu_usage": 10}},
+		{Host: "srv1", Timestamp: base.In(saoPaulo), Metrics: map[string]float64{"cpu_usage": 20},
+			Procs: []ProcData{{PID: 42, User: "root", Command: "nginx", CPU: 5}}},
+		{Host: "srv1", Timestamp: base.Add(30 * time.Second), Metrics: map[string]float64{"cpu_usage": 30}},
+		{Host: "srv1", Timestamp: base.Add(2 * time.Minute).In(saoPaulo), Metrics: map[string]float64{"cpu_usage": 40}},
+	}
+	if err := s.Write(batches); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		want     []float64
+	}{
+		{"janela em UTC", base.Add(-time.Minute), base.Add(time.Minute), []float64{20, 30}},
+		{"janela em UTC-3", base.Add(-time.Minute).In(saoPaulo), base.Add(time.Minute).In(saoPaulo), []float64{20, 30}},
+		{"janela em UTC+5:30", base.Add(-3 * time.Minute).In(kolkata), base.Add(3 * time.Minute).In(kolkata), []float64{10, 20, 30, 40}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := s.Query(RangeQuery{Host: "srv1", Metric: "cpu_usage", From: tt.from, To: tt.to})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != len(tt.want) {
+				t.Fatalf("Query() = %+v, want valores %v", records, tt.want)
+			}
+			for i, rec := range records {
+				if rec.Value != tt.want[i] {
+					t.Errorf("ponto %d = %v, want %v", i, rec.Value, tt.want[i])
+				}
+			}
+		})
+	}
+
+	// Devolvido no fuso local, o instante continua o mesmo.
+	records, err := s.Query(RangeQuery{Host: "srv1", Metric: "cpu_usage", From: base, To: base})
+	if err != nil || len(records) != 1 || !records[0].Timestamp.Equal(base) {
+		t.Errorf("Query() no instante exato = %+v, %v", records, err)
+	}
+
+	procs, err := s.TopProcessesAt("srv1", base.Add(10*time.Second).In(kolkata), time.Minute)
+	if err != nil || len(procs) != 1 || procs[0].PID != 42 {
+		t.Errorf("TopProcessesAt() = %+v, %v", procs, err)
+	}
+
+	if err := s.Retain(base.In(saoPaulo)); err != nil {
+		t.Fatal(err)
+	}
+	records, err = s.Query(RangeQuery{Host: "srv1", Metric: "cpu_usage", From: base.Add(-time.Hour), To: base.Add(time.Hour)})
+	if err != nil || len(records) != 3 {
+		t.Errorf("depois de Retain() = %+v, %v; want os 3 pontos a partir de base", records, err)
+	}
+}
+
+func TestMigrateTimestampsToUTC(t *testing.T) {
+	s := openTestSQLiteStore(t)
+	// Bancos antigos guardavam o instante com o fuso de quem coletou.
+	if _, err := s.db.Exec(`
+		INSERT INTO metrics(host, timestamp, metric_name, value) VALUES
+			('', '2026-03-10 12:00:00.123456789-03:00', 'cpu_usage', 1),
+			('', '2026-03-10 15:00:30+00:00', 'cpu_usage', 2),
+			('', '2026-03-10 20:31:00+05:30', 'cpu_usage', 3);
+		INSERT INTO process_samples(host, timestamp, pid, user, command, cpu, mem) VALUES
+			('', '2026-03-10 12:00:00-03:00', 1, 'root', 'init', 0, 0);
+		UPDATE schema_version SET version = version - 1;`); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrate(s.db); err != nil {
+		t.Fatal(err)
+	}
+
+	base := time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC)
+	records, err := s.Query(RangeQuery{Host: "", Metric: "cpu_usage", From: base, To: base.Add(time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || records[0].Value != 1 || records[2].Value != 3 {
+		t.Fatalf("Query() depois da migração = %+v", records)
+	}
+	if want := base.Add(123 * time.Millisecond); !records[0].Timestamp.Equal(want) {
+		t.Errorf("instante migrado = %v, want %v", records[0].Timestamp, want)
+	}
+	procs, err := s.TopProcessesAt("", base, time.Second)
+	if err != nil || len(procs) != 1 {
+		t.Errorf("TopProcessesAt() depois da migração = %+v, %v", procs, err)
+	}
+}
+
+func TestNearestSample(t *testing.T) {
+	base := time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC)
+	all := []ProcessRecord{
+		{Timestamp: base, PID: 1},
+		{Timestamp: base, PID: 2},
+		{Timestamp: base.Add(time.Minute), PID: 3},
+		{Timestamp: base.Add(time.Minute), PID: 4},
+		{Timestamp: base.Add(2 * time.Minute), PID: 5},
+	}
+	pids := func(records []ProcessRecord) []int32 {
+		var pids []int32
+		for _, rec := range records {
+			pids = append(pids, rec.PID)
+		}
+		return pids
+	}
+	tests := []struct {
+		name string
+		ts   time.Time
+		want []int32
+	}{
+		{"instante exato", base.Add(time.Minute), []int32{3, 4}},
+		{"mais perto do anterior", base.Add(20 * time.Second), []int32{1, 2}},
+		{"mais perto do seguinte", base.Add(100 * time.Second), []int32{5}},
+		{"empate fica com o primeiro", base.Add(30 * time.Second), []int32{1, 2}},
+		{"antes de tudo", base.Add(-time.Hour), []int32{1, 2}},
+		{"em outro fuso", base.Add(2 * time.Minute).In(time.FixedZone("UTC-3", -3*3600)), []int32{5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pids(nearestSample(all, tt.ts)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("nearestSample() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if got := nearestSample(nil, base); got != nil {
+		t.Errorf("nearestSample(nil) = %+v", got)
+	}
+}
+
+func TestSQLiteStoreTopProcessesAt(t *testing.T) {
+	s := openTestSQLiteStore(t)
+	base := time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC)
+	if err := s.Write([]HistoryBatch{
+		{Host: "srv1", Timestamp: base, Procs: []ProcData{{PID: 1, Command: "a", CPU: 5}, {PID: 2, Command: "b", CPU: 50}}},
+		{Host: "srv1", Timestamp: base.Add(time.Minute), Procs: []ProcData{{PID: 3, Command: "c", CPU: 1}}},
+		{Host: "srv2", Timestamp: base.Add(10 * time.Second), Procs: []ProcData{{PID: 4, Command: "d", CPU: 9}}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Ordenados por CPU, só do host pedido.
+	procs, err := s.TopProcessesAt("srv1", base.Add(10*time.Second), 30*time.Second)
+	if err != nil || len(procs) != 2 || procs[0].PID != 2 || procs[1].PID != 1 || procs[0].Command != "b" {
+		t.Errorf("TopProcessesAt() = %+v, %v", procs, err)
+	}
+	procs, err = s.TopProcessesAt("srv1", base.Add(50*time.Second), 30*time.Second)
+	if err != nil || len(procs) != 1 || procs[0].PID != 3 {
+		t.Errorf("TopProcessesAt() perto da segunda amostra = %+v, %v", procs, err)
+	}
+	// Fora da janela não há amostra.
+	procs, err = s.TopProcessesAt("srv1", base.Add(time.Hour), time.Minute)
+	if err != nil || len(procs) != 0 {
+		t.Errorf("TopProcessesAt() fora da janela = %+v, %v", procs, err)
+	}
+}
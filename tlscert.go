@@ -0,0 +1,108 @@
+// /*********************************************************************************
+// * Projeto:     Batedor
+// * Componente:  TLS - Certificados dos servidores do Batedor (agente e web)
+// *********************************************************************************/
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// isLoopback indica se o endereço de escuta só aceita conexões locais.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// serverTLSConfig monta o TLS de um servidor a partir do par certificado e
+// chave (PEM) ou, com selfSigned, de um certificado autoassinado gerado na
+// hora. Sem nenhum dos dois, devolve nil: o servidor usa HTTP simples.
+func serverTLSConfig(addr, certFile, keyFile string, selfSigned bool) (*tls.Config, error) {
+	var cert tls.Certificate
+	var err error
+	switch {
+	case selfSigned:
+		if cert, err = selfSignedCertificate(addr); err != nil {
+			return nil, fmt.Errorf("falha ao gerar certificado autoassinado: %v", err)
+		}
+		log.Printf("Certificado autoassinado gerado (SHA-256 %s)", certFingerprint(cert))
+	case certFile != "":
+		if cert, err = tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, nil
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, nil
+}
+
+// selfSignedCertificate gera um certificado ECDSA válido por um ano para
+// localhost, o hostname da máquina e o endereço de escuta.
+func selfSignedCertificate(addr string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"Batedor"}, CommonName: "batedor"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		template.DNSNames = append(template.DNSNames, hostname)
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil && host != "" {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// certFingerprint devolve o SHA-256 do certificado, para conferir no navegador.
+func certFingerprint(cert tls.Certificate) string {
+	sum := sha256.Sum256(cert.Certificate[0])
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
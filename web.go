@@ -5,8 +5,11 @@
 package main
 
 import (
+	"encoding/json"
 	"log"
 	"net/http"
+	"sort"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
@@ -14,44 +17,247 @@ import (
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	CheckOrigin:     func(r *http.Request) bool { return true }, // Permite todas as origens
+	CheckOrigin:     checkSameOrigin, // Recusa páginas de outros sites
 }
 
-// Hub mantém o conjunto de clientes ativos.
+// Limites de cada conexão WebSocket.
+const (
+	wsWriteWait      = 10 * time.Second    // Tempo máximo para enviar uma mensagem.
+	wsPongWait       = 60 * time.Second    // Tempo sem resposta até a conexão ser dada como morta.
+	wsPingPeriod     = wsPongWait * 9 / 10 // Intervalo dos pings; menor que wsPongWait.
+	wsMaxMessageSize = 64 * 1024           // Tamanho máximo de um comando recebido.
+	wsSendQueue      = 16                  // Mensagens aguardando envio antes de o cliente ser descartado.
+)
+
+// client é uma conexão WebSocket com sua fila de envio. Somente writePump
+// escreve na conexão e somente o Hub fecha a fila.
+type client struct {
+	hub        *Hub
+	conn       *websocket.Conn
+	send       chan clientMessage
+	id         webIdentity
+	remoteAddr string
+	since      time.Time
+
+	// Assinatura vista pelo Hub (nil recebe o WebData completo a cada coleta).
+	sub *Subscription
+	// Atualizações da assinatura, montadas pela goroutine do writePump.
+	stream subscriptionStream
+}
+
+// clientMessage é um item da fila de envio: uma mensagem pronta ou, para
+// clientes assinantes, uma coleta de que o writePump tira a diferença. Ao
+// assinar, sub traz a nova assinatura.
+type clientMessage struct {
+	data []byte
+	snap *Snapshot
+	sub  *Subscription
+}
+
+// Hub mantém o conjunto de clientes ativos. Todo o estado é tocado só pela
+// goroutine de run; um cliente lento é descartado em vez de atrasar os demais.
 type Hub struct {
-	clients    map[*websocket.Conn]bool
+	clients    map[*client]bool // false enquanto o cliente pausou as atualizações.
 	broadcast  chan []byte
-	register   chan *websocket.Conn
-	unregister chan *websocket.Conn
+	publish    chan hubPublish
+	subscribe  chan hubSubscribe
+	direct     chan hubMessage
+	pause      chan hubPause
+	register   chan *client
+	unregister chan *client
+	stats      chan chan HubStats
+
+	latest  *Snapshot // Última coleta publicada, enviada a quem acaba de assinar.
+	sent    uint64    // Mensagens enfileiradas para envio.
+	dropped uint64    // Clientes descartados por não acompanharem o envio.
+
+	// Prazos das conexões, copiados de wsWriteWait, wsPongWait e
+	// wsPingPeriod. Os testes os encurtam antes de o Hub receber clientes.
+	writeWait, pongWait, pingPeriod time.Duration
+}
+
+// hubMessage é uma mensagem para um único cliente (respostas a comandos).
+type hubMessage struct {
+	client *client
+	data   []byte
+}
+
+// hubPublish é uma coleta para o dashboard: o WebData completo, enviado a
+// quem não assinou tópicos, e o Snapshot usado para montar as assinaturas.
+type hubPublish struct {
+	legacy []byte
+	snap   *Snapshot
+}
+
+// hubSubscribe troca a assinatura de um cliente.
+type hubSubscribe struct {
+	client *client
+	sub    *Subscription
+}
+
+// hubPause liga ou desliga as atualizações de um cliente.
+type hubPause struct {
+	client *client
+	paused bool
+}
+
+// HubClientStats descreve uma conexão para /api/hub.
+type HubClientStats struct {
+	User       string
+	RemoteAddr string
+	Since      time.Time
+	Paused     bool
+	Topics     []string // Tópicos assinados; vazio recebe o WebData completo.
+	Queued     int      // Mensagens na fila de envio.
+}
+
+// HubStats é o estado do Hub exposto em /api/hub.
+type HubStats struct {
+	Clients []HubClientStats
+	Sent    uint64
+	Evicted uint64
 }
 
 func newHub() *Hub {
 	return &Hub{
-		broadcast:  make(chan []byte),
-		register:   make(chan *websocket.Conn),
-		unregister: make(chan *websocket.Conn),
-		clients:    make(map[*websocket.Conn]bool),
+		broadcast:  make(chan []byte, 1),
+		publish:    make(chan hubPublish, 1),
+		subscribe:  make(chan hubSubscribe),
+		direct:     make(chan hubMessage),
+		pause:      make(chan hubPause),
+		register:   make(chan *client),
+		unregister: make(chan *client),
+		stats:      make(chan chan HubStats),
+		clients:    make(map[*client]bool),
+		writeWait:  wsWriteWait,
+		pongWait:   wsPongWait,
+		pingPeriod: wsPingPeriod,
+	}
+}
+
+// enqueue coloca a mensagem na fila do cliente sem bloquear. Com a fila
+// cheia, o cliente é descartado: fechar a fila encerra o writePump, que
+// fecha a conexão.
+func (h *Hub) enqueue(c *client, m clientMessage) {
+	select {
+	case c.send <- m:
+		h.sent++
+	default:
+		log.Printf("WebSocket: cliente %s descartado por não acompanhar as atualizações", c.remoteAddr)
+		h.remove(c)
+		h.dropped++
+	}
+}
+
+// remove tira o cliente do Hub e fecha sua fila.
+func (h *Hub) remove(c *client) {
+	if _, ok := h.clients[c]; ok {
+		delete(h.clients, c)
+		close(c.send)
 	}
 }
 
 func (h *Hub) run() {
 	for {
 		select {
-		case conn := <-h.register:
-			h.clients[conn] = true
-		case conn := <-h.unregister:
-			if _, ok := h.clients[conn]; ok {
-				delete(h.clients, conn)
-				conn.Close()
+		case c := <-h.register:
+			h.clients[c] = true
+		case c := <-h.unregister:
+			h.remove(c)
+		case p := <-h.pause:
+			if _, ok := h.clients[p.client]; ok {
+				h.clients[p.client] = !p.paused
+			}
+		case s := <-h.subscribe:
+			if _, ok := h.clients[s.client]; ok {
+				s.client.sub = s.sub
+				h.enqueue(s.client, clientMessage{snap: h.latest, sub: s.sub})
+			}
+		case p := <-h.publish:
+			// A diferença de cada assinante é calculada no writePump dele,
+			// para que um documento grande não atrase os demais clientes.
+			h.latest = p.snap
+			for c, active := range h.clients {
+				if !active {
+					continue
+				}
+				if c.sub == nil {
+					h.enqueue(c, clientMessage{data: p.legacy})
+				} else {
+					h.enqueue(c, clientMessage{snap: p.snap})
+				}
+			}
+		case msg := <-h.direct:
+			if _, ok := h.clients[msg.client]; ok {
+				h.enqueue(msg.client, clientMessage{data: msg.data})
 			}
 		case message := <-h.broadcast:
-			for conn := range h.clients {
-				err := conn.WriteMessage(websocket.TextMessage, message)
-				if err != nil {
-					log.Printf("error: %v", err)
-					h.unregister <- conn
+			for c, active := range h.clients {
+				if active {
+					h.enqueue(c, clientMessage{data: message})
 				}
 			}
+		case reply := <-h.stats:
+			st := HubStats{Sent: h.sent, Evicted: h.dropped}
+			for c, active := range h.clients {
+				cs := HubClientStats{
+					User:       c.id.Name,
+					RemoteAddr: c.remoteAddr,
+					Since:      c.since,
+					Paused:     !active,
+					Queued:     len(c.send),
+				}
+				if c.sub != nil {
+					for t := range c.sub.Topics {
+						cs.Topics = append(cs.Topics, t)
+					}
+					sort.Strings(cs.Topics)
+				}
+				st.Clients = append(st.Clients, cs)
+			}
+			sort.Slice(st.Clients, func(i, j int) bool { return st.Clients[i].Since.Before(st.Clients[j].Since) })
+			reply <- st
+		}
+	}
+}
+
+// Stats devolve os clientes conectados e os contadores do Hub.
+func (h *Hub) Stats() HubStats {
+	reply := make(chan HubStats)
+	h.stats <- reply
+	return <-reply
+}
+
+// writePump envia as mensagens da fila e os pings de keepalive, e monta as
+// atualizações dos assinantes a partir das coletas. Termina quando o Hub
+// fecha a fila ou uma escrita falha/excede o prazo.
+func (c *client) writePump() {
+	ticker := time.NewTicker(c.hub.pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+	for {
+		select {
+		case m, ok := <-c.send:
+			if !ok {
+				c.conn.SetWriteDeadline(time.Now().Add(c.hub.writeWait))
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			message := c.stream.next(m, time.Now())
+			if message == nil {
+				continue
+			}
+			c.conn.SetWriteDeadline(time.Now().Add(c.hub.writeWait))
+			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(c.hub.writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
 		}
 	}
 }
@@ -62,32 +268,129 @@ func serveWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
 		log.Println(err)
 		return
 	}
-	hub.register <- conn
+	id, authed := identityFrom(r)
+	c := &client{
+		hub:        hub,
+		conn:       conn,
+		send:       make(chan clientMessage, wsSendQueue),
+		id:         id,
+		remoteAddr: r.RemoteAddr,
+		since:      time.Now(),
+	}
+	hub.register <- c
+	go c.writePump()
 
 	// Garante que o cliente seja desregistrado ao sair.
-	defer func() { hub.unregister <- conn }()
+	defer func() {
+		hub.unregister <- c
+		conn.Close()
+	}()
+
+	conn.SetReadLimit(wsMaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(hub.pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(hub.pongWait))
+	})
+
+	// Só conexões autenticadas pelo dashboard enviam comandos; as demais
+	// (a frota conectada ao agente) apenas mantêm a conexão viva.
+	if authed {
+		hub.send(c, webHello{Type: "hello", User: id.Name, Role: id.Role})
+	}
 	for {
-		// Apenas mantém a conexão viva. Não precisamos ler nada do cliente.
-		if _, _, err := conn.NextReader(); err != nil {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
 			break
 		}
+		if !authed {
+			continue
+		}
+		var cmd WebCommand
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			hub.send(c, WebCommandResult{Type: "action_result", Message: "comando inválido: " + err.Error()})
+			continue
+		}
+		if cmd.Action == "subscribe" {
+			hub.send(c, subscribeClient(c, cmd))
+			continue
+		}
+		hub.send(c, runWebCommand(c, cmd))
+	}
+}
+
+// subscribeClient troca a assinatura do cliente. Não vai para a auditoria:
+// só muda o que a própria conexão recebe.
+func subscribeClient(c *client, cmd WebCommand) WebCommandResult {
+	result := WebCommandResult{Type: "action_result", Action: "subscribe"}
+	sub, err := newSubscription(cmd)
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	c.hub.subscribe <- hubSubscribe{client: c, sub: sub}
+	result.OK = true
+	result.Message = "ok"
+	return result
+}
+
+// send entrega v, em JSON, somente ao cliente c.
+func (h *Hub) send(c *client, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
 	}
+	h.direct <- hubMessage{client: c, data: data}
 }
 
 // startWebServer inicializa as rotas e o servidor.
 func startWebServer(hub *Hub) {
-	// Rota para servir os arquivos estáticos (index.html)
-	fs := http.FileServer(http.Dir("./frontend"))
-	http.Handle("/", fs)
+	handler, err := webHandler(hub, webConfig)
+	if err != nil {
+		log.Fatalf("Falha ao carregar os arquivos do dashboard: %v", err)
+	}
+
+	if !webConfig.AuthEnabled() && !isLoopback(webConfig.Addr) {
+		log.Printf("Atenção: o dashboard web escuta em %s sem autenticação; use --web-user ou --web-token", webConfig.Addr)
+	}
+	tlsConfig, err := serverTLSConfig(webConfig.Addr, webConfig.CertFile, webConfig.KeyFile, webConfig.SelfSigned)
+	if err != nil {
+		log.Fatalf("Falha ao configurar o TLS do dashboard web: %v", err)
+	}
+	server := &http.Server{Addr: webConfig.Addr, Handler: handler, TLSConfig: tlsConfig}
+	log.Printf("Dashboard web iniciado em %s", webConfig.URL())
+	if tlsConfig != nil {
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != nil {
+		log.Fatalf("Falha ao iniciar servidor web: %v", err)
+	}
+}
+
+// webHandler monta as rotas do dashboard, protegidas pela autenticação de cfg.
+func webHandler(hub *Hub, cfg WebConfig) (http.Handler, error) {
+	mux := http.NewServeMux()
+
+	// Rota para servir os arquivos estáticos (index.html), embutidos ou de --web-root
+	files, err := frontendHandler()
+	if err != nil {
+		return nil, err
+	}
+	mux.Handle("/", files)
 
 	// Rota para a conexão WebSocket
-	http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
 		serveWs(hub, w, r)
 	})
 
-	log.Println("Dashboard web iniciado em http://localhost:9090")
-	err := http.ListenAndServe(":9090", nil)
-	if err != nil {
-		log.Fatalf("Falha ao iniciar servidor web: %v", err)
-	}
-}
\ No newline at end of file
+	// Rotas do histórico (/api/hosts, /api/metrics, /api/history, /api/processes)
+	registerHistoryAPI(mux, history, "")
+
+	// Clientes conectados e contadores do WebSocket. Expõe os usuários e
+	// endereços de todas as sessões, então só operadores a consultam.
+	mux.HandleFunc("/api/hub", requireOperator(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, hub.Stats())
+	}))
+	return requireWebAuth(cfg, mux), nil
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// startTestHub inicia um Hub com prazos curtos.
+func startTestHub() *Hub {
+	h := newHub()
+	h.writeWait = 200 * time.Millisecond
+	h.pongWait = 300 * time.Millisecond
+	h.pingPeriod = 100 * time.Millisecond
+	go h.run()
+	return h
+}
+
+// registerTestClient registra um cliente sem conexão, cuja fila é lida pelo
+// próprio teste.
+func registerTestClient(h *Hub, name string, queue int) *client {
+	c := &client{hub: h, send: make(chan clientMessage, queue), remoteAddr: name, since: time.Now()}
+	h.register <- c
+	return c
+}
+
+// drain lê a fila do cliente até o Hub fechá-la e devolve quantas mensagens
+// chegaram.
+func drain(c *client) <-chan int {
+	count := make(chan int, 1)
+	go func() {
+		n := 0
+		for range c.send {
+			n++
+		}
+		count <- n
+	}()
+	return count
+}
+
+// waitHub espera até que ok aceite as estatísticas do Hub.
+func waitHub(t *testing.T, h *Hub, ok func(HubStats) bool) HubStats {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		st := h.Stats()
+		if ok(st) {
+			return st
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("o Hub não chegou ao estado esperado: %+v", st)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHubEvictsSlowClient(t *testing.T) {
+	h := startTestHub()
+	slow := registerTestClient(h, "lento", wsSendQueue)
+	fast := registerTestClient(h, "rápido", 1000)
+	received := drain(fast)
+
+	const messages = 100
+	for i := 0; i < messages; i++ {
+		h.broadcast <- []byte(fmt.Sprintf("%d", i))
+	}
+	// broadcast tem buffer: espera o Hub entregar a última mensagem.
+	st := waitHub(t, h, func(st HubStats) bool { return st.Sent == messages+wsSendQueue })
+	if st.Evicted != 1 || len(st.Clients) != 1 || st.Clients[0].RemoteAddr != "rápido" {
+		t.Fatalf("Stats() = %+v, want só o cliente rápido e 1 descartado", st)
+	}
+
+	// O lento fica com a fila cheia e fechada; o rápido recebe tudo.
+	if n := <-drain(slow); n != wsSendQueue {
+		t.Errorf("cliente lento recebeu %d mensagens, want %d", n, wsSendQueue)
+	}
+	h.unregister <- fast
+	if n := <-received; n != messages {
+		t.Errorf("cliente rápido recebeu %d mensagens, want %d", n, messages)
+	}
+	if st := h.Stats(); len(st.Clients) != 0 {
+		t.Errorf("Stats() = %+v, want nenhum cliente", st)
+	}
+}
+
+func TestHubRemoveRacesEnqueue(t *testing.T) {
+	h := startTestHub()
+	const clients = 50
+	var all []*client
+	var counts []<-chan int
+	for i := 0; i < clients; i++ {
+		// Metade lê a fila e metade não, para que remoções por descarte e
+		// por desconexão aconteçam ao mesmo tempo que os envios.
+		c := registerTestClient(h, fmt.Sprintf("c%d", i), 1+i%4)
+		all = append(all, c)
+		if i%2 == 0 {
+			counts = append(counts, drain(c))
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			h.broadcast <- []byte("b")
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			h.direct <- hubMessage{client: all[i%clients], data: []byte("d")}
+			h.pause <- hubPause{client: all[(i+1)%clients], paused: i%3 == 0}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		// Cada cliente sai duas vezes (como quando a leitura falha depois
+		// do descarte); a segunda saída não pode fechar a fila de novo.
+		for _, c := range all {
+			h.unregister <- c
+			h.unregister <- c
+		}
+	}()
+	wg.Wait()
+
+	st := h.Stats()
+	if len(st.Clients) != 0 {
+		t.Fatalf("clientes restantes: %+v", st.Clients)
+	}
+	for i, c := range all {
+		if i%2 == 0 {
+			continue
+		}
+		// A fila de quem não lia também foi fechada.
+		for range c.send {
+		}
+	}
+	for _, count := range counts {
+		<-count
+	}
+}
+
+// startTestWsServer serve o WebSocket do Hub como o dashboard (sem
+// autenticação) e devolve a URL ws://.
+func startTestWsServer(t *testing.T, h *Hub) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveWs(h, w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func dialTestWs(t *testing.T, url string) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestHubKeepaliveTimeout(t *testing.T) {
+	h := startTestHub()
+	url := startTestWsServer(t, h)
+
+	// O cliente vivo lê as mensagens e por isso responde aos pings; o morto
+	// nunca lê e não responde.
+	alive := dialTestWs(t, url)
+	pings := make(chan struct{}, 100)
+	alive.SetPingHandler(func(data string) error {
+		pings <- struct{}{}
+		return alive.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+	go func() {
+		for {
+			if _, _, err := alive.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	dead := dialTestWs(t, url)
+	waitHub(t, h, func(st HubStats) bool { return len(st.Clients) == 2 })
+
+	start := time.Now()
+	waitHub(t, h, func(st HubStats) bool { return len(st.Clients) == 1 })
+	if elapsed := time.Since(start); elapsed > 10*h.pongWait {
+		t.Errorf("cliente sem pong removido depois de %v", elapsed)
+	}
+
+	// Bem depois de vários prazos, o cliente que responde continua.
+	time.Sleep(3 * h.pongWait)
+	if st := h.Stats(); len(st.Clients) != 1 {
+		t.Errorf("Stats() = %+v, want o cliente vivo", st)
+	}
+	if len(pings) < 3 {
+		t.Errorf("%d pings recebidos, want ao menos 3", len(pings))
+	}
+
+	// A conexão do morto foi fechada pelo servidor.
+	dead.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		if _, _, err := dead.ReadMessage(); err != nil {
+			if ne, ok := err.(interface{ Timeout() bool }); ok && ne.Timeout() {
+				t.Fatal("a conexão sem pong não foi fechada")
+			}
+			break
+		}
+	}
+}
+
+func TestHubSlowConnectionEvicted(t *testing.T) {
+	h := startTestHub()
+	url := startTestWsServer(t, h)
+
+	fast := dialTestWs(t, url)
+	got := make(chan struct{})
+	go func() {
+		defer close(got)
+		for {
+			if _, _, err := fast.ReadMessage(); err != nil {
+				return
+			}
+			got <- struct{}{}
+		}
+	}()
+	slow := dialTestWs(t, url)
+	waitHub(t, h, func(st HubStats) bool { return len(st.Clients) == 2 })
+
+	// Mensagens grandes enchem o buffer do socket de quem não lê; a fila
+	// dele lota e o Hub o descarta sem parar os envios ao outro, que recebe
+	// cada mensagem antes da seguinte.
+	payload := bytes.Repeat([]byte("x"), 256*1024)
+	const messages = 200
+	for i := 0; i < messages; i++ {
+		h.broadcast <- payload
+		select {
+		case <-got:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("cliente rápido parou na mensagem %d: %+v", i, h.Stats())
+		}
+	}
+	st := waitHub(t, h, func(st HubStats) bool { return len(st.Clients) == 1 })
+	if st.Evicted != 1 {
+		t.Errorf("Stats() = %+v, want 1 descartado", st)
+	}
+
+	// O descartado é desconectado: a escrita bloqueada estoura o prazo e o
+	// writePump fecha a conexão.
+	slow.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		if _, _, err := slow.ReadMessage(); err != nil {
+			if ne, ok := err.(interface{ Timeout() bool }); ok && ne.Timeout() {
+				t.Fatal("a conexão descartada não foi fechada")
+			}
+			break
+		}
+	}
+
+	if st := h.Stats(); len(st.Clients) != 1 || st.Sent < messages {
+		t.Errorf("Stats() = %+v, want o cliente rápido conectado", st)
+	}
+}
+
+func TestHubClosePath(t *testing.T) {
+	h := startTestHub()
+	url := startTestWsServer(t, h)
+
+	// O cliente fecha: o servidor o tira do Hub.
+	conn := dialTestWs(t, url)
+	waitHub(t, h, func(st HubStats) bool { return len(st.Clients) == 1 })
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	conn.Close()
+	waitHub(t, h, func(st HubStats) bool { return len(st.Clients) == 0 })
+
+	// O Hub fecha a fila: o cliente recebe o aviso de fechamento. Um Hub
+	// novo, iniciado depois do registro, entrega ao teste o cliente do
+	// servidor.
+	h = newHub()
+	url = startTestWsServer(t, h)
+	registered := make(chan *client)
+	go func() {
+		c := <-h.register
+		h.clients[c] = true
+		go h.run()
+		registered <- c
+	}()
+	conn = dialTestWs(t, url)
+	c := <-registered
+	h.broadcast <- []byte("antes")
+	h.unregister <- c
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, data, err := conn.ReadMessage(); err != nil || string(data) != "antes" {
+		t.Fatalf("ReadMessage() = %q, %v", data, err)
+	}
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseNoStatusReceived) {
+		t.Fatalf("ReadMessage() depois do fechamento = %v, want close frame", err)
+	}
+	waitHub(t, h, func(st HubStats) bool { return len(st.Clients) == 0 })
+}
+
+func TestHubQueuesSnapshotsForSubscribers(t *testing.T) {
+	h := startTestHub()
+	legacy := registerTestClient(h, "completo", 10)
+	subscriber := registerTestClient(h, "assinante", 10)
+	sub := &Subscription{Topics: map[string]bool{"cpu": true}, Interval: minSubscriptionInterval, Sort: "cpu", Limit: 10}
+	h.subscribe <- hubSubscribe{client: subscriber, sub: sub}
+
+	snaps := []*Snapshot{{CPUUsage: 10}, {CPUUsage: 10}, {CPUUsage: 25}}
+	for _, snap := range snaps {
+		h.publish <- hubPublish{legacy: []byte("webdata"), snap: snap}
+	}
+	waitHub(t, h, func(st HubStats) bool { return st.Sent == 7 })
+	h.unregister <- legacy
+	h.unregister <- subscriber
+
+	// O Hub só repassa a coleta; quem não assinou recebe o WebData pronto.
+	for m := range legacy.send {
+		if string(m.data) != "webdata" || m.snap != nil {
+			t.Errorf("mensagem do cliente completo = %+v", m)
+		}
+	}
+	var queue []clientMessage
+	for m := range subscriber.send {
+		queue = append(queue, m)
+	}
+	if len(queue) != 4 || queue[0].sub != sub || queue[0].snap != nil {
+		t.Fatalf("fila do assinante = %+v, want a assinatura e 3 coletas", queue)
+	}
+	for i, m := range queue[1:] {
+		if m.snap != snaps[i] || m.data != nil {
+			t.Errorf("item %d da fila = %+v, want a coleta %d", i+1, m, i)
+		}
+	}
+
+	// O writePump monta o documento completo, depois só as diferenças.
+	var stream subscriptionStream
+	now := time.Now()
+	var got []string
+	for _, m := range queue {
+		if data := stream.next(m, now); data != nil {
+			got = append(got, string(data))
+		}
+		now = now.Add(time.Second)
+	}
+	want := []string{
+		`{"Type":"full","Data":{"CPU":{"Cores":null,"Usage":10}}}`,
+		`{"Type":"delta","Data":{"CPU":{"Usage":25}}}`,
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("atualizações = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,181 @@
+// /*********************************************************************************
+// * Projeto:     Batedor
+// * Componente:  WebActions - Comandos do dashboard web (sinais, prioridade, pausa)
+// *********************************************************************************/
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// WebCommand é um comando enviado pelo dashboard pelo WebSocket:
+//
+//	{"Action": "kill", "PID": 1234, "Signal": "TERM"}
+//	{"Action": "renice", "PID": 1234, "Nice": 10}
+//	{"Action": "pause"} / {"Action": "resume"}
+//
+// e o pedido de assinatura (veja Subscription).
+type WebCommand struct {
+	Action string
+	PID    int32
+	Signal string
+	Nice   int
+
+	// Campos de "subscribe".
+	Topics   []string
+	Interval int // Milissegundos.
+	Filter   string
+	Sort     string
+	Limit    int
+}
+
+// WebCommandResult é a resposta a um comando, enviada só a quem o pediu.
+type WebCommandResult struct {
+	Type    string // Sempre "action_result".
+	Action  string
+	PID     int32
+	OK      bool
+	Message string
+}
+
+// webHello informa ao dashboard quem está conectado e o que pode fazer.
+type webHello struct {
+	Type string // Sempre "hello".
+	User string
+	Role string
+}
+
+// webSignals são os sinais que o dashboard pode enviar.
+var webSignals = map[string]syscall.Signal{
+	"TERM": syscall.SIGTERM,
+	"KILL": syscall.SIGKILL,
+	"INT":  syscall.SIGINT,
+	"HUP":  syscall.SIGHUP,
+	"STOP": syscall.SIGSTOP,
+	"CONT": syscall.SIGCONT,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+}
+
+// processCommand devolve a linha de comando de um PID, para a auditoria.
+func processCommand(pid int32) string {
+	p, err := process.NewProcess(pid)
+	if err != nil {
+		return ""
+	}
+	if cmd, err := p.Cmdline(); err == nil && cmd != "" {
+		return cmd
+	}
+	name, _ := p.Name()
+	return name
+}
+
+// runWebCommand valida, executa e audita um comando do dashboard. Pausar e
+// retomar as atualizações vale para qualquer usuário, pois só afeta a
+// própria conexão; sinais e prioridade exigem o papel operator e só são
+// executados depois de gravados na trilha de auditoria: sem ela (outro
+// armazenamento que não o sqlite, banco travado), a ação é recusada.
+func runWebCommand(c *client, cmd WebCommand) WebCommandResult {
+	id := c.id
+	action := strings.ToLower(cmd.Action)
+	result := WebCommandResult{Type: "action_result", Action: action, PID: cmd.PID}
+	entry := AuditEntry{
+		Timestamp:  time.Now(),
+		User:       id.Name,
+		Role:       id.Role,
+		RemoteAddr: c.remoteAddr,
+		Action:     action,
+		PID:        cmd.PID,
+	}
+
+	// run é a ação validada, executada só depois da auditoria.
+	var run func() error
+	err := func() error {
+		switch action {
+		case "pause", "resume":
+			c.hub.pause <- hubPause{client: c, paused: action == "pause"}
+			return nil
+		case "kill", "renice":
+		default:
+			return fmt.Errorf("ação desconhecida: %q", cmd.Action)
+		}
+
+		if id.Role != roleOperator {
+			entry.Outcome = "negado"
+			return fmt.Errorf("o usuário %s não tem o papel operator", id.Name)
+		}
+		if cmd.PID <= 1 || int(cmd.PID) == os.Getpid() {
+			return fmt.Errorf("PID %d não pode ser alterado pelo dashboard", cmd.PID)
+		}
+		entry.Command = processCommand(cmd.PID)
+		if entry.Command == "" {
+			return fmt.Errorf("processo %d não encontrado", cmd.PID)
+		}
+
+		if action == "kill" {
+			name := strings.TrimPrefix(strings.ToUpper(cmd.Signal), "SIG")
+			if name == "" {
+				name = "TERM"
+			}
+			sig, ok := webSignals[name]
+			if !ok {
+				return fmt.Errorf("sinal não permitido: %s", cmd.Signal)
+			}
+			entry.Detail = "SIG" + name
+			run = func() error { return syscall.Kill(int(cmd.PID), sig) }
+			return nil
+		}
+
+		if cmd.Nice < -20 || cmd.Nice > 19 {
+			return fmt.Errorf("prioridade fora do intervalo -20..19: %d", cmd.Nice)
+		}
+		entry.Detail = fmt.Sprintf("nice %d", cmd.Nice)
+		run = func() error { return syscall.Setpriority(syscall.PRIO_PROCESS, int(cmd.PID), cmd.Nice) }
+		return nil
+	}()
+
+	if run != nil {
+		entry.Outcome = "em andamento"
+		auditID, auditErr := logAudit(entry)
+		if auditErr != nil {
+			log.Printf("Ação recusada sem auditoria (%s %s PID %d): %v", entry.User, entry.Action, entry.PID, auditErr)
+			result.Message = fmt.Sprintf("ação recusada: a trilha de auditoria não está disponível (%v)", auditErr)
+			return result
+		}
+		err = run()
+		entry.Outcome = "ok"
+		if err != nil {
+			entry.Outcome = err.Error()
+		}
+		if auditErr := setAuditOutcome(auditID, entry.Outcome); auditErr != nil {
+			log.Printf("Falha ao gravar o resultado na auditoria (%s %s PID %d): %v", entry.User, entry.Action, entry.PID, auditErr)
+		}
+	} else {
+		// Pausas e pedidos recusados antes de executar: a auditoria não
+		// impede nada, então uma falha só é registrada no log.
+		switch {
+		case err == nil:
+			entry.Outcome = "ok"
+		case entry.Outcome == "":
+			entry.Outcome = err.Error()
+		}
+		if _, auditErr := logAudit(entry); auditErr != nil {
+			log.Printf("Falha ao gravar auditoria (%s %s PID %d): %v", entry.User, entry.Action, entry.PID, auditErr)
+		}
+	}
+
+	if err != nil {
+		result.Message = err.Error()
+	} else {
+		result.OK = true
+		result.Message = "ok"
+	}
+	return result
+}
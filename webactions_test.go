@@ -0,0 +1,139 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// useTestAuditDB publica em db um banco novo para a auditoria.
+func useTestAuditDB(t *testing.T) {
+	t.Helper()
+	conn, err := openDatabase(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := db
+	db = conn
+	t.Cleanup(func() {
+		db = old
+		conn.Close()
+	})
+}
+
+// startSleeper inicia um processo filho que o teste pode sinalizar.
+func startSleeper(t *testing.T) *exec.Cmd {
+	t.Helper()
+	cmd := exec.Command("sleep", "30")
+	if err := cmd.Start(); err != nil {
+		t.Skipf("sleep indisponível: %v", err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	return cmd
+}
+
+// lastAudit devolve a última linha da trilha de auditoria.
+func lastAudit(t *testing.T) (action, detail, outcome string, pid int32, ok bool) {
+	t.Helper()
+	err := db.QueryRow("SELECT action, detail, outcome, pid FROM audit_log ORDER BY id DESC LIMIT 1").Scan(&action, &detail, &outcome, &pid)
+	return action, detail, outcome, pid, err == nil
+}
+
+func webTestClient(role string) *client {
+	return &client{id: webIdentity{Name: "ana", Role: role}, remoteAddr: "192.0.2.10:4000"}
+}
+
+func TestRunWebCommandRefusals(t *testing.T) {
+	useTestAuditDB(t)
+	sleeper := startSleeper(t)
+	pid := int32(sleeper.Process.Pid)
+
+	tests := []struct {
+		name    string
+		role    string
+		cmd     WebCommand
+		outcome string // Resultado gravado na auditoria.
+	}{
+		{"viewer não sinaliza", roleViewer, WebCommand{Action: "kill", PID: pid}, "negado"},
+		{"viewer não muda prioridade", roleViewer, WebCommand{Action: "renice", PID: pid, Nice: 5}, "negado"},
+		{"PID 1", roleOperator, WebCommand{Action: "kill", PID: 1}, "PID 1 não pode ser alterado pelo dashboard"},
+		{"PID zero", roleOperator, WebCommand{Action: "kill", PID: 0}, "PID 0 não pode ser alterado pelo dashboard"},
+		{"o próprio Batedor", roleOperator, WebCommand{Action: "kill", PID: int32(os.Getpid())}, ""},
+		{"sinal fora da lista", roleOperator, WebCommand{Action: "kill", PID: pid, Signal: "SEGV"}, "sinal não permitido: SEGV"},
+		{"nice abaixo de -20", roleOperator, WebCommand{Action: "renice", PID: pid, Nice: -21}, "prioridade fora do intervalo -20..19: -21"},
+		{"nice acima de 19", roleOperator, WebCommand{Action: "renice", PID: pid, Nice: 20}, "prioridade fora do intervalo -20..19: 20"},
+		{"ação desconhecida", roleOperator, WebCommand{Action: "reboot"}, `ação desconhecida: "reboot"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := runWebCommand(webTestClient(tt.role), tt.cmd)
+			if res.OK {
+				t.Fatalf("runWebCommand() = %+v, want recusado", res)
+			}
+			_, _, outcome, gotPID, ok := lastAudit(t)
+			if !ok || gotPID != tt.cmd.PID || (tt.outcome != "" && outcome != tt.outcome) {
+				t.Errorf("auditoria = %q (PID %d, %v), want %q", outcome, gotPID, ok, tt.outcome)
+			}
+		})
+	}
+	if err := sleeper.Process.Signal(syscall.Signal(0)); err != nil {
+		t.Errorf("o processo não deveria ter sido sinalizado: %v", err)
+	}
+}
+
+func TestRunWebCommandKillAndRenice(t *testing.T) {
+	useTestAuditDB(t)
+	sleeper := startSleeper(t)
+	pid := int32(sleeper.Process.Pid)
+	operator := webTestClient(roleOperator)
+
+	if res := runWebCommand(operator, WebCommand{Action: "renice", PID: pid, Nice: 7}); !res.OK {
+		t.Fatalf("renice = %+v", res)
+	}
+	if prio, err := syscall.Getpriority(syscall.PRIO_PROCESS, int(pid)); err != nil || 20-prio != 7 {
+		t.Errorf("prioridade = %d (%v), want nice 7", 20-prio, err)
+	}
+	if action, detail, outcome, _, _ := lastAudit(t); action != "renice" || detail != "nice 7" || outcome != "ok" {
+		t.Errorf("auditoria do renice = %s %s %s", action, detail, outcome)
+	}
+
+	if res := runWebCommand(operator, WebCommand{Action: "kill", PID: pid, Signal: "sigterm"}); !res.OK {
+		t.Fatalf("kill = %+v", res)
+	}
+	done := make(chan error, 1)
+	go func() { done <- sleeper.Wait() }()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("o processo não terminou com SIGTERM")
+	}
+	if action, detail, outcome, gotPID, _ := lastAudit(t); action != "kill" || detail != "SIGTERM" || outcome != "ok" || gotPID != pid {
+		t.Errorf("auditoria do kill = %s %s %s PID %d", action, detail, outcome, gotPID)
+	}
+}
+
+func TestRunWebCommandRequiresAudit(t *testing.T) {
+	old := db
+	db = nil
+	t.Cleanup(func() { db = old })
+	sleeper := startSleeper(t)
+	pid := int32(sleeper.Process.Pid)
+
+	for _, cmd := range []WebCommand{{Action: "kill", PID: pid, Signal: "KILL"}, {Action: "renice", PID: pid, Nice: 10}} {
+		if res := runWebCommand(webTestClient(roleOperator), cmd); res.OK {
+			t.Errorf("%s sem auditoria = %+v, want recusado", cmd.Action, res)
+		}
+	}
+	if err := sleeper.Process.Signal(syscall.Signal(0)); err != nil {
+		t.Errorf("o processo foi sinalizado sem auditoria: %v", err)
+	}
+	if prio, err := syscall.Getpriority(syscall.PRIO_PROCESS, int(pid)); err != nil || 20-prio != 0 {
+		t.Errorf("prioridade alterada sem auditoria: nice %d (%v)", 20-prio, err)
+	}
+}
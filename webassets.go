@@ -0,0 +1,75 @@
+// /*********************************************************************************
+// * Projeto:     Batedor
+// * Componente:  WebAssets - Arquivos do dashboard embutidos no binário
+// *********************************************************************************/
+package main
+
+import (
+	"crypto/sha256"
+	"embed"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// frontendFiles é o dashboard embutido no binário, servido de qualquer
+// diretório. Com --web-root, os arquivos passam a vir do disco.
+//
+//go:embed frontend
+var frontendFiles embed.FS
+
+// webRoot é o diretório com um frontend próprio (--web-root); vazio usa o embutido.
+var webRoot string
+
+// frontendHandler devolve o servidor dos arquivos estáticos do dashboard.
+// O navegador sempre revalida (no-cache): os arquivos embutidos levam um ETag
+// com o SHA-256 do conteúdo e os do disco, a data de modificação.
+func frontendHandler() (http.Handler, error) {
+	if webRoot != "" {
+		return noCache(http.FileServer(http.Dir(webRoot))), nil
+	}
+
+	sub, err := fs.Sub(frontendFiles, "frontend")
+	if err != nil {
+		return nil, err
+	}
+	etags := make(map[string]string)
+	err = fs.WalkDir(sub, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(sub, p)
+		if err != nil {
+			return err
+		}
+		etags["/"+p] = fmt.Sprintf(`"%x"`, sha256.Sum256(data))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	files := http.FileServer(http.FS(sub))
+	return noCache(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Clean("/" + r.URL.Path)
+		if strings.HasSuffix(r.URL.Path, "/") {
+			name = path.Join(name, "index.html")
+		}
+		// Com o ETag definido, o FileServer responde 304 a If-None-Match.
+		if etag, ok := etags[name]; ok {
+			w.Header().Set("ETag", etag)
+		}
+		files.ServeHTTP(w, r)
+	})), nil
+}
+
+// noCache pede ao navegador que revalide os arquivos a cada acesso, para que
+// uma nova versão do Batedor nunca sirva um dashboard antigo do cache.
+func noCache(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-cache")
+		next.ServeHTTP(w, r)
+	})
+}
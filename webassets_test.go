@@ -0,0 +1,90 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// getFrontend pede path ao handler, com If-None-Match quando etag não é vazio.
+func getFrontend(t *testing.T, h http.Handler, path, etag string) *http.Response {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	if etag != "" {
+		r.Header.Set("If-None-Match", etag)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	return rec.Result()
+}
+
+func TestFrontendHandlerETag(t *testing.T) {
+	old := webRoot
+	webRoot = ""
+	t.Cleanup(func() { webRoot = old })
+	h, err := frontendHandler()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/", "/?host=srv1"} {
+		resp := getFrontend(t, h, path, "")
+		etag := resp.Header.Get("ETag")
+		if resp.StatusCode != http.StatusOK || !strings.HasPrefix(etag, `"`) || len(etag) != 66 {
+			t.Fatalf("GET %s = %d, ETag %q", path, resp.StatusCode, etag)
+		}
+		if cc := resp.Header.Get("Cache-Control"); cc != "no-cache" {
+			t.Errorf("GET %s: Cache-Control = %q", path, cc)
+		}
+
+		// Com o mesmo ETag o navegador reaproveita a cópia que já tem.
+		if resp := getFrontend(t, h, path, etag); resp.StatusCode != http.StatusNotModified {
+			t.Errorf("GET %s com If-None-Match = %d, want 304", path, resp.StatusCode)
+		}
+		if resp := getFrontend(t, h, path, `"antigo"`); resp.StatusCode != http.StatusOK {
+			t.Errorf("GET %s com ETag antigo = %d, want 200", path, resp.StatusCode)
+		}
+	}
+	if resp := getFrontend(t, h, "/nao-existe.js", ""); resp.StatusCode != http.StatusNotFound || resp.Header.Get("ETag") != "" {
+		t.Errorf("arquivo inexistente = %d, ETag %q", resp.StatusCode, resp.Header.Get("ETag"))
+	}
+}
+
+func TestFrontendHandlerWebRoot(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte("<h1>painel próprio</h1>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := webRoot
+	webRoot = dir
+	t.Cleanup(func() { webRoot = old })
+	h, err := frontendHandler()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := getFrontend(t, h, "/", "")
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "<h1>painel próprio</h1>" {
+		t.Fatalf("GET / com --web-root = %d, %q", resp.StatusCode, body)
+	}
+	if cc := resp.Header.Get("Cache-Control"); cc != "no-cache" {
+		t.Errorf("Cache-Control = %q", cc)
+	}
+	// Os arquivos do disco são revalidados pela data de modificação.
+	lastModified := resp.Header.Get("Last-Modified")
+	if lastModified == "" {
+		t.Fatal("sem Last-Modified")
+	}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("If-Modified-Since", lastModified)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("GET / com If-Modified-Since = %d, want 304", rec.Code)
+	}
+}
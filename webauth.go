@@ -0,0 +1,218 @@
+// /*********************************************************************************
+// * Projeto:     Batedor
+// * Componente:  WebAuth - Autenticação e origem do dashboard web
+// *********************************************************************************/
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// webTokenCookie guarda o token depois do primeiro acesso com ?token=, para
+// que o navegador o reenvie nas próximas páginas e no WebSocket.
+const webTokenCookie = "batedor_token"
+
+// Papéis do dashboard web: quem só acompanha e quem pode agir nos processos.
+const (
+	roleViewer   = "viewer"
+	roleOperator = "operator"
+)
+
+// WebAccount é um usuário da autenticação básica do dashboard.
+type WebAccount struct {
+	Name string
+	Pass string
+	Role string
+}
+
+// webAccountsFlag permite repetir --web-user na linha de comando.
+type webAccountsFlag []WebAccount
+
+func (f *webAccountsFlag) String() string {
+	names := make([]string, len(*f))
+	for i, acc := range *f {
+		names[i] = acc.Name + ":" + acc.Role
+	}
+	return strings.Join(names, ", ")
+}
+
+// Set interpreta usuário:senha ou usuário:senha:papel. O usuário vai até o
+// primeiro ":" e, com mais de um ":", o papel é sempre o trecho depois do
+// último, que precisa ser viewer ou operator: uma senha com ":" exige o
+// papel explícito (ana:a:b:viewer). Assim, uma senha que termina em
+// ":viewer" nunca é cortada sem aviso.
+func (f *webAccountsFlag) Set(value string) error {
+	name, rest, ok := strings.Cut(value, ":")
+	if !ok || name == "" || rest == "" {
+		return fmt.Errorf("--web-user deve estar no formato usuário:senha[:papel]")
+	}
+	pass, role := rest, roleViewer
+	if i := strings.LastIndex(rest, ":"); i >= 0 {
+		pass, role = rest[:i], rest[i+1:]
+		if role != roleViewer && role != roleOperator {
+			return fmt.Errorf("--web-user %s: papel desconhecido %q (use viewer ou operator; uma senha com \":\" exige o papel no final, como %s:senha:viewer)", name, role, name)
+		}
+	}
+	if pass == "" {
+		return fmt.Errorf("--web-user %s: senha vazia", name)
+	}
+	*f = append(*f, WebAccount{Name: name, Pass: pass, Role: role})
+	return nil
+}
+
+// WebConfig reúne as opções de rede e de acesso do dashboard web.
+type WebConfig struct {
+	Addr          string          // Endereço de escuta (--web-addr).
+	CertFile      string          // Certificado TLS em PEM (--web-tls-cert).
+	KeyFile       string          // Chave privada TLS em PEM (--web-tls-key).
+	SelfSigned    bool            // Gera um certificado autoassinado ao iniciar.
+	Users         webAccountsFlag // Usuários da autenticação básica (--web-user).
+	Token         string          // Token de leitura aceito como Bearer, cookie ou ?token= (--web-token).
+	OperatorToken string          // Token com papel operator (--web-operator-token).
+}
+
+// webConfig é a configuração em uso pelo servidor web.
+var webConfig = WebConfig{Addr: "127.0.0.1:9090"}
+
+// TLS indica se o dashboard é servido por HTTPS.
+func (c WebConfig) TLS() bool {
+	return c.SelfSigned || c.CertFile != ""
+}
+
+// AuthEnabled indica se alguma forma de autenticação foi configurada.
+func (c WebConfig) AuthEnabled() bool {
+	return len(c.Users) > 0 || c.Token != "" || c.OperatorToken != ""
+}
+
+// URL devolve o endereço do dashboard para exibir no log.
+func (c WebConfig) URL() string {
+	scheme := "http"
+	if c.TLS() {
+		scheme = "https"
+	}
+	host, port, err := net.SplitHostPort(c.Addr)
+	if err != nil {
+		return scheme + "://" + c.Addr
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return scheme + "://" + net.JoinHostPort(host, port)
+}
+
+// webIdentity é quem fez a requisição e com qual papel.
+type webIdentity struct {
+	Name string
+	Role string
+}
+
+// webIdentityKey guarda a identidade no contexto da requisição.
+type webIdentityKey struct{}
+
+// identityFrom devolve a identidade autenticada da requisição. Conexões que
+// não passaram pelo dashboard (o agente, por exemplo) não têm identidade.
+func identityFrom(r *http.Request) (webIdentity, bool) {
+	id, ok := r.Context().Value(webIdentityKey{}).(webIdentity)
+	return id, ok
+}
+
+// authenticate confere as credenciais de uma requisição: autenticação
+// básica, token Bearer, cookie ou parâmetro ?token=. Devolve também o token
+// usado, para gravar o cookie. Sem autenticação configurada, todos entram
+// como viewer anônimo.
+func (c WebConfig) authenticate(r *http.Request) (webIdentity, string, bool) {
+	if !c.AuthEnabled() {
+		return webIdentity{Name: "anônimo", Role: roleViewer}, "", true
+	}
+	if user, pass, ok := r.BasicAuth(); ok {
+		for _, acc := range c.Users {
+			if tokenMatches(user, acc.Name) && tokenMatches(pass, acc.Pass) {
+				return webIdentity{Name: acc.Name, Role: acc.Role}, "", true
+			}
+		}
+	}
+
+	candidates := []string{bearerToken(r), r.URL.Query().Get("token")}
+	if cookie, err := r.Cookie(webTokenCookie); err == nil {
+		candidates = append(candidates, cookie.Value)
+	}
+	for _, got := range candidates {
+		if tokenMatches(got, c.OperatorToken) {
+			return webIdentity{Name: "token-operator", Role: roleOperator}, got, true
+		}
+		if tokenMatches(got, c.Token) {
+			return webIdentity{Name: "token", Role: roleViewer}, got, true
+		}
+	}
+	return webIdentity{}, "", false
+}
+
+// requireWebAuth protege todas as rotas do dashboard e guarda a identidade no
+// contexto. Um acesso com ?token= válido grava o cookie e redireciona para a
+// mesma página sem o token na URL.
+func requireWebAuth(c WebConfig, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, token, ok := c.authenticate(r)
+		if !ok {
+			if len(c.Users) > 0 {
+				w.Header().Set("WWW-Authenticate", `Basic realm="Batedor", charset="UTF-8"`)
+			}
+			http.Error(w, "acesso não autorizado", http.StatusUnauthorized)
+			return
+		}
+
+		query := r.URL.Query()
+		if token != "" && query.Get("token") != "" && r.Method == http.MethodGet && !isWebSocketUpgrade(r) {
+			http.SetCookie(w, &http.Cookie{
+				Name:     webTokenCookie,
+				Value:    token,
+				Path:     "/",
+				HttpOnly: true,
+				Secure:   c.TLS(),
+				SameSite: http.SameSiteStrictMode,
+			})
+			query.Del("token")
+			target := *r.URL
+			target.RawQuery = query.Encode()
+			http.Redirect(w, r, target.RequestURI(), http.StatusSeeOther)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), webIdentityKey{}, id)))
+	})
+}
+
+// requireOperator restringe uma rota do dashboard ao papel operator.
+func requireOperator(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if id, _ := identityFrom(r); id.Role != roleOperator {
+			http.Error(w, "rota restrita ao papel operator", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// isWebSocketUpgrade indica se a requisição abre um WebSocket.
+func isWebSocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// checkSameOrigin só aceita WebSockets abertos por páginas do próprio
+// dashboard. Clientes que não são navegadores (agentes, scripts) não enviam
+// Origin e são aceitos; a autenticação continua valendo para eles.
+func checkSameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestWebAccountsFlagSet(t *testing.T) {
+	tests := []struct {
+		value string
+		want  WebAccount
+		err   bool
+	}{
+		{value: "ana:senha", want: WebAccount{"ana", "senha", roleViewer}},
+		{value: "ana:senha:operator", want: WebAccount{"ana", "senha", roleOperator}},
+		{value: "ana:senha:viewer", want: WebAccount{"ana", "senha", roleViewer}},
+		// Uma senha que termina em ":viewer" é escrita com o papel explícito.
+		{value: "ana:abc:viewer:operator", want: WebAccount{"ana", "abc:viewer", roleOperator}},
+		{value: "ana:a:b:viewer", want: WebAccount{"ana", "a:b", roleViewer}},
+		{value: "ana:a:b", err: true},
+		{value: "ana:senha:admin", err: true},
+		{value: "ana:senha:", err: true},
+		{value: "ana::operator", err: true},
+		{value: "ana", err: true},
+		{value: ":senha", err: true},
+		{value: "ana:", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			var f webAccountsFlag
+			err := f.Set(tt.value)
+			if tt.err {
+				if err == nil {
+					t.Errorf("Set(%q) = %+v, want erro", tt.value, f)
+				}
+				return
+			}
+			if err != nil || len(f) != 1 || f[0] != tt.want {
+				t.Errorf("Set(%q) = %+v, %v; want %+v", tt.value, f, err, tt.want)
+			}
+		})
+	}
+}
+
+// testWebConfig tem um usuário de cada papel e os dois tokens.
+func testWebConfig() WebConfig {
+	return WebConfig{
+		Users:         webAccountsFlag{{"ana", "senha-ana", roleOperator}, {"bia", "senha-bia", roleViewer}},
+		Token:         "token-leitura",
+		OperatorToken: "token-operador",
+	}
+}
+
+func TestWebAuthenticate(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(r *http.Request)
+		want     webIdentity
+		token    string
+		accepted bool
+	}{
+		{"sem credenciais", func(r *http.Request) {}, webIdentity{}, "", false},
+		{"básica operator", func(r *http.Request) { r.SetBasicAuth("ana", "senha-ana") }, webIdentity{"ana", roleOperator}, "", true},
+		{"básica viewer", func(r *http.Request) { r.SetBasicAuth("bia", "senha-bia") }, webIdentity{"bia", roleViewer}, "", true},
+		{"básica com senha de outro", func(r *http.Request) { r.SetBasicAuth("bia", "senha-ana") }, webIdentity{}, "", false},
+		{"Bearer de leitura", func(r *http.Request) { r.Header.Set("Authorization", "Bearer token-leitura") },
+			webIdentity{"token", roleViewer}, "token-leitura", true},
+		{"Bearer operator", func(r *http.Request) { r.Header.Set("Authorization", "Bearer token-operador") },
+			webIdentity{"token-operator", roleOperator}, "token-operador", true},
+		{"Bearer errado", func(r *http.Request) { r.Header.Set("Authorization", "Bearer outro") }, webIdentity{}, "", false},
+		{"cookie", func(r *http.Request) { r.AddCookie(&http.Cookie{Name: webTokenCookie, Value: "token-leitura"}) },
+			webIdentity{"token", roleViewer}, "token-leitura", true},
+		{"cookie com outro nome", func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "outro", Value: "token-leitura"}) },
+			webIdentity{}, "", false},
+		{"?token=", func(r *http.Request) { r.URL.RawQuery = "token=token-operador" },
+			webIdentity{"token-operator", roleOperator}, "token-operador", true},
+	}
+	cfg := testWebConfig()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			tt.setup(r)
+			id, token, ok := cfg.authenticate(r)
+			if ok != tt.accepted || id != tt.want || token != tt.token {
+				t.Errorf("authenticate() = %+v, %q, %v; want %+v, %q, %v", id, token, ok, tt.want, tt.token, tt.accepted)
+			}
+		})
+	}
+
+	// Sem autenticação configurada, todos entram como viewer anônimo.
+	id, _, ok := WebConfig{}.authenticate(httptest.NewRequest(http.MethodGet, "/", nil))
+	if !ok || id.Role != roleViewer {
+		t.Errorf("sem autenticação = %+v, %v", id, ok)
+	}
+}
+
+func TestRequireWebAuth(t *testing.T) {
+	var seen webIdentity
+	handler := requireWebAuth(testWebConfig(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = identityFrom(r)
+	}))
+
+	// Sem credenciais: 401 com o pedido de autenticação básica.
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusUnauthorized || !strings.HasPrefix(rec.Header().Get("WWW-Authenticate"), "Basic") {
+		t.Errorf("sem credenciais = %d, WWW-Authenticate %q", rec.Code, rec.Header().Get("WWW-Authenticate"))
+	}
+
+	// ?token= grava o cookie e redireciona sem o token na URL.
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/pagina?host=srv1&token=token-leitura", nil))
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/pagina?host=srv1" {
+		t.Fatalf("com ?token= = %d, Location %q", rec.Code, rec.Header().Get("Location"))
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != webTokenCookie || cookies[0].Value != "token-leitura" || !cookies[0].HttpOnly {
+		t.Fatalf("cookie = %+v", cookies)
+	}
+
+	// O cookie gravado autentica a página seguinte e leva a identidade.
+	r := httptest.NewRequest(http.MethodGet, "/pagina?host=srv1", nil)
+	r.AddCookie(cookies[0])
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK || seen != (webIdentity{"token", roleViewer}) {
+		t.Errorf("com o cookie = %d, identidade %+v", rec.Code, seen)
+	}
+
+	// O WebSocket com ?token= segue direto, sem redirecionar.
+	r = httptest.NewRequest(http.MethodGet, "/ws?token=token-operador", nil)
+	r.Header.Set("Upgrade", "websocket")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK || seen.Role != roleOperator {
+		t.Errorf("WebSocket com ?token= = %d, identidade %+v", rec.Code, seen)
+	}
+}
+
+func TestCheckSameOrigin(t *testing.T) {
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"", true}, // Clientes que não são navegadores.
+		{"http://batedor:9090", true},
+		{"https://BATEDOR:9090", true},
+		{"http://batedor:9091", false},
+		{"http://evil.example", false},
+		{"://", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "http://batedor:9090/ws", nil)
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		if got := checkSameOrigin(r); got != tt.want {
+			t.Errorf("checkSameOrigin(Origin %q) = %v, want %v", tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestWebHandlerRoutes(t *testing.T) {
+	hub := startTestHub()
+	handler, err := webHandler(hub, testWebConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	// /api/hub mostra as sessões de todos: só operadores.
+	for _, tt := range []struct {
+		user, pass string
+		want       int
+	}{
+		{"bia", "senha-bia", http.StatusForbidden},
+		{"ana", "senha-ana", http.StatusOK},
+		{"ana", "errada", http.StatusUnauthorized},
+	} {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/hub", nil)
+		req.SetBasicAuth(tt.user, tt.pass)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("/api/hub como %s = %d, want %d", tt.user, resp.StatusCode, tt.want)
+		}
+	}
+
+	// Um WebSocket aberto por outro site é recusado mesmo com credenciais.
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+	header := http.Header{"Authorization": {"Bearer token-leitura"}, "Origin": {"http://evil.example"}}
+	conn, resp, err := websocket.DefaultDialer.Dial(wsURL, header)
+	if err == nil {
+		conn.Close()
+		t.Fatal("WebSocket de outra origem deveria ser recusado")
+	}
+	if resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("WebSocket de outra origem: %v, resposta %+v", err, resp)
+	}
+
+	header.Set("Origin", srv.URL)
+	conn, _, err = websocket.DefaultDialer.Dial(wsURL, header)
+	if err != nil {
+		t.Fatalf("WebSocket da mesma origem: %v", err)
+	}
+	conn.Close()
+
+	// Sem credenciais, nem o WebSocket abre.
+	if conn, resp, err := websocket.DefaultDialer.Dial(wsURL, nil); err == nil {
+		conn.Close()
+		t.Error("WebSocket sem credenciais deveria ser recusado")
+	} else if resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("WebSocket sem credenciais: %v", err)
+	}
+}
@@ -0,0 +1,345 @@
+// /*********************************************************************************
+// * Projeto:     Batedor
+// * Componente:  WebSub - Assinaturas do dashboard web e atualizações por diferença
+// *********************************************************************************/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// webTopics são os tópicos que um cliente pode assinar.
+var webTopics = []string{"cpu", "mem", "net", "disk", "host", "pressure", "sensors", "power", "containers", "alerts", "procs"}
+
+// Limites da assinatura pedida pelo cliente.
+const (
+	minSubscriptionInterval = 500 * time.Millisecond
+	maxSubscriptionInterval = time.Minute
+	maxSubscriptionProcs    = 500
+)
+
+// Subscription é o que um cliente quer receber e com que frequência:
+//
+//	{"Action": "subscribe", "Topics": ["cpu", "procs"], "Interval": 2000,
+//	 "Filter": "nginx", "Sort": "mem", "Limit": 20}
+//
+// Interval é em milissegundos. Sem tópicos, o cliente recebe todos.
+type Subscription struct {
+	Topics   map[string]bool
+	Interval time.Duration
+	Filter   string
+	Sort     string
+	Limit    int
+}
+
+// newSubscription valida um pedido de assinatura.
+func newSubscription(cmd WebCommand) (*Subscription, error) {
+	sub := &Subscription{
+		Topics:   make(map[string]bool),
+		Interval: time.Duration(cmd.Interval) * time.Millisecond,
+		Filter:   cmd.Filter,
+		Sort:     cmd.Sort,
+		Limit:    cmd.Limit,
+	}
+	topics := cmd.Topics
+	if len(topics) == 0 {
+		topics = webTopics
+	}
+	for _, t := range topics {
+		t = strings.ToLower(t)
+		valid := false
+		for _, known := range webTopics {
+			if t == known {
+				valid = true
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("tópico desconhecido: %q (use %s)", t, strings.Join(webTopics, ", "))
+		}
+		sub.Topics[t] = true
+	}
+
+	if sub.Interval == 0 {
+		sub.Interval = time.Second
+	}
+	if sub.Interval < minSubscriptionInterval {
+		sub.Interval = minSubscriptionInterval
+	}
+	if sub.Interval > maxSubscriptionInterval {
+		sub.Interval = maxSubscriptionInterval
+	}
+
+	switch sub.Sort {
+	case "", "cpu":
+		sub.Sort = "cpu"
+	case "mem", "pid":
+	default:
+		return nil, fmt.Errorf("ordenação desconhecida: %q (use cpu, mem ou pid)", sub.Sort)
+	}
+	if sub.Limit <= 0 {
+		sub.Limit = 50
+	}
+	if sub.Limit > maxSubscriptionProcs {
+		sub.Limit = maxSubscriptionProcs
+	}
+	return sub, nil
+}
+
+// WebDiskData é o uso do disco enviado ao dashboard.
+type WebDiskData struct {
+	Path        string
+	UsedPercent float64
+	Used        uint64
+	Free        uint64
+	Total       uint64
+}
+
+// WebHostData são as informações do sistema enviadas ao dashboard.
+type WebHostData struct {
+	Hostname    string
+	Platform    string
+	Version     string
+	Kernel      string
+	Motherboard string
+	Uptime      uint64 // Segundos.
+}
+
+// WebContainer é o resumo de um contêiner enviado ao dashboard.
+type WebContainer struct {
+	Name      string
+	Image     string
+	Runtime   string
+	Pod       string
+	CPU       float64
+	Mem       uint64
+	MemMax    uint64
+	NetRxRate float64
+	NetTxRate float64
+	IORate    float64
+	PIDs      uint64
+}
+
+// newWebData monta o WebData de uma coleta, com os limit primeiros
+// processos depois de filtrar e ordenar.
+func newWebData(snap *Snapshot, filter, sortBy string, limit int) WebData {
+	procs := filterAndSortProcs(webVisibleProcs(snap.Procs), filter, sortBy)
+	if len(procs) > limit {
+		procs = procs[:limit]
+	}
+
+	alerts := make([]string, len(snap.Alerts))
+	for i, alert := range snap.Alerts {
+		alerts[i] = alert.String()
+	}
+
+	wd := WebData{
+		CPU: CPUData{Cores: snap.Cores, Usage: snap.CPUUsage},
+		Mem: MemData{UsedPercent: snap.MemUsedPercent()},
+		Net: NetDataWeb{
+			DownloadRate: formatBytes(snap.Net.DownloadRate),
+			UploadRate:   formatBytes(snap.Net.UploadRate),
+			PublicIP:     snap.Net.PublicIP,
+			Latency:      snap.Net.Latency,
+		},
+		Pressure:   snap.Pressure,
+		Sensors:    snap.Sensors,
+		Power:      snap.PowerSupply,
+		Containers: make([]WebContainer, 0, len(snap.Containers)),
+		Alerts:     alerts,
+		Procs:      procs,
+	}
+	if snap.Mem != nil {
+		wd.Mem.Total, wd.Mem.Used, wd.Mem.Available, wd.Mem.Cached = snap.Mem.Total, snap.Mem.Used, snap.Mem.Available, snap.Mem.Cached
+	}
+	if snap.Swap != nil {
+		wd.Mem.SwapTotal, wd.Mem.SwapUsed = snap.Swap.Total, snap.Swap.Used
+	}
+	if d := snap.Disk; d != nil {
+		wd.Disk = &WebDiskData{Path: d.Path, UsedPercent: d.UsedPercent, Used: d.Used, Free: d.Free, Total: d.Total}
+	}
+	if h := snap.Host; h != nil {
+		wd.Host = &WebHostData{
+			Hostname:    h.Hostname,
+			Platform:    h.Platform,
+			Version:     h.PlatformVersion,
+			Kernel:      h.KernelVersion,
+			Motherboard: snap.Motherboard,
+			Uptime:      h.Uptime,
+		}
+	}
+	for _, c := range snap.Containers {
+		wd.Containers = append(wd.Containers, WebContainer{
+			Name:      c.Label(),
+			Image:     c.Image,
+			Runtime:   c.Runtime,
+			Pod:       c.PodLabel(),
+			CPU:       c.CPU,
+			Mem:       c.MemCurrent,
+			MemMax:    c.MemMax,
+			NetRxRate: c.NetRxRate,
+			NetTxRate: c.NetTxRate,
+			IORate:    c.IOReadRate + c.IOWriteRate,
+			PIDs:      c.PIDs,
+		})
+	}
+	return wd
+}
+
+// subscriptionDoc monta o documento de um cliente com os tópicos assinados.
+// Os processos vão em um objeto indexado pelo PID, para que a diferença só
+// carregue os processos (e os campos) que mudaram.
+func subscriptionDoc(snap *Snapshot, sub *Subscription) (map[string]interface{}, error) {
+	wd := newWebData(snap, sub.Filter, sub.Sort, sub.Limit)
+	fields := []struct {
+		topic, name string
+		value       interface{}
+	}{
+		{"cpu", "CPU", wd.CPU},
+		{"mem", "Mem", wd.Mem},
+		{"net", "Net", wd.Net},
+		{"disk", "Disk", wd.Disk},
+		{"host", "Host", wd.Host},
+		{"pressure", "Pressure", wd.Pressure},
+		{"sensors", "Sensors", wd.Sensors},
+		{"power", "Power", wd.Power},
+		{"containers", "Containers", wd.Containers},
+		{"alerts", "Alerts", wd.Alerts},
+	}
+
+	doc := make(map[string]interface{})
+	for _, f := range fields {
+		if sub.Topics[f.topic] {
+			doc[f.name] = f.value
+		}
+	}
+	if sub.Topics["procs"] {
+		procs := make(map[string]ProcData, len(wd.Procs))
+		for _, p := range wd.Procs {
+			procs[strconv.Itoa(int(p.PID))] = p
+		}
+		doc["Procs"] = procs
+	}
+
+	// Passa pelo JSON para comparar os documentos campo a campo.
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var generic map[string]interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil, err
+	}
+	roundFloats(generic)
+	return generic, nil
+}
+
+// roundFloats arredonda os números para duas casas, a precisão exibida pelo
+// dashboard, para que variações invisíveis não entrem na diferença.
+func roundFloats(v interface{}) interface{} {
+	switch x := v.(type) {
+	case float64:
+		return math.Round(x*100) / 100
+	case map[string]interface{}:
+		for k, item := range x {
+			x[k] = roundFloats(item)
+		}
+	case []interface{}:
+		for i, item := range x {
+			x[i] = roundFloats(item)
+		}
+	}
+	return v
+}
+
+// mergePatch calcula a diferença entre dois documentos no formato JSON Merge
+// Patch (RFC 7386): campos novos ou alterados levam o valor novo, campos
+// removidos levam null e objetos são comparados recursivamente.
+func mergePatch(old, cur map[string]interface{}) map[string]interface{} {
+	patch := make(map[string]interface{})
+	for k, nv := range cur {
+		ov, ok := old[k]
+		if !ok {
+			patch[k] = nv
+			continue
+		}
+		om, oIsMap := ov.(map[string]interface{})
+		nm, nIsMap := nv.(map[string]interface{})
+		if oIsMap && nIsMap {
+			if sub := mergePatch(om, nm); len(sub) > 0 {
+				patch[k] = sub
+			}
+			continue
+		}
+		if !reflect.DeepEqual(ov, nv) {
+			patch[k] = nv
+		}
+	}
+	for k := range old {
+		if _, ok := cur[k]; !ok {
+			patch[k] = nil
+		}
+	}
+	return patch
+}
+
+// webUpdate é a mensagem enviada a um cliente assinante: o documento
+// completo logo após assinar ("full") e depois só as diferenças ("delta").
+type webUpdate struct {
+	Type string
+	Data map[string]interface{}
+}
+
+// subscriptionStream guarda a assinatura em uso e o último documento
+// enviado, base da próxima diferença. Só é tocada pelo writePump do cliente.
+type subscriptionStream struct {
+	sub      *Subscription
+	lastDoc  map[string]interface{}
+	lastSent time.Time
+}
+
+// next devolve o que enviar para um item da fila: a própria mensagem, se já
+// vier pronta, ou a atualização da assinatura. nil indica que não há nada a
+// enviar.
+func (s *subscriptionStream) next(m clientMessage, now time.Time) []byte {
+	if m.sub != nil {
+		*s = subscriptionStream{sub: m.sub}
+	}
+	if m.snap == nil || s.sub == nil {
+		return m.data
+	}
+	return s.update(m.snap, now)
+}
+
+// update devolve a próxima mensagem de um cliente assinante, ou nil se
+// ainda não é hora ou nada mudou.
+func (s *subscriptionStream) update(snap *Snapshot, now time.Time) []byte {
+	if now.Sub(s.lastSent) < s.sub.Interval-50*time.Millisecond {
+		return nil
+	}
+	doc, err := subscriptionDoc(snap, s.sub)
+	if err != nil {
+		return nil
+	}
+
+	update := webUpdate{Type: "full", Data: doc}
+	if s.lastDoc != nil {
+		update = webUpdate{Type: "delta", Data: mergePatch(s.lastDoc, doc)}
+		if len(update.Data) == 0 {
+			s.lastSent = now
+			return nil
+		}
+	}
+	data, err := json.Marshal(update)
+	if err != nil {
+		return nil
+	}
+	s.lastDoc = doc
+	s.lastSent = now
+	return data
+}
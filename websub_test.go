@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, cur map[string]interface{}
+		want     map[string]interface{}
+	}{
+		{"iguais", map[string]interface{}{"a": 1.0, "b": "x"}, map[string]interface{}{"a": 1.0, "b": "x"}, map[string]interface{}{}},
+		{"valor alterado", map[string]interface{}{"a": 1.0, "b": "x"}, map[string]interface{}{"a": 2.0, "b": "x"}, map[string]interface{}{"a": 2.0}},
+		{"chave nova", map[string]interface{}{}, map[string]interface{}{"a": 1.0}, map[string]interface{}{"a": 1.0}},
+		{"chave removida vira null", map[string]interface{}{"a": 1.0, "b": 2.0}, map[string]interface{}{"a": 1.0}, map[string]interface{}{"b": nil}},
+		{"objeto aninhado",
+			map[string]interface{}{"Mem": map[string]interface{}{"Used": 1.0, "Total": 8.0, "Swap": 0.0}},
+			map[string]interface{}{"Mem": map[string]interface{}{"Used": 2.0, "Total": 8.0}},
+			map[string]interface{}{"Mem": map[string]interface{}{"Used": 2.0, "Swap": nil}}},
+		{"objeto aninhado igual some do patch",
+			map[string]interface{}{"Mem": map[string]interface{}{"Used": 1.0}, "a": 1.0},
+			map[string]interface{}{"Mem": map[string]interface{}{"Used": 1.0}, "a": 2.0},
+			map[string]interface{}{"a": 2.0}},
+		// Listas não são mescladas: vão inteiras quando mudam.
+		{"lista alterada", map[string]interface{}{"Cores": []interface{}{1.0, 2.0}}, map[string]interface{}{"Cores": []interface{}{1.0, 3.0}},
+			map[string]interface{}{"Cores": []interface{}{1.0, 3.0}}},
+		{"objeto trocado por valor", map[string]interface{}{"Disk": map[string]interface{}{"Used": 1.0}}, map[string]interface{}{"Disk": nil},
+			map[string]interface{}{"Disk": nil}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergePatch(tt.old, tt.cur); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergePatch() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubscriptionProcsDelta(t *testing.T) {
+	sub, err := newSubscription(WebCommand{Topics: []string{"procs"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := subscriptionDoc(&Snapshot{Procs: []ProcData{
+		{PID: 10, Command: "nginx", CPU: 5},
+		{PID: 20, Command: "redis", CPU: 2, Mem: 1},
+	}}, sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// O 10 muda de CPU, o 20 sai e o 30 entra.
+	second, err := subscriptionDoc(&Snapshot{Procs: []ProcData{
+		{PID: 10, Command: "nginx", CPU: 7},
+		{PID: 30, Command: "sshd", CPU: 1},
+	}}, sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	patch := mergePatch(first, second)
+	procs, ok := patch["Procs"].(map[string]interface{})
+	if len(patch) != 1 || !ok {
+		t.Fatalf("patch = %v", patch)
+	}
+	if changed, ok := procs["10"].(map[string]interface{}); !ok || len(changed) != 1 || changed["CPU"] != 7.0 {
+		t.Errorf("processo alterado = %v, want só o campo CPU", procs["10"])
+	}
+	if left, ok := procs["20"]; !ok || left != nil {
+		t.Errorf("processo que saiu = %v, want null", procs["20"])
+	}
+	if entered, ok := procs["30"].(map[string]interface{}); !ok || entered["Command"] != "sshd" {
+		t.Errorf("processo que entrou = %v", procs["30"])
+	}
+
+	// Aplicar o patch ao primeiro documento reproduz o segundo.
+	data, _ := json.Marshal(patch)
+	var roundTrip map[string]interface{}
+	json.Unmarshal(data, &roundTrip)
+	if applied := applyMergePatch(first, roundTrip); !reflect.DeepEqual(applied, second) {
+		t.Errorf("primeiro + patch = %v, want %v", applied, second)
+	}
+}
+
+// applyMergePatch aplica um JSON Merge Patch, como o frontend faz.
+func applyMergePatch(doc, patch map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(doc))
+	for k, v := range doc {
+		out[k] = v
+	}
+	for k, v := range patch {
+		pm, isMap := v.(map[string]interface{})
+		switch {
+		case v == nil:
+			delete(out, k)
+		case isMap:
+			dm, _ := out[k].(map[string]interface{})
+			out[k] = applyMergePatch(dm, pm)
+		default:
+			out[k] = v
+		}
+	}
+	return out
+}
+
+func TestNewSubscription(t *testing.T) {
+	sub, err := newSubscription(WebCommand{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sub.Topics) != len(webTopics) || sub.Interval != time.Second || sub.Sort != "cpu" || sub.Limit != 50 {
+		t.Errorf("assinatura padrão = %+v", sub)
+	}
+
+	tests := []struct {
+		name     string
+		cmd      WebCommand
+		interval time.Duration
+		limit    int
+	}{
+		{"intervalo abaixo do mínimo", WebCommand{Interval: 10}, minSubscriptionInterval, 50},
+		{"intervalo acima do máximo", WebCommand{Interval: 3600000}, maxSubscriptionInterval, 50},
+		{"intervalo pedido", WebCommand{Interval: 2000}, 2 * time.Second, 50},
+		{"limite acima do máximo", WebCommand{Limit: 100000}, time.Second, maxSubscriptionProcs},
+		{"limite negativo", WebCommand{Limit: -1}, time.Second, 50},
+		{"limite pedido", WebCommand{Limit: 20}, time.Second, 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub, err := newSubscription(tt.cmd)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sub.Interval != tt.interval || sub.Limit != tt.limit {
+				t.Errorf("intervalo %v e limite %d, want %v e %d", sub.Interval, sub.Limit, tt.interval, tt.limit)
+			}
+		})
+	}
+
+	sub, err = newSubscription(WebCommand{Topics: []string{"CPU", "procs"}, Sort: "mem", Filter: "nginx"})
+	if err != nil || !reflect.DeepEqual(sub.Topics, map[string]bool{"cpu": true, "procs": true}) || sub.Sort != "mem" || sub.Filter != "nginx" {
+		t.Errorf("assinatura com tópicos = %+v, %v", sub, err)
+	}
+
+	for _, cmd := range []WebCommand{
+		{Topics: []string{"cpu", "gpu"}},
+		{Sort: "user"},
+		{Sort: "CPU"},
+	} {
+		if sub, err := newSubscription(cmd); err == nil {
+			t.Errorf("newSubscription(%+v) = %+v, want erro", cmd, sub)
+		}
+	}
+}
+
+func TestSubscriptionStreamUpdate(t *testing.T) {
+	sub, err := newSubscription(WebCommand{Topics: []string{"cpu"}, Interval: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := subscriptionStream{sub: sub}
+	now := time.Unix(1000, 0)
+	snap := &Snapshot{Cores: []float64{10, 20}, CPUUsage: 15}
+
+	decode := func(data []byte) webUpdate {
+		t.Helper()
+		var u webUpdate
+		if err := json.Unmarshal(data, &u); err != nil {
+			t.Fatalf("mensagem %s: %v", data, err)
+		}
+		return u
+	}
+	if u := decode(s.update(snap, now)); u.Type != "full" || u.Data["CPU"] == nil {
+		t.Errorf("primeira mensagem = %+v", u)
+	}
+	if data := s.update(&Snapshot{Cores: []float64{90, 90}, CPUUsage: 90}, now.Add(100*time.Millisecond)); data != nil {
+		t.Errorf("antes do intervalo = %s, want nada", data)
+	}
+	if data := s.update(snap, now.Add(time.Second)); data != nil {
+		t.Errorf("sem mudança = %s, want nada", data)
+	}
+	u := decode(s.update(&Snapshot{Cores: []float64{10, 30}, CPUUsage: 20}, now.Add(2*time.Second)))
+	want := map[string]interface{}{"CPU": map[string]interface{}{"Cores": []interface{}{10.0, 30.0}, "Usage": 20.0}}
+	if u.Type != "delta" || !reflect.DeepEqual(u.Data, want) {
+		t.Errorf("diferença = %+v, want %v", u, want)
+	}
+}